@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// permissions for archived files and directories
+	archiveDirPerm  = 0o755
+	archiveFilePerm = 0o644
+
+	// max number of images archived with the same capture time
+	maxArchiveNameSuffix = 100
+)
+
+// archiveImage saves given image bytes into the archive directory,
+// and returns its path relative to the archive directory
+//
+// (images captured at the same time, eg. frames of a capture, get numbered suffixes instead of overwriting each other)
+func archiveImage(archiveDir string, capturedAt time.Time, bytes []byte) (relPath string, err error) {
+	name := capturedAt.Format("20060102-150405.000")
+	for i := 1; i <= maxArchiveNameSuffix; i++ {
+		filename := fmt.Sprintf("%s.jpg", name)
+		if i > 1 {
+			filename = fmt.Sprintf("%s-%d.jpg", name, i)
+		}
+		relPath = filepath.Join(capturedAt.Format("2006-01"), filename)
+
+		if err = writeArchivedFile(archiveDir, relPath, bytes); err == nil {
+			return relPath, nil
+		} else if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("too many archived images captured at %s", name)
+}
+
+// archivedFilePath returns the path of `relPath` in the archive directory
+// (paths which are absolute, or escape the archive directory are rejected)
+func archivedFilePath(archiveDir, relPath string) (string, error) {
+	if !filepath.IsLocal(relPath) {
+		return "", fmt.Errorf("invalid archive path: %s", relPath)
+	}
+
+	return filepath.Join(archiveDir, relPath), nil
+}
+
+// writeArchivedFile writes given bytes to a new file at `relPath` in the archive directory
+// (existing files are never overwritten, and an error wrapping `fs.ErrExist` is returned for them)
+func writeArchivedFile(archiveDir, relPath string, bytes []byte) error {
+	path, err := archivedFilePath(archiveDir, relPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), archiveDirPerm); err != nil {
+		return fmt.Errorf("failed to create archive directory: %s", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, archiveFilePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create archived image: %w", err)
+	}
+	if _, err := file.Write(bytes); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to write archived image: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to write archived image: %s", err)
+	}
+
+	return nil
+}
+
+// readArchivedImage reads an archived image at `relPath` in the archive directory
+func readArchivedImage(archiveDir, relPath string) ([]byte, error) {
+	path, err := archivedFilePath(archiveDir, relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(path)
+}
+
+// deleteArchivedImage deletes an archived image at `relPath` in the archive directory
+// (not an error if it does not exist)
+func deleteArchivedImage(archiveDir, relPath string) error {
+	path, err := archivedFilePath(archiveDir, relPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete archived image: %s", err)
+	}
+
+	return nil
+}
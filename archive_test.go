@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestArchiveImagesCapturedAtTheSameTime(t *testing.T) {
+	dir := t.TempDir()
+	capturedAt := time.Date(2026, 1, 2, 3, 4, 5, 678000000, time.Local)
+
+	// eg. a fused HDR image and its bracketed frames
+	paths := []string{}
+	for _, content := range []string{"fused", "frame 1", "frame 2"} {
+		path, err := archiveImage(dir, capturedAt, []byte(content))
+		if err != nil {
+			t.Fatalf("failed to archive image: %s", err)
+		}
+		paths = append(paths, path)
+	}
+	if expected := []string{
+		filepath.Join("2026-01", "20260102-030405.678.jpg"),
+		filepath.Join("2026-01", "20260102-030405.678-2.jpg"),
+		filepath.Join("2026-01", "20260102-030405.678-3.jpg"),
+	}; !slices.Equal(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	// nothing is overwritten
+	if bytes, err := readArchivedImage(dir, paths[0]); err != nil || string(bytes) != "fused" {
+		t.Errorf("unexpected archived image: %s (%v)", bytes, err)
+	}
+	if err := writeArchivedFile(dir, paths[1], []byte("other")); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected an error for an existing file, got: %v", err)
+	}
+	if bytes, err := readArchivedImage(dir, paths[1]); err != nil || string(bytes) != "frame 1" {
+		t.Errorf("unexpected archived image: %s (%v)", bytes, err)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// camera backends
+	cameraBackendLibcamera = "libcamera" // CSI cameras (with `libcamera-still`)
+	cameraBackendFswebcam  = "fswebcam"  // USB webcams (with `fswebcam`)
+	cameraBackendAgent     = "agent"     // cameras of other Pis (with `agent` subcommand)
+	cameraBackendFake      = "fake"      // test patterns (for testing without cameras)
+
+	fswebcamBin         = "/usr/bin/fswebcam"
+	defaultWebcamDevice = "/dev/video0"
+	webcamJPEGQuality   = 95
+
+	// default size of fake images
+	defaultFakeImageWidth  = 640
+	defaultFakeImageHeight = 480
+
+	// camera param for selecting a camera of libcamera
+	cameraParamCamera = "--camera"
+
+	// name of the camera when no cameras are configured
+	defaultCameraName = "main"
+)
+
+// cameraConfig is a configuration of a named camera
+type cameraConfig struct {
+	Backend      string `json:"backend,omitempty"`       // "libcamera" (default), "fswebcam", "agent", or "fake"
+	Index        int    `json:"index,omitempty"`         // for libcamera (`--camera`)
+	Device       string `json:"device,omitempty"`        // for fswebcam (default: /dev/video0)
+	URL          string `json:"url,omitempty"`           // for agent (eg. "http://192.168.0.10:8088")
+	RemoteCamera string `json:"remote_camera,omitempty"` // for agent (default camera of the agent if empty)
+
+	// (values of the top level are used if omitted; camera params only for libcamera)
+	ImageWidth   int            `json:"image_width,omitempty"`
+	ImageHeight  int            `json:"image_height,omitempty"`
+	CameraParams map[string]any `json:"camera_params,omitempty"`
+}
+
+// validate checks if the camera config has valid values
+func (c cameraConfig) validate() error {
+	switch c.Backend {
+	case "", cameraBackendLibcamera, cameraBackendFswebcam, cameraBackendFake:
+	case cameraBackendAgent:
+		if c.URL == "" {
+			return fmt.Errorf("`url` is needed for camera backend: %s", c.Backend)
+		}
+	default:
+		return fmt.Errorf("unknown camera backend: %s", c.Backend)
+	}
+	if c.Index < 0 {
+		return fmt.Errorf("camera index should not be negative: %d", c.Index)
+	}
+	if c.ImageWidth < 0 || c.ImageHeight < 0 {
+		return fmt.Errorf("image size should not be negative: %dx%d", c.ImageWidth, c.ImageHeight)
+	}
+
+	return nil
+}
+
+// camera is a named camera with its own lock,
+// for making sure that it is not used simultaneously
+type camera struct {
+	sync.Mutex
+
+	name   string
+	config cameraConfig
+}
+
+// settings returns the image size and camera params of the camera (which can be reloaded)
+func (c *camera) settings() (width, height int, params map[string]any) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+
+	return c.config.ImageWidth, c.config.ImageHeight, c.config.CameraParams
+}
+
+// newCameras returns cameras from given configs (with top-level values as defaults),
+// and their names in order (the default one comes first)
+//
+// a single camera of libcamera will be returned if there are no configs
+func newCameras(
+	configs map[string]cameraConfig,
+	defaultName string,
+	width, height int,
+	params map[string]any,
+) (cameras map[string]*camera, names []string, err error) {
+	if len(configs) <= 0 {
+		configs = map[string]cameraConfig{defaultCameraName: {}}
+		defaultName = defaultCameraName
+	}
+
+	cameras = map[string]*camera{}
+	for name, conf := range configs {
+		if name == "" || strings.ContainsAny(name, " \t\n") {
+			return nil, nil, fmt.Errorf("malformed camera name: '%s'", name)
+		}
+		if err := conf.validate(); err != nil {
+			return nil, nil, fmt.Errorf("camera '%s': %w", name, err)
+		}
+
+		if conf.Backend == "" {
+			conf.Backend = cameraBackendLibcamera
+		}
+		if conf.Device == "" {
+			conf.Device = defaultWebcamDevice
+		}
+		if (conf.ImageWidth <= 0 || conf.ImageHeight <= 0) && conf.Backend != cameraBackendAgent { // (agents use their own ones)
+			conf.ImageWidth, conf.ImageHeight = width, height
+		}
+		if conf.CameraParams == nil && conf.Backend == cameraBackendLibcamera { // (top-level params are for libcamera)
+			conf.CameraParams = params
+		}
+
+		cameras[name] = &camera{name: name, config: conf}
+		names = append(names, name)
+	}
+
+	// the default one first, and the others in alphabetical order
+	if defaultName == "" {
+		sort.Strings(names)
+		defaultName = names[0]
+	} else if _, exists := cameras[defaultName]; !exists {
+		return nil, nil, fmt.Errorf("no such camera for default: %s", defaultName)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == defaultName || names[j] == defaultName {
+			return names[i] == defaultName
+		}
+		return names[i] < names[j]
+	})
+
+	return cameras, names, nil
+}
+
+// supportsExposure returns if the camera can be controlled with exposure params (for hdr, burst, and night mode)
+func (c *camera) supportsExposure() bool {
+	return c.config.Backend == cameraBackendLibcamera
+}
+
+// captureStill captures a still image with this camera (should be called while holding its lock)
+func (c *camera) captureStill(ctx context.Context, width, height int, cameraParams map[string]any) (image []byte, err error) {
+	defer func() { health.recordCapture(c.name, err) }()
+
+	switch c.config.Backend {
+	case cameraBackendFswebcam:
+		return captureWithRetries(ctx, retry, c.name, func() ([]byte, error) {
+			return captureWebcamImage(ctx, fswebcamBin, c.config.Device, width, height, cameraParams)
+		})
+	case cameraBackendAgent:
+		if fleet == nil {
+			return nil, fmt.Errorf("`fleet` is not configured for camera '%s'", c.name)
+		}
+		return captureAgentImage(ctx, c.config.URL, fleet.Secret, c.config.RemoteCamera, width, height, cameraParams)
+	case cameraBackendFake:
+		return captureFakeImage(width, height, cameraParams)
+	default:
+		return captureWithRetries(ctx, retry, c.name, func() ([]byte, error) {
+			return captureStillImage(ctx, libCameraStillBin, width, height, c.libcameraParams(cameraParams))
+		})
+	}
+}
+
+// captureBurst captures still images in a row with this camera (should be called while holding its lock)
+func (c *camera) captureBurst(ctx context.Context, width, height int, cameraParams map[string]any, count int, interval time.Duration) (images [][]byte, err error) {
+	if !c.supportsExposure() {
+		return nil, fmt.Errorf("burst capture is not supported by camera '%s' (%s)", c.name, c.config.Backend)
+	}
+
+	defer func() { health.recordCapture(c.name, err) }()
+
+	return captureWithRetries(ctx, retry, c.name, func() ([][]byte, error) {
+		return captureBurstImages(ctx, libCameraStillBin, width, height, c.libcameraParams(cameraParams), count, interval)
+	})
+}
+
+// libcameraParams returns a copy of camera params with the index of this camera
+func (c *camera) libcameraParams(cameraParams map[string]any) map[string]any {
+	if c.config.Index <= 0 {
+		return cameraParams
+	}
+
+	params := cloneCameraParams(cameraParams)
+	params[cameraParamCamera] = c.config.Index
+
+	return params
+}
+
+// captureWebcamImage captures an image from a USB webcam with `fswebcam`
+func captureWebcamImage(
+	ctx context.Context,
+	fswebcamBinPath string,
+	device string,
+	width, height int,
+	cameraParams map[string]any,
+) (result []byte, err error) {
+	args := []string{
+		"--quiet",
+		"--device", device,
+		"--no-banner",
+		"--jpeg", strconv.Itoa(webcamJPEGQuality),
+	}
+	if width > 0 && height > 0 {
+		args = append(args, "--resolution", fmt.Sprintf("%dx%d", width, height))
+	}
+	args = append(args, cameraArgs(0, 0, cameraParams)...)
+	args = append(args, "-") // output to stdout
+
+	return runCamera(ctx, fswebcamBinPath, args, cameraTimeout(cameraParams))
+}
+
+// captureFakeImage generates a jpeg image of test pattern (brightness is adjusted with `--ev`)
+func captureFakeImage(width, height int, cameraParams map[string]any) ([]byte, error) {
+	if width <= 0 || height <= 0 {
+		width, height = defaultFakeImageWidth, defaultFakeImageHeight
+	}
+
+	ev := 0.0
+	switch v := cameraParams[cameraParamEV].(type) {
+	case float64:
+		ev = v
+	case int:
+		ev = float64(v)
+	case string:
+		ev, _ = strconv.ParseFloat(v, 64)
+	}
+	gain := math.Pow(2, ev)
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			offset := y*img.Stride + x*4
+			img.Pix[offset+0] = uint8(min(float64(x*255/width)*gain, 255))
+			img.Pix[offset+1] = uint8(min(float64(y*255/height)*gain, 255))
+			img.Pix[offset+2] = uint8(min(float64((x+y)%256)*gain, 255))
+			img.Pix[offset+3] = 0xff
+		}
+	}
+
+	return encodeJPEG(img, defaultJPEGQuality)
+}
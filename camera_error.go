@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// max length of stderr kept in camera errors
+	maxCameraStderrBytes = 4096
+)
+
+// cameraErrorKind is a kind of errors of the camera process
+type cameraErrorKind int
+
+// kinds of camera errors
+const (
+	cameraErrorUnknown         cameraErrorKind = iota
+	cameraErrorNotFound                        // no camera (or no camera command)
+	cameraErrorBusy                            // camera is used by another process
+	cameraErrorInvalidArgument                 // camera params are rejected
+	cameraErrorTimeout                         // timed out (and killed by the bot)
+	cameraErrorKilled                          // killed by a signal (eg. OOM killer)
+)
+
+// messages in the standard error of camera processes (in lower case) for each kind,
+// in the order of matching (of libcamera-still, and fswebcam)
+var cameraErrorMessages = []struct {
+	kind     cameraErrorKind
+	messages []string
+}{
+	{cameraErrorBusy, []string{
+		"device or resource busy",                    // eg. "failed to acquire camera /base/soc/...: Device or resource busy"
+		"pipeline handler in use by another process", // libcamera
+	}},
+	{cameraErrorNotFound, []string{
+		"no cameras available",  // eg. "ERROR: *** no cameras available ***"
+		"error opening device:", // fswebcam, eg. "Error opening device: /dev/video0"
+		"no such device",        // eg. "open: No such device"
+	}},
+	{cameraErrorInvalidArgument, []string{
+		"unrecognised option",              // libcamera, eg. "unrecognised option '--foo'"
+		"unrecognized option",              // fswebcam (getopt), eg. "unrecognized option '--foo'"
+		"invalid option --",                // fswebcam (getopt), eg. "invalid option -- 'z'"
+		"' is invalid",                     // libcamera, eg. "the argument ('abc') for option '--ev' is invalid"
+		"the required argument for option", // libcamera, eg. "the required argument for option '--ev' is missing"
+	}},
+}
+
+// String returns the name of the kind
+func (k cameraErrorKind) String() string {
+	switch k {
+	case cameraErrorNotFound:
+		return "not found"
+	case cameraErrorBusy:
+		return "busy"
+	case cameraErrorInvalidArgument:
+		return "invalid argument"
+	case cameraErrorTimeout:
+		return "timeout"
+	case cameraErrorKilled:
+		return "killed"
+	default:
+		return "unknown"
+	}
+}
+
+// cameraError is an error of the camera process
+type cameraError struct {
+	Kind   cameraErrorKind
+	Bin    string
+	Err    error
+	Stderr string // (trimmed)
+}
+
+// newCameraError returns a camera error of given process error and its standard error, classified
+func newCameraError(bin string, err error, stderr string, timedOut bool) *cameraError {
+	e := &cameraError{
+		Bin:    bin,
+		Err:    err,
+		Stderr: strings.TrimSpace(stderr),
+	}
+	e.Kind = e.classify(timedOut)
+
+	return e
+}
+
+// classify returns the kind of the error
+func (e *cameraError) classify(timedOut bool) cameraErrorKind {
+	if timedOut {
+		return cameraErrorTimeout
+	}
+	if errors.Is(e.Err, exec.ErrNotFound) || errors.Is(e.Err, fs.ErrNotExist) {
+		return cameraErrorNotFound
+	}
+
+	stderr := strings.ToLower(e.Stderr)
+	for _, candidate := range cameraErrorMessages {
+		for _, msg := range candidate.messages {
+			if strings.Contains(stderr, msg) {
+				return candidate.kind
+			}
+		}
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(e.Err, &exitErr) {
+		if status, ok := exitErr.Sys().(interface{ Signaled() bool }); ok && status.Signaled() {
+			return cameraErrorKilled
+		}
+	}
+
+	return cameraErrorUnknown
+}
+
+// Error returns the error message with its kind and the last line of stderr
+func (e *cameraError) Error() string {
+	var msg string
+	if e.Kind == cameraErrorTimeout {
+		msg = fmt.Sprintf("command timed out: %s", e.Bin)
+	} else {
+		msg = fmt.Sprintf("error running %s: %s [%s]", e.Bin, e.Err, e.Kind)
+	}
+	if lines := strings.Split(e.Stderr, "\n"); e.Stderr != "" {
+		msg += fmt.Sprintf(" (%s)", strings.TrimSpace(lines[len(lines)-1]))
+	}
+
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (e *cameraError) Unwrap() error {
+	return e.Err
+}
+
+// friendly returns a message of the error for users
+func (e *cameraError) friendly() string {
+	switch e.Kind {
+	case cameraErrorNotFound:
+		if errors.Is(e.Err, exec.ErrNotFound) || errors.Is(e.Err, fs.ErrNotExist) {
+			return fmt.Sprintf("camera command is not installed: %s", e.Bin)
+		}
+		return "no camera is found (check if it is connected and enabled)"
+	case cameraErrorBusy:
+		return "camera is busy (used by another process)"
+	case cameraErrorInvalidArgument:
+		return "camera rejected the parameters (check `camera_params`)"
+	case cameraErrorTimeout:
+		return "camera did not respond in time"
+	case cameraErrorKilled:
+		return "camera process was killed"
+	default:
+		return "camera process failed"
+	}
+}
+
+// retriable returns if the capture may succeed when retried (timed out, busy, or camera not detected)
+func (e *cameraError) retriable() bool {
+	switch e.Kind {
+	case cameraErrorBusy, cameraErrorTimeout:
+		return true
+	case cameraErrorNotFound: // (not retried when the camera command is not installed)
+		return !errors.Is(e.Err, exec.ErrNotFound) && !errors.Is(e.Err, fs.ErrNotExist)
+	default:
+		return false
+	}
+}
+
+// describeCaptureError logs the detail of a capture error, and returns a message of it for users
+func describeCaptureError(err error) string {
+	var camErr *cameraError
+	if errors.As(err, &camErr) {
+		if camErr.Stderr != "" {
+			logError("%s\n%s", camErr, camErr.Stderr)
+		} else {
+			logError("%s", camErr)
+		}
+		return camErr.friendly()
+	}
+
+	return err.Error()
+}
+
+// limitedBuffer is a buffer which keeps only the last `limit` bytes written
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+// Write writes bytes, discarding the oldest ones beyond the limit
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n, err := b.Buffer.Write(p)
+	if over := b.Len() - b.limit; over > 0 {
+		b.Next(over)
+	}
+
+	return n, err
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCameraScript writes a shell script standing in for libcamera-still, and returns its path
+func fakeCameraScript(t *testing.T, body string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "libcamera-still")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatalf("failed to write fake camera script: %s", err)
+	}
+
+	return path
+}
+
+func TestCameraErrorClassification(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		timeout  time.Duration
+		kind     cameraErrorKind
+		friendly string
+	}{
+		{
+			name:     "no cameras",
+			script:   `echo "ERROR: *** no cameras available ***" >&2; exit 255`,
+			kind:     cameraErrorNotFound,
+			friendly: "no camera is found (check if it is connected and enabled)",
+		},
+		{
+			name:     "webcam not found",
+			script:   `echo "Error opening device: /dev/video0" >&2; echo "open: No such file or directory" >&2; exit 1`,
+			kind:     cameraErrorNotFound,
+			friendly: "no camera is found (check if it is connected and enabled)",
+		},
+		{
+			name:     "busy",
+			script:   `echo "ERROR: *** failed to acquire camera /base/soc/i2c0mux/i2c@1/imx708@1a: Device or resource busy ***" >&2; exit 1`,
+			kind:     cameraErrorBusy,
+			friendly: "camera is busy (used by another process)",
+		},
+		{
+			name:     "unrecognised option",
+			script:   `echo "ERROR: *** unrecognised option '--bogus' ***" >&2; exit 255`,
+			kind:     cameraErrorInvalidArgument,
+			friendly: "camera rejected the parameters (check `camera_params`)",
+		},
+		{
+			name:     "invalid value",
+			script:   `echo "ERROR: *** the argument ('abc') for option '--ev' is invalid ***" >&2; exit 255`,
+			kind:     cameraErrorInvalidArgument,
+			friendly: "camera rejected the parameters (check `camera_params`)",
+		},
+		{
+			name:     "timeout",
+			script:   `sleep 5`,
+			timeout:  200 * time.Millisecond,
+			kind:     cameraErrorTimeout,
+			friendly: "camera did not respond in time",
+		},
+		{
+			name:     "killed",
+			script:   `kill -9 $$`,
+			kind:     cameraErrorKilled,
+			friendly: "camera process was killed",
+		},
+		{
+			name:     "unrelated messages",
+			script:   `echo "busybox: this value must be set, invalid checksum of tuning file" >&2; exit 3`,
+			kind:     cameraErrorUnknown,
+			friendly: "camera process failed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timeout := test.timeout
+			if timeout <= 0 {
+				timeout = 5 * time.Second
+			}
+
+			_, err := runCamera(context.Background(), fakeCameraScript(t, test.script), nil, timeout)
+			camErr, ok := err.(*cameraError)
+			if !ok {
+				t.Fatalf("expected a camera error, got: %v", err)
+			}
+			if camErr.Kind != test.kind {
+				t.Errorf("expected kind '%s', got '%s' (%s)", test.kind, camErr.Kind, camErr)
+			}
+			if friendly := describeCaptureError(err); friendly != test.friendly {
+				t.Errorf("expected message '%s', got '%s'", test.friendly, friendly)
+			}
+		})
+	}
+}
+
+func TestCameraErrorNotInstalled(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "no-such-camera-command")
+
+	_, err := runCamera(context.Background(), bin, nil, time.Second)
+	camErr, ok := err.(*cameraError)
+	if !ok {
+		t.Fatalf("expected a camera error, got: %v", err)
+	}
+	if camErr.Kind != cameraErrorNotFound {
+		t.Errorf("expected kind '%s', got '%s'", cameraErrorNotFound, camErr.Kind)
+	}
+	if friendly := camErr.friendly(); !strings.Contains(friendly, "not installed") {
+		t.Errorf("unexpected message: %s", friendly)
+	}
+	if camErr.retriable() {
+		t.Errorf("missing camera command should not be retried")
+	}
+}
+
+func TestRunCameraCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, err := runCamera(ctx, fakeCameraScript(t, `sleep 5`), nil, 5*time.Second)
+	if err == nil || ctx.Err() == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Fatalf("expected a canceled capture, got: %v", err)
+	}
+	if _, ok := err.(*cameraError); ok {
+		t.Errorf("canceled captures should not be camera errors")
+	}
+}
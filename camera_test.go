@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewCameras(t *testing.T) {
+	params := map[string]any{"--ev": 1}
+
+	// a single camera of libcamera without configs
+	cams, names, err := newCameras(nil, "", 640, 480, params)
+	if err != nil {
+		t.Fatalf("failed to create cameras: %s", err)
+	}
+	if !slices.Equal(names, []string{defaultCameraName}) {
+		t.Errorf("unexpected names: %v", names)
+	}
+	if conf := cams[defaultCameraName].config; conf.Backend != cameraBackendLibcamera || conf.ImageWidth != 640 || conf.ImageHeight != 480 || conf.CameraParams["--ev"] != 1 {
+		t.Errorf("unexpected config: %+v", conf)
+	}
+
+	// the default one first, and the others in alphabetical order
+	configs := map[string]cameraConfig{
+		"yard":   {Backend: cameraBackendFswebcam},
+		"back":   {ImageWidth: 1920, ImageHeight: 1080},
+		"garage": {Backend: cameraBackendAgent, URL: "http://192.168.0.10:8088"},
+		"front":  {},
+	}
+	for defaultName, expected := range map[string][]string{
+		"":       {"back", "front", "garage", "yard"},
+		"garage": {"garage", "back", "front", "yard"},
+		"yard":   {"yard", "back", "front", "garage"},
+	} {
+		if _, names, err := newCameras(configs, defaultName, 640, 480, params); err != nil || !slices.Equal(names, expected) {
+			t.Errorf("unexpected names with default '%s': %v (%v)", defaultName, names, err)
+		}
+	}
+
+	// top-level values are used as defaults
+	cams, _, _ = newCameras(configs, "", 640, 480, params)
+	if conf := cams["back"].config; conf.ImageWidth != 1920 || conf.ImageHeight != 1080 || conf.CameraParams["--ev"] != 1 {
+		t.Errorf("unexpected config of back: %+v", conf)
+	}
+	if conf := cams["yard"].config; conf.Device != defaultWebcamDevice || conf.CameraParams != nil || conf.ImageWidth != 640 {
+		t.Errorf("unexpected config of yard (top-level params are only for libcamera): %+v", conf)
+	}
+	if conf := cams["garage"].config; conf.ImageWidth != 0 || conf.CameraParams != nil {
+		t.Errorf("unexpected config of garage (agents use their own ones): %+v", conf)
+	}
+}
+
+func TestNewCamerasValidation(t *testing.T) {
+	for name, test := range map[string]struct {
+		configs     map[string]cameraConfig
+		defaultName string
+		expected    string
+	}{
+		"empty name":       {configs: map[string]cameraConfig{"": {}}, expected: "malformed camera name: ''"},
+		"name with spaces": {configs: map[string]cameraConfig{"front yard": {}}, expected: "malformed camera name: 'front yard'"},
+		"unknown backend":  {configs: map[string]cameraConfig{"front": {Backend: "webcam"}}, expected: "camera 'front': unknown camera backend: webcam"},
+		"agent without url": {configs: map[string]cameraConfig{"garage": {Backend: cameraBackendAgent}},
+			expected: "camera 'garage': `url` is needed for camera backend: agent"},
+		"negative index":  {configs: map[string]cameraConfig{"front": {Index: -1}}, expected: "camera 'front': camera index should not be negative: -1"},
+		"negative size":   {configs: map[string]cameraConfig{"front": {ImageWidth: -1}}, expected: "camera 'front': image size should not be negative: -1x0"},
+		"no such default": {configs: map[string]cameraConfig{"front": {}}, defaultName: "back", expected: "no such camera for default: back"},
+	} {
+		if _, _, err := newCameras(test.configs, test.defaultName, 640, 480, nil); err == nil || err.Error() != test.expected {
+			t.Errorf("expected '%s' for %s, got: %v", test.expected, name, err)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/tailscale/hujson"
+)
+
+const (
+	// subcommand for checking config
+	subcommandCheckConfig = "check-config"
+
+	// max image size (of 64MP sensors)
+	maxImageWidth  = 9152
+	maxImageHeight = 6944
+)
+
+// flags of camera params which are allowed for each backend
+// (`fake` backend simulates libcamera)
+var allowedCameraFlags = map[string][]string{
+	cameraBackendLibcamera: {
+		"-t", "--timeout", "-q", "--quality", "-n", "--nopreview", "-r", "--raw", "-x", "--exif",
+		"--brightness", "--contrast", "--saturation", "--sharpness", "--ev", "--shutter", "--gain", "--analoggain",
+		"--awb", "--awbgains", "--metering", "--exposure", "--denoise", "--hdr", "--mode", "--framerate",
+		"--hflip", "--vflip", "--rotation", "--roi", "--camera", "--tuning-file", "--flicker-period", "--immediate", "--thumb",
+		"--autofocus-mode", "--autofocus-range", "--autofocus-speed", "--autofocus-window", "--autofocus-on-capture", "--lens-position",
+	},
+	cameraBackendFswebcam: {
+		"-T", "--timeout", "-S", "--skip", "-F", "--frames", "-D", "--delay", "-p", "--palette", "-i", "--input", "-s", "--set",
+		"--tuner", "--frequency", "--fps", "--rotate", "--flip", "--crop", "--scale", "--deinterlace", "--invert", "--greyscale",
+		"--no-banner", "--top-banner", "--bottom-banner", "--banner-colour", "--line-colour", "--font", "--no-shadow", "--shadow",
+		"--title", "--no-title", "--subtitle", "--no-subtitle", "--timestamp", "--no-timestamp", "--info", "--no-info", "--gmt",
+	},
+}
+
+// flags which are set by the bot, and cannot be used in camera params
+var reservedCameraFlags = map[string][]string{
+	cameraBackendLibcamera: {"-e", "--encoding", "-o", "--output", "--width", "--height", "--timelapse"},
+	cameraBackendFswebcam:  {"-d", "--device", "-r", "--resolution", "--jpeg", "--png", "--save"},
+}
+
+// configError is an error at a position of the config source
+type configError struct {
+	Line    int
+	Column  int
+	Message string
+
+	offset int
+}
+
+// Error returns the error with its position
+func (e configError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// configErrors is a list of errors of the config source
+type configErrors []configError
+
+// Error returns the errors, one per line
+func (errs configErrors) Error() string {
+	lines := []string{}
+	for _, err := range errs {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// configChecker collects errors of the config source
+type configChecker struct {
+	source    []byte
+	positions map[string]int // offsets of keys (or elements), by their paths (eg. "cameras.front.camera_params")
+	errs      configErrors
+
+	mismatched map[string]bool // paths of values with mismatched types (not checked further)
+}
+
+// checkConfig checks the config source strictly (unknown keys, types, and values),
+// and returns `configErrors` with line numbers if there are any problems
+func checkConfig(source []byte) error {
+	ast, err := hujson.Parse(source)
+	if err != nil {
+		return err // (with its line and column)
+	}
+
+	c := &configChecker{
+		source:     source,
+		positions:  map[string]int{"": ast.StartOffset},
+		mismatched: map[string]bool{},
+	}
+
+	// unknown and duplicated keys, and types of values
+	c.walk(&ast, reflect.TypeFor[config](), "")
+
+	// (offsets are not changed by standardizing)
+	ast.Standardize()
+	var conf config
+	if err := json.Unmarshal(ast.Pack(), &conf); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &typeErr) {
+			if len(c.mismatched) <= 0 { // (not reported while walking)
+				c.errorAt(int(typeErr.Offset), "`%s` should be %s, not %s", typeErr.Field, typeErr.Type, typeErr.Value)
+			}
+
+			// values (mismatched ones are left out of the partly decoded config)
+			c.checkValues(conf)
+		} else if errors.As(err, &syntaxErr) {
+			c.errorAt(int(syntaxErr.Offset), "%s", syntaxErr)
+		} else {
+			c.errorf("", "%s", err)
+		}
+	} else {
+		// values
+		c.checkValues(conf)
+	}
+
+	if len(c.errs) > 0 {
+		sort.SliceStable(c.errs, func(i, j int) bool {
+			return c.errs[i].offset < c.errs[j].offset
+		})
+		return c.errs
+	}
+
+	return nil
+}
+
+// walk checks keys of given value against the fields of `typ` (and types of values), and records their positions
+func (c *configChecker) walk(value *hujson.Value, typ reflect.Type, path string) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Interface {
+		return // (any value)
+	}
+
+	switch v := value.Value.(type) {
+	case *hujson.Object:
+		var fields map[string]reflect.Type
+		switch typ.Kind() {
+		case reflect.Struct:
+			fields = jsonFields(typ)
+		case reflect.Map:
+		default:
+			c.checkType(value, typ, path)
+			return
+		}
+
+		seen := map[string]bool{}
+		for i := range v.Members {
+			member := &v.Members[i]
+			name := member.Name.Value.(hujson.Literal).String()
+			memberPath := joinConfigPath(path, name)
+			c.positions[memberPath] = member.Name.StartOffset
+
+			if seen[name] {
+				c.errorf(memberPath, "duplicated key: %s", name)
+				continue
+			}
+			seen[name] = true
+
+			if typ.Kind() == reflect.Map {
+				c.walk(&member.Value, typ.Elem(), memberPath)
+			} else if fieldType, exists := fields[name]; exists {
+				c.walk(&member.Value, fieldType, memberPath)
+			} else {
+				c.errorf(memberPath, "unknown key: %s", name)
+			}
+		}
+	case *hujson.Array:
+		if typ.Kind() != reflect.Slice {
+			c.checkType(value, typ, path)
+			return
+		}
+
+		for i := range v.Elements {
+			elementPath := fmt.Sprintf("%s[%d]", path, i)
+			c.positions[elementPath] = v.Elements[i].StartOffset
+			c.walk(&v.Elements[i], typ.Elem(), elementPath)
+		}
+	default:
+		c.checkType(value, typ, path)
+	}
+}
+
+// checkType checks if given value can be decoded into `typ`
+// (so every mismatched value is reported, not only the first one)
+func (c *configChecker) checkType(value *hujson.Value, typ reflect.Type, path string) {
+	v := value.Clone()
+	v.Standardize()
+	if err := json.Unmarshal(v.Pack(), reflect.New(typ).Interface()); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			c.errorf(path, "`%s` should be %s, not %s", path, typ, typeErr.Value)
+		} else {
+			c.errorf(path, "`%s`: %s", path, err)
+		}
+
+		c.mismatched[path] = true
+	}
+}
+
+// checkValues checks values of the config
+func (c *configChecker) checkValues(conf config) {
+	// image sizes
+	c.checkImageSize("", conf.ImageWidth, conf.ImageHeight)
+
+	// cameras and their params (top-level ones are for libcamera)
+	c.checkCameraParams("camera_params", conf.CameraParams, cameraBackendLibcamera)
+	for name, cam := range conf.Cameras {
+		path := joinConfigPath("cameras", name)
+		if err := cam.validate(); err != nil {
+			c.errorf(path, "camera '%s': %s", name, err)
+			continue
+		}
+		c.checkImageSize(path, cam.ImageWidth, cam.ImageHeight)
+		c.checkCameraParams(joinConfigPath(path, "camera_params"), cam.CameraParams, cmp.Or(cam.Backend, cameraBackendLibcamera))
+	}
+	if conf.NightMode != nil {
+		c.checkCameraParams("night_mode.camera_params", conf.NightMode.CameraParams, cameraBackendLibcamera)
+	}
+
+	// sections with their own validations
+	type validator interface{ validate() error }
+	sections := map[string]validator{}
+	if conf.Fleet != nil {
+		sections["fleet"] = conf.Fleet
+	}
+	if conf.Mount != nil {
+		sections["mount"] = conf.Mount
+	}
+	for i, trigger := range conf.Triggers {
+		sections[fmt.Sprintf("triggers[%d]", i)] = trigger
+	}
+	for i, light := range conf.Lights {
+		sections[fmt.Sprintf("lights[%d]", i)] = light
+	}
+	if conf.Notifications != nil {
+		sections["notifications"] = conf.Notifications
+	}
+	if conf.Health != nil {
+		sections["health"] = conf.Health
+	}
+	if conf.Retry != nil {
+		sections["retry"] = conf.Retry
+	}
+	if conf.Shutdown != nil {
+		sections["shutdown"] = conf.Shutdown
+	}
+	for name, steps := range conf.ProcessingPresets {
+		for i, step := range steps {
+			sections[fmt.Sprintf("%s[%d]", joinConfigPath("processing_presets", name), i)] = step
+		}
+	}
+	if conf.Overlay != nil {
+		sections["overlay"] = conf.Overlay
+	}
+	if conf.Exif != nil {
+		sections["exif"] = conf.Exif
+	}
+	if conf.HDR != nil {
+		sections["hdr"] = conf.HDR
+	}
+	if conf.NightMode != nil {
+		sections["night_mode"] = conf.NightMode
+	}
+	for path, section := range sections {
+		if err := section.validate(); err != nil {
+			c.errorf(path, "%s", err)
+		}
+	}
+
+	// infisical (for reading `api_token`)
+	if conf.Infisical != nil {
+		missing := []string{}
+		for _, field := range []struct{ key, value string }{
+			{"client_id", conf.Infisical.ClientID},
+			{"client_secret", conf.Infisical.ClientSecret},
+			{"project_id", conf.Infisical.ProjectID},
+			{"environment", conf.Infisical.Environment},
+			{"secret_type", conf.Infisical.SecretType},
+			{"api_token_key_path", conf.Infisical.APITokenKeyPath},
+		} {
+			if field.value == "" {
+				missing = append(missing, field.key)
+			}
+		}
+		if len(missing) > 0 {
+			c.errorf("infisical", "missing values of infisical: %s", strings.Join(missing, ", "))
+		}
+	}
+}
+
+// checkImageSize checks the image size (0 for defaults) in `path`
+func (c *configChecker) checkImageSize(path string, width, height int) {
+	if width != 0 && (width < minImageWidth || width > maxImageWidth) {
+		c.errorf(joinConfigPath(path, "image_width"), "image width should be in %d ~ %d: %d", minImageWidth, maxImageWidth, width)
+	}
+	if height != 0 && (height < minImageHeight || height > maxImageHeight) {
+		c.errorf(joinConfigPath(path, "image_height"), "image height should be in %d ~ %d: %d", minImageHeight, maxImageHeight, height)
+	}
+}
+
+// checkCameraParams checks flags of camera params in `path` for given camera backend
+func (c *configChecker) checkCameraParams(path string, params map[string]any, backend string) {
+	for flag := range params {
+		if err := checkCameraFlag(flag, backend); err != nil {
+			c.errorf(joinConfigPath(path, flag), "%s", err)
+		}
+	}
+}
+
+// checkCameraFlag returns an error if given flag cannot be used in camera params for given camera backend
+func checkCameraFlag(flag, backend string) error {
+	backend = cmp.Or(backend, cameraBackendLibcamera)
+	if backend == cameraBackendAgent || backend == cameraBackendFake { // (agents capture with libcamera)
+		backend = cameraBackendLibcamera
+	}
+
+	if slices.Contains(reservedCameraFlags[backend], flag) {
+		return fmt.Errorf("camera flag `%s` is set by the bot, and cannot be used", flag)
+	} else if !slices.Contains(allowedCameraFlags[backend], flag) {
+		return fmt.Errorf("unknown camera flag for %s: %s", backend, flag)
+	}
+
+	return nil
+}
+
+// errorf adds an error at the position of `path` (or its nearest parent)
+// (errors of values in mismatched ones are not added, as they were decoded partly)
+func (c *configChecker) errorf(path string, format string, a ...any) {
+	for p := path; p != ""; p = parentConfigPath(p) {
+		if c.mismatched[p] {
+			return
+		}
+	}
+
+	for {
+		if offset, exists := c.positions[path]; exists {
+			c.errorAt(offset, format, a...)
+			return
+		}
+		path = parentConfigPath(path)
+	}
+}
+
+// errorAt adds an error at given offset of the source
+func (c *configChecker) errorAt(offset int, format string, a ...any) {
+	offset = min(max(offset, 0), len(c.source))
+	before := c.source[:offset]
+
+	c.errs = append(c.errs, configError{
+		Line:    bytes.Count(before, []byte("\n")) + 1,
+		Column:  offset - bytes.LastIndexByte(before, '\n'),
+		Message: fmt.Sprintf(format, a...),
+		offset:  offset,
+	})
+}
+
+// jsonFields returns the types of fields of a struct type, by their json names
+func jsonFields(typ reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+
+	return fields
+}
+
+// joinConfigPath returns the path of a key in `path`
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// parentConfigPath returns the parent of given path ("" for top-level keys)
+func parentConfigPath(path string) string {
+	if i := strings.LastIndexAny(path, ".["); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// runCheckConfig checks the config file with given command line arguments,
+// and prints its errors
+func runCheckConfig(args []string) (err error) {
+	flags := flag.NewFlagSet(subcommandCheckConfig, flag.ContinueOnError)
+	file := flags.String("config", "", "path of the config file to check (default: "+configFilename+" next to the executable)")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+
+	path := *file
+	if path == "" {
+		if path, err = resolvePath(configFilename); err != nil {
+			return err
+		}
+	}
+
+	var source []byte
+	if source, err = os.ReadFile(path); err != nil {
+		return err
+	}
+
+	if err = checkConfig(source); err != nil {
+		var errs configErrors
+		if errors.As(err, &errs) {
+			for _, e := range errs {
+				fmt.Printf("%s:%d:%d: %s\n", path, e.Line, e.Column, e.Message)
+			}
+			return fmt.Errorf("%d problem(s) in %s", len(errs), path)
+		}
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	fmt.Printf("%s: OK\n", path)
+
+	return nil
+}
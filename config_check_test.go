@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// problemsOf returns "line:column: message" of each error in the result of `checkConfig`
+func problemsOf(t *testing.T, err error) (problems []string) {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+	var errs configErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected config errors, got: %v", err)
+	}
+	for _, e := range errs {
+		problems = append(problems, fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message))
+	}
+
+	return problems
+}
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		problems   []string
+		parseError bool // (not a config error, but an error of hujson with its own position)
+	}{
+		{
+			name: "valid",
+			source: `{
+  // comments and trailing commas are allowed
+  "api_token": "token",
+  "available_ids": ["alice"],
+  "cameras": {"front": {"camera_params": {"--ev": 1}},},
+}`,
+		},
+		{
+			name: "unknown and duplicated keys",
+			source: `{
+  "api_token": "token",
+  "image_widht": 640,
+  "cameras": {
+    "front": {"backend": "libcamera", "lens": 1}
+  },
+  "api_token": "again"
+}`,
+			problems: []string{
+				"3:3: unknown key: image_widht",
+				"5:39: unknown key: lens",
+				"7:3: duplicated key: api_token",
+			},
+		},
+		{
+			name: "all type errors, with value errors",
+			source: `{
+  "image_width": "wide",
+  "image_height": 99999,
+  "monitor_interval": 1.5,
+  "cameras": {
+    "back": {"backend": "fswebcam", "image_width": true}
+  },
+  "triggers": [{"name": "door", "line": "x"}],
+  "retry": {"attempts": -1}
+}`,
+			problems: []string{
+				"2:3: `image_width` should be int, not string",
+				"3:3: image height should be in 300 ~ 6944: 99999",
+				"4:3: `monitor_interval` should be int, not number 1.5",
+				"6:37: `cameras.back.image_width` should be int, not bool",
+				"8:33: `triggers[0].line` should be int, not string",
+				"9:3: values of retry should not be negative",
+			},
+		},
+		{
+			name: "mismatched containers",
+			source: `{
+  "available_ids": "alice",
+  "cameras": ["front"],
+  "mount": 1
+}`,
+			problems: []string{
+				"2:3: `available_ids` should be []string, not string",
+				"3:3: `cameras` should be map[string]main.cameraConfig, not array",
+				"4:3: `mount` should be main.mountConfig, not number",
+			},
+		},
+		{
+			name: "camera flags per backend",
+			source: `{
+  "camera_params": {"--ev": 1, "--output": "x"},
+  "cameras": {
+    "usb": {"backend": "fswebcam", "camera_params": {"--ev": 1, "--skip": 5, "--save": "x"}},
+    "remote": {"backend": "agent", "url": "http://pi:8080", "camera_params": {"--roi": "0,0,1,1", "--frames": 3}},
+    "test": {"backend": "fake", "camera_params": {"--shutter": 1000}}
+  },
+  "night_mode": {"camera_params": {"--width": 640}}
+}`,
+			problems: []string{
+				"2:32: camera flag `--output` is set by the bot, and cannot be used",
+				"4:54: unknown camera flag for fswebcam: --ev",
+				"4:78: camera flag `--save` is set by the bot, and cannot be used",
+				"5:99: unknown camera flag for libcamera: --frames",
+				"8:36: camera flag `--width` is set by the bot, and cannot be used",
+			},
+		},
+		{
+			name:       "syntax error",
+			source:     "{\n  \"api_token\": \"token\",\n  \"image_width\" 640\n}",
+			parseError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkConfig([]byte(test.source))
+			if test.parseError {
+				if err == nil || errors.As(err, new(configErrors)) {
+					t.Fatalf("expected a parse error, got: %v", err)
+				}
+				return
+			}
+
+			if problems := problemsOf(t, err); !slices.Equal(problems, test.problems) {
+				t.Errorf("expected problems:\n%q\ngot:\n%q", test.problems, problems)
+			}
+		})
+	}
+}
+
+func TestCheckCameraFlag(t *testing.T) {
+	tests := []struct {
+		flag    string
+		backend string
+		err     string
+	}{
+		{"--ev", "", ""},
+		{"--ev", cameraBackendLibcamera, ""},
+		{"--ev", cameraBackendAgent, ""},
+		{"--ev", cameraBackendFake, ""},
+		{"--ev", cameraBackendFswebcam, "unknown camera flag for fswebcam: --ev"},
+		{"--skip", cameraBackendFswebcam, ""},
+		{"--skip", cameraBackendLibcamera, "unknown camera flag for libcamera: --skip"},
+		{"-o", cameraBackendLibcamera, "camera flag `-o` is set by the bot, and cannot be used"},
+		{"--resolution", cameraBackendFswebcam, "camera flag `--resolution` is set by the bot, and cannot be used"},
+	}
+
+	for _, test := range tests {
+		err := checkCameraFlag(test.flag, test.backend)
+		if test.err == "" && err != nil {
+			t.Errorf("expected `%s` to be allowed for '%s', got: %s", test.flag, test.backend, err)
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("expected '%s' for `%s` of '%s', got: %v", test.err, test.flag, test.backend, err)
+		}
+	}
+}
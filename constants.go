@@ -9,17 +9,78 @@ const (
 	minImageHeight = 300
 
 	// commands
-	commandStart   = "/start"
-	commandCapture = "/capture"
-	commandHelp    = "/help"
-	commandStatus  = "/status"
-	commandCancel  = "/cancel"
-	commandPrivacy = "/privacy"
+	commandStart       = "/start"
+	commandCapture     = "/capture"
+	commandCaptureAll  = "/captureall"
+	commandBurst       = "/burst"
+	commandHDR         = "/hdr"
+	commandPan         = "/pan"
+	commandTilt        = "/tilt"
+	commandPosition    = "/position"
+	commandLight       = "/light"
+	commandHelp        = "/help"
+	commandStatus      = "/status"
+	commandCancel      = "/cancel"
+	commandPrivacy     = "/privacy"
+	commandDelete      = "/delete"
+	commandPurge       = "/purge"
+	commandSubscribe   = "/subscribe"
+	commandUnsubscribe = "/unsubscribe"
+	commandQuiet       = "/quiet"
+	commandReload      = "/reload"
+
+	// arguments of commands
+	captureArgDocument = "document"
+	captureArgFrames   = "frames"
+	quietArgOff        = "off"
+
+	// format of captions (captured time)
+	captionTimeFormat = "2006-01-02 (Mon) 15:04:05"
 
 	// messages
-	messageDefault        = "Input your command:"
-	messageUnknownCommand = "Unknown command."
-	messageCanceled       = "Canceled."
+	messageDefault         = "Input your command:"
+	messageUnknownCommand  = "Unknown command."
+	messageCanceled        = "Canceled."
+	messageNothingToCancel = "Nothing to cancel."
+	messageNightModeUsed   = "night mode used"
+	messageNoMount         = "No pan/tilt mount is available."
+	messageNoLights        = "No lights are available."
+	messageUsageSubscribe  = "Usage: /subscribe motion|timelapse|health"
+	messageUsageQuiet      = "Usage: /quiet 22:00-07:00, or /quiet off"
+	messageNoQuietHours    = "No quiet hours."
+	messageUsageLight      = "Usage: /light on|off [name]"
+	messageGoingOffline    = "Going offline."
+	messageNotAdminChat    = "Only admin chats can do this."
+	messageReloading       = "Reloading config..."
+	messageReloaded        = "Reloaded config."
+	messageReloadFailed    = "Failed to reload config"
+
+	// messages for inline keyboards of photos
+	messageRetake            = "Retake"
+	messageRetakeBrighter    = "Retake brighter"
+	messageZoomCenter        = "Zoom center"
+	messageGetOriginal       = "Get original"
+	messageFavorite          = "☆ Favorite"
+	messageUnfavorite        = "★ Favorite"
+	messageDelete            = "Delete"
+	messageRetaking          = "Retaking..."
+	messageMoving            = "Moving..."
+	messagePanLeft           = "◀"
+	messagePanRight          = "▶"
+	messageTiltUp            = "▲"
+	messageTiltDown          = "▼"
+	messageSendingOriginal   = "Sending the original image..."
+	messageCapturingOriginal = "No archived original, capturing a full-resolution image..."
+	messageFavorited         = "Marked as favorite."
+	messageUnfavorited       = "Unmarked as favorite."
+	messageDeleted           = "Deleted."
+
+	// messages for deleting photos
+	messageUsageDelete      = "Reply to a photo, or give its ids: /delete 123 124"
+	messageUsagePurge       = "Usage: /purge --older-than 30d"
+	messageMalformedPhotoID = "Malformed photo id"
+	messageNoSuchPhoto      = "No such photo"
+	messageNothingToPurge   = "Nothing to purge."
 
 	// default maintenance message
 	defaultMaintenanceMessage = "Service is in maintenance now."
@@ -2,9 +2,8 @@ package main
 
 import (
 	"database/sql"
-	"log"
-	"os"
-	"path/filepath"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -12,116 +11,397 @@ import (
 )
 
 const (
-	// constants for local database
-	DbFilename = "db.sqlite"
+	// format of datetime values in sqlite3
+	sqliteDatetimeFormat = "2006-01-02 15:04:05"
+
+	// statement for inserting a photo (with values of `photoValues`)
+	insertPhotoQuery = `insert into photos(user_name, file_id, caption, time, archive_path, is_document, is_favorite, chat_id, message_id, camera) values(?, ?, ?, ?, nullif(?, ''), ?, ?, nullif(?, 0), nullif(?, 0), nullif(?, ''))`
+
+	// columns for selecting photos (scanned by `queryPhotos`)
+	photoColumns = `id, user_name, file_id, coalesce(caption, ''), datetime(time, 'localtime'), coalesce(archive_path, ''), is_document, is_favorite, coalesce(chat_id, 0), coalesce(message_id, 0), coalesce(camera, '')`
 )
 
+// Database is a `Store` backed by a local sqlite3 database
 type Database struct {
 	db *sql.DB
 	sync.RWMutex
 }
 
-type Photo struct {
-	UserName string
-	FileId   string
-	Caption  string
-	Time     time.Time
-}
-
-var _db *Database = nil
-
-func openDB() *Database {
-	if _db == nil {
-		if execFilepath, err := os.Executable(); err != nil {
-			panic(err)
-		} else {
-			if db, err := sql.Open("sqlite3", filepath.Join(filepath.Dir(execFilepath), DbFilename)); err != nil {
-				panic("Failed to open database: " + err.Error())
-			} else {
-				_db = &Database{
-					db: db,
-				}
-
-				// photos table
-				if _, err := db.Exec(`create table if not exists photos(
-					id integer primary key autoincrement,
-					user_name text not null,
-					file_id text not null,
-					caption text default null,
-					time datetime default current_timestamp
-				)`); err != nil {
-					panic("Failed to create photos table: " + err.Error())
-				}
-				if _, err := db.Exec(`create index if not exists idx_photos on photos(
-					user_name,
-					time
-				)`); err != nil {
-					panic("Failed to create photos table: " + err.Error())
-				}
-			}
-		}
+// openDB opens (or creates) a sqlite3 database at given path and applies pending migrations
+func openDB(dbPath string) (*Database, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %s", err)
+	}
+
+	// apply schema migrations
+	if err := migrateDB(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %s", err)
 	}
 
-	return _db
+	return &Database{
+		db: db,
+	}, nil
+}
+
+// close closes the database
+func (d *Database) close() error {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.db.Close()
 }
 
-func closeDB() {
-	if _db != nil {
-		_ = _db.db.Close()
-		_db = nil
+// savePhoto saves a photo
+func (d *Database) savePhoto(photo Photo) (id int64, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	stmt, err := d.db.Prepare(insertPhotoQuery)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare a statement: %s", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	result, err := stmt.Exec(photoValues(photo)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save photo into local database: %s", err)
 	}
+
+	return result.LastInsertId()
 }
 
-func (d *Database) savePhoto(userName, fileId, caption string) {
+// savePhotos saves photos in a transaction
+func (d *Database) savePhotos(photos []Photo) (err error) {
 	d.Lock()
+	defer d.Unlock()
 
-	if stmt, err := d.db.Prepare(`insert into photos(user_name, file_id, caption) values(?, ?, ?)`); err != nil {
-		log.Printf("* Failed to prepare a statement: %s\n", err.Error())
-	} else {
-		defer func() { _ = stmt.Close() }()
-		if _, err = stmt.Exec(userName, fileId, caption); err != nil {
-			log.Printf("* Failed to save photo into local database: %s\n", err.Error())
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin a transaction: %s", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
 		}
+	}()
+
+	stmt, err := tx.Prepare(insertPhotoQuery)
+	if err != nil {
+		return fmt.Errorf("failed to prepare a statement: %s", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, photo := range photos {
+		if _, err = stmt.Exec(photoValues(photo)...); err != nil {
+			return fmt.Errorf("failed to save photo into local database: %s", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// photoValues returns values of a photo for `insertPhotoQuery` (current time will be used if `photo.Time` is zero)
+func photoValues(photo Photo) []any {
+	if photo.Time.IsZero() {
+		photo.Time = time.Now()
+	}
+
+	return []any{
+		photo.UserName,
+		photo.FileID,
+		photo.Caption,
+		photo.Time.UTC().Format(sqliteDatetimeFormat),
+		photo.ArchivePath,
+		photo.IsDocument,
+		photo.IsFavorite,
+		photo.ChatID,
+		photo.MessageID,
+		photo.Camera,
+	}
+}
+
+// updateSentPhoto updates the file id, chat id, and message id of a saved photo
+func (d *Database) updateSentPhoto(photo Photo) error {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.execAffectingOne(
+		`update photos set file_id = ?, is_document = ?, chat_id = nullif(?, 0), message_id = nullif(?, 0) where id = ?`,
+		photo.FileID,
+		photo.IsDocument,
+		photo.ChatID,
+		photo.MessageID,
+		photo.ID,
+	)
+}
+
+// setFavorite marks (or unmarks) a saved photo as favorite
+func (d *Database) setFavorite(id int64, favorite bool) error {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.execAffectingOne(`update photos set is_favorite = ? where id = ?`, favorite, id)
+}
+
+// deletePhoto deletes a saved photo
+func (d *Database) deletePhoto(id int64) error {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.execAffectingOne(`delete from photos where id = ?`, id)
+}
+
+// execAffectingOne executes given statement which should affect exactly one row
+func (d *Database) execAffectingOne(query string, args ...any) error {
+	result, err := d.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute a statement: %s", err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected <= 0 {
+		return errPhotoNotFound
+	}
+
+	return nil
+}
+
+// getPhoto returns a photo with given id
+func (d *Database) getPhoto(id int64) (Photo, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	photos, err := d.queryPhotos(`select `+photoColumns+` from photos where id = ?`, id)
+	if err != nil {
+		return Photo{}, err
+	}
+	if len(photos) <= 0 {
+		return Photo{}, errPhotoNotFound
 	}
 
-	d.Unlock()
+	return photos[0], nil
 }
 
-func (d *Database) getPhotos(userName string, latestN int) []Photo {
+// getPhotoByMessage returns a photo sent with given chat id and message id
+func (d *Database) getPhotoByMessage(chatID, messageID int64) (Photo, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	photos, err := d.queryPhotos(`select `+photoColumns+` from photos where chat_id = ? and message_id = ?`, chatID, messageID)
+	if err != nil {
+		return Photo{}, err
+	}
+	if len(photos) <= 0 {
+		return Photo{}, errPhotoNotFound
+	}
+
+	return photos[0], nil
+}
+
+// getPhotos returns latest `latestN` photos of given user
+func (d *Database) getPhotos(userName string, latestN int) ([]Photo, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.queryPhotos(`select `+photoColumns+` from photos where user_name = ? and file_id != '' order by id desc limit ?`, userName, latestN)
+}
+
+// getPhotosSince returns all photos taken at or after `since`
+func (d *Database) getPhotosSince(since time.Time) ([]Photo, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.queryPhotos(`select `+photoColumns+` from photos where time >= ? and file_id != '' order by time asc, id asc`, since.UTC().Format(sqliteDatetimeFormat))
+}
+
+// getPhotosBefore returns all photos taken before `before`
+func (d *Database) getPhotosBefore(before time.Time) ([]Photo, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.queryPhotos(`select `+photoColumns+` from photos where time < ? and file_id != '' order by time asc, id asc`, before.UTC().Format(sqliteDatetimeFormat))
+}
+
+// queryPhotos runs given query and scans its result rows into photos
+func (d *Database) queryPhotos(query string, args ...any) ([]Photo, error) {
+	stmt, err := d.db.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare a statement: %s", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select photos from local database: %s", err)
+	}
+	defer func() { _ = rows.Close() }()
+
 	photos := []Photo{}
 
+	var id, chatID, messageID int64
+	var userName, fileID, caption, datetime, archivePath, camera string
+	var isDocument, isFavorite bool
+	for rows.Next() {
+		if err := rows.Scan(&id, &userName, &fileID, &caption, &datetime, &archivePath, &isDocument, &isFavorite, &chatID, &messageID, &camera); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+
+		tm, _ := time.ParseInLocation(sqliteDatetimeFormat, datetime, time.Local)
+
+		photos = append(photos, Photo{
+			ID:          id,
+			UserName:    userName,
+			FileID:      fileID,
+			Caption:     caption,
+			Time:        tm,
+			ArchivePath: archivePath,
+			IsDocument:  isDocument,
+			IsFavorite:  isFavorite,
+			ChatID:      chatID,
+			MessageID:   messageID,
+			Camera:      camera,
+		})
+	}
+
+	return photos, rows.Err()
+}
+
+// hasArchivePath returns if any saved photo has given archive path
+func (d *Database) hasArchivePath(archivePath string) (exists bool, err error) {
 	d.RLock()
+	defer d.RUnlock()
 
-	if stmt, err := d.db.Prepare(`select user_name, file_id, caption, datetime(time, 'localtime') as time from photos where user_name = ? order by id desc limit ?`); err != nil {
-		log.Printf("* Failed to prepare a statement: %s\n", err.Error())
-	} else {
-		defer func() { _ = stmt.Close() }()
-
-		if rows, err := stmt.Query(userName, latestN); err != nil {
-			log.Printf("* Failed to select photos from local database: %s\n", err.Error())
-		} else {
-			defer func() { _ = rows.Close() }()
-
-			var userName, fileId, caption, datetime string
-			var tm time.Time
-			for rows.Next() {
-				if err := rows.Scan(&userName, &fileId, &caption, &datetime); err == nil {
-					tm, _ = time.Parse("2006-01-02 15:04:05", datetime)
-
-					photos = append(photos, Photo{
-						UserName: userName,
-						FileId:   fileId,
-						Caption:  caption,
-						Time:     tm,
-					})
-				} else {
-					log.Printf("* Failed to scan row: %s", err.Error())
-				}
-			}
+	if err = d.db.QueryRow(`select exists(select 1 from photos where archive_path = ?)`, archivePath).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to select photos from local database: %s", err)
+	}
+
+	return exists, nil
+}
+
+// subscribe saves a subscription (replacing the existing one of the same chat and topic)
+func (d *Database) subscribe(subscription Subscription) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if subscription.Time.IsZero() {
+		subscription.Time = time.Now()
+	}
+
+	if _, err := d.db.Exec(
+		`insert or replace into subscriptions(chat_id, topic, user_name, time) values(?, ?, ?, ?)`,
+		subscription.ChatID,
+		subscription.Topic,
+		subscription.UserName,
+		subscription.Time.UTC().Format(sqliteDatetimeFormat),
+	); err != nil {
+		return fmt.Errorf("failed to save subscription into local database: %s", err)
+	}
+
+	return nil
+}
+
+// unsubscribe deletes a subscription of a chat
+func (d *Database) unsubscribe(chatID int64, topic string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	result, err := d.db.Exec(`delete from subscriptions where chat_id = ? and topic = ?`, chatID, topic)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription from local database: %s", err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected <= 0 {
+		return errSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// getSubscriptions returns subscriptions of a chat
+func (d *Database) getSubscriptions(chatID int64) ([]Subscription, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	rows, err := d.db.Query(`select chat_id, topic, user_name, datetime(time, 'localtime') from subscriptions where chat_id = ? order by topic asc`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select subscriptions from local database: %s", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	subscriptions := []Subscription{}
+
+	var subscription Subscription
+	var datetime string
+	for rows.Next() {
+		if err := rows.Scan(&subscription.ChatID, &subscription.Topic, &subscription.UserName, &datetime); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %s", err)
+		}
+		subscription.Time, _ = time.ParseInLocation(sqliteDatetimeFormat, datetime, time.Local)
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+// getSubscribers returns ids of chats which subscribed given topic
+func (d *Database) getSubscribers(topic string) ([]int64, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	rows, err := d.db.Query(`select chat_id from subscriptions where topic = ? order by chat_id asc`, topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select subscribers from local database: %s", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	chatIDs := []int64{}
+
+	var chatID int64
+	for rows.Next() {
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %s", err)
 		}
+		chatIDs = append(chatIDs, chatID)
+	}
+
+	return chatIDs, rows.Err()
+}
+
+// setQuietHours sets (or clears with nil) quiet hours of a chat
+func (d *Database) setQuietHours(chatID int64, hours *quietHours) (err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	if hours == nil {
+		_, err = d.db.Exec(`delete from quiet_hours where chat_id = ?`, chatID)
+	} else {
+		_, err = d.db.Exec(`insert or replace into quiet_hours(chat_id, start_minute, end_minute) values(?, ?, ?)`, chatID, hours.Start, hours.End)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save quiet hours into local database: %s", err)
 	}
 
-	d.RUnlock()
+	return nil
+}
+
+// getQuietHours returns quiet hours of a chat
+func (d *Database) getQuietHours(chatID int64) (*quietHours, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	var hours quietHours
+	if err := d.db.QueryRow(`select start_minute, end_minute from quiet_hours where chat_id = ?`, chatID).Scan(&hours.Start, &hours.End); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to select quiet hours from local database: %s", err)
+	}
 
-	return photos
+	return &hours, nil
 }
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/jpeg"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// exif tags (IFD0)
+	exifTagImageDescription = 0x010e
+	exifTagSoftware         = 0x0131
+	exifTagDateTime         = 0x0132
+	exifTagExifIFDPointer   = 0x8769
+	exifTagGPSIFDPointer    = 0x8825
+
+	// exif tags (Exif IFD)
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagDateTimeDigitized  = 0x9004
+	exifTagOffsetTimeOriginal = 0x9011
+	exifTagMakerNote          = 0x927c
+	exifTagUserComment        = 0x9286
+	exifTagPixelXDimension    = 0xa002
+	exifTagPixelYDimension    = 0xa003
+	exifTagInteropIFDPointer  = 0xa005
+
+	// exif tags (GPS IFD)
+	exifTagGPSVersionID    = 0x0000
+	exifTagGPSLatitudeRef  = 0x0001
+	exifTagGPSLatitude     = 0x0002
+	exifTagGPSLongitudeRef = 0x0003
+	exifTagGPSLongitude    = 0x0004
+	exifTagGPSAltitudeRef  = 0x0005
+	exifTagGPSAltitude     = 0x0006
+
+	// exif value types
+	exifTypeByte      = 1
+	exifTypeASCII     = 2
+	exifTypeShort     = 3
+	exifTypeLong      = 4
+	exifTypeRational  = 5
+	exifTypeUndefined = 7
+	exifTypeSLong     = 9
+	exifTypeSRational = 10
+
+	// format of exif datetime values
+	exifDatetimeFormat = "2006:01:02 15:04:05"
+
+	// value of `Software` tag
+	exifSoftware = "telegram-rpi-camera-bot"
+
+	// jpeg markers
+	jpegMarkerSOI  = 0xd8
+	jpegMarkerSOS  = 0xda
+	jpegMarkerAPP0 = 0xe0
+	jpegMarkerAPP1 = 0xe1
+)
+
+// header of exif APP1 segments
+var exifHeader = []byte("Exif\x00\x00")
+
+// sizes of exif value types
+var exifTypeSizes = map[uint16]int{
+	exifTypeByte:      1,
+	exifTypeASCII:     1,
+	exifTypeShort:     2,
+	exifTypeLong:      4,
+	exifTypeRational:  8,
+	exifTypeUndefined: 1,
+	exifTypeSLong:     4,
+	exifTypeSRational: 8,
+}
+
+// exifConfig is a configuration for exif metadata injected into captured images
+type exifConfig struct {
+	DeviceLabel  string   `json:"device_label,omitempty"`
+	Latitude     *float64 `json:"latitude,omitempty"`
+	Longitude    *float64 `json:"longitude,omitempty"`
+	Altitude     *float64 `json:"altitude,omitempty"` // in meters
+	CameraParams bool     `json:"camera_params"`      // record camera params in `UserComment`
+}
+
+// validate checks if the exif config has valid values
+func (c exifConfig) validate() error {
+	if (c.Latitude == nil) != (c.Longitude == nil) {
+		return fmt.Errorf("both latitude and longitude should be given for exif")
+	}
+	if c.Latitude != nil && (*c.Latitude < -90 || *c.Latitude > 90) {
+		return fmt.Errorf("latitude should be within -90 ~ 90: %g", *c.Latitude)
+	}
+	if c.Longitude != nil && (*c.Longitude < -180 || *c.Longitude > 180) {
+		return fmt.Errorf("longitude should be within -180 ~ 180: %g", *c.Longitude)
+	}
+
+	return nil
+}
+
+// exif IFDs
+type exifIFD int
+
+const (
+	ifd0 exifIFD = iota
+	ifdExif
+	ifdGPS
+	numIFDs
+)
+
+// exifEntry is an entry of an exif IFD
+type exifEntry struct {
+	Type  uint16
+	Count uint32
+	Value []byte // in the byte order of the exif data
+}
+
+// exifData is parsed exif data
+//
+// only IFD0, Exif IFD, and GPS IFD are kept: the thumbnail (IFD1) and the interoperability IFD are dropped,
+// and so is the maker note, as it may contain offsets which would be stale after relocating its value
+type exifData struct {
+	order binary.ByteOrder
+	ifds  [numIFDs]map[uint16]exifEntry
+}
+
+// newExifData returns a new, empty exif data
+func newExifData(order binary.ByteOrder) *exifData {
+	d := &exifData{order: order}
+	for i := range d.ifds {
+		d.ifds[i] = map[uint16]exifEntry{}
+	}
+
+	return d
+}
+
+// parseExif parses exif data (TIFF structure, without the `Exif\0\0` header)
+func parseExif(payload []byte) (*exifData, error) {
+	if len(payload) < 8 {
+		return nil, fmt.Errorf("exif data too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(payload[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("unknown byte order of exif data")
+	}
+	if order.Uint16(payload[2:4]) != 42 {
+		return nil, fmt.Errorf("malformed TIFF header of exif data")
+	}
+
+	d := newExifData(order)
+	if err := d.readIFD(payload, order.Uint32(payload[4:8]), ifd0); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// readIFD reads entries of an IFD at given offset (and its sub IFDs)
+func (d *exifData) readIFD(payload []byte, offset uint32, ifd exifIFD) error {
+	if int(offset)+2 > len(payload) {
+		return fmt.Errorf("exif IFD offset out of range: %d", offset)
+	}
+	num := int(d.order.Uint16(payload[offset:]))
+	if int(offset)+2+num*12 > len(payload) {
+		return fmt.Errorf("exif IFD entries out of range")
+	}
+
+	for i := range num {
+		entry := payload[int(offset)+2+i*12:]
+		tag := d.order.Uint16(entry[0:2])
+		typ := d.order.Uint16(entry[2:4])
+		count := d.order.Uint32(entry[4:8])
+
+		// sub IFDs
+		if ifd == ifd0 && (tag == exifTagExifIFDPointer || tag == exifTagGPSIFDPointer) {
+			sub := ifdExif
+			if tag == exifTagGPSIFDPointer {
+				sub = ifdGPS
+			}
+			if err := d.readIFD(payload, d.order.Uint32(entry[8:12]), sub); err != nil {
+				return err
+			}
+			continue
+		}
+		if tag == exifTagInteropIFDPointer || tag == exifTagMakerNote {
+			continue // interoperability IFD and maker note are not kept
+		}
+
+		typeSize, known := exifTypeSizes[typ]
+		if !known {
+			continue
+		}
+		size := uint64(typeSize) * uint64(count)
+
+		var value []byte
+		if size <= 4 {
+			value = entry[8 : 8+size]
+		} else {
+			valueOffset := uint64(d.order.Uint32(entry[8:12]))
+			if valueOffset+size > uint64(len(payload)) {
+				return fmt.Errorf("exif value of tag 0x%04x out of range", tag)
+			}
+			value = payload[valueOffset : valueOffset+size]
+		}
+
+		d.ifds[ifd][tag] = exifEntry{
+			Type:  typ,
+			Count: count,
+			Value: bytes.Clone(value),
+		}
+	}
+
+	return nil
+}
+
+// setASCII sets an ASCII value
+func (d *exifData) setASCII(ifd exifIFD, tag uint16, value string) {
+	b := append([]byte(value), 0)
+	d.ifds[ifd][tag] = exifEntry{Type: exifTypeASCII, Count: uint32(len(b)), Value: b}
+}
+
+// setBytes sets a BYTE or UNDEFINED value
+func (d *exifData) setBytes(ifd exifIFD, tag uint16, typ uint16, value []byte) {
+	d.ifds[ifd][tag] = exifEntry{Type: typ, Count: uint32(len(value)), Value: value}
+}
+
+// setLong sets a LONG value
+func (d *exifData) setLong(ifd exifIFD, tag uint16, value uint32) {
+	d.ifds[ifd][tag] = exifEntry{Type: exifTypeLong, Count: 1, Value: d.longBytes(value)}
+}
+
+// longBytes returns bytes of a LONG value
+func (d *exifData) longBytes(value uint32) []byte {
+	b := make([]byte, 4)
+	d.order.PutUint32(b, value)
+
+	return b
+}
+
+// setRationals sets RATIONAL values (numerator/denominator pairs)
+func (d *exifData) setRationals(ifd exifIFD, tag uint16, values ...[2]uint32) {
+	b := make([]byte, 8*len(values))
+	for i, v := range values {
+		d.order.PutUint32(b[i*8:], v[0])
+		d.order.PutUint32(b[i*8+4:], v[1])
+	}
+	d.ifds[ifd][tag] = exifEntry{Type: exifTypeRational, Count: uint32(len(values)), Value: b}
+}
+
+// encode encodes exif data into TIFF structure (without the `Exif\0\0` header)
+func (d *exifData) encode() []byte {
+	// sorted tags of IFDs (sub IFDs are pointed from IFD0 only when they are not empty)
+	var tags [numIFDs][]uint16
+	for ifd := range d.ifds {
+		for tag := range d.ifds[ifd] {
+			tags[ifd] = append(tags[ifd], tag)
+		}
+	}
+	hasExif, hasGPS := len(tags[ifdExif]) > 0, len(tags[ifdGPS]) > 0
+	if hasExif {
+		tags[ifd0] = append(tags[ifd0], exifTagExifIFDPointer)
+	}
+	if hasGPS {
+		tags[ifd0] = append(tags[ifd0], exifTagGPSIFDPointer)
+	}
+	for ifd := range tags {
+		sort.Slice(tags[ifd], func(i, j int) bool { return tags[ifd][i] < tags[ifd][j] })
+	}
+
+	// layout: header, IFD0, Exif IFD, GPS IFD, then values which don't fit in 4 bytes
+	ifdSize := func(ifd exifIFD) uint32 {
+		if len(tags[ifd]) <= 0 {
+			return 0
+		}
+		return uint32(2 + 12*len(tags[ifd]) + 4)
+	}
+	var offsets [numIFDs]uint32
+	offsets[ifd0] = 8
+	offsets[ifdExif] = offsets[ifd0] + ifdSize(ifd0)
+	offsets[ifdGPS] = offsets[ifdExif] + ifdSize(ifdExif)
+	dataOffset := offsets[ifdGPS] + ifdSize(ifdGPS)
+
+	var header bytes.Buffer
+	if d.order == binary.LittleEndian {
+		header.WriteString("II")
+	} else {
+		header.WriteString("MM")
+	}
+	_ = binary.Write(&header, d.order, uint16(42))
+	_ = binary.Write(&header, d.order, offsets[ifd0])
+
+	var ifds, data bytes.Buffer
+	for ifd := range numIFDs {
+		if len(tags[ifd]) <= 0 {
+			continue
+		}
+
+		_ = binary.Write(&ifds, d.order, uint16(len(tags[ifd])))
+		for _, tag := range tags[ifd] {
+			var entry exifEntry
+			switch {
+			case ifd == ifd0 && tag == exifTagExifIFDPointer:
+				entry = exifEntry{Type: exifTypeLong, Count: 1, Value: d.longBytes(offsets[ifdExif])}
+			case ifd == ifd0 && tag == exifTagGPSIFDPointer:
+				entry = exifEntry{Type: exifTypeLong, Count: 1, Value: d.longBytes(offsets[ifdGPS])}
+			default:
+				entry = d.ifds[ifd][tag]
+			}
+
+			_ = binary.Write(&ifds, d.order, tag)
+			_ = binary.Write(&ifds, d.order, entry.Type)
+			_ = binary.Write(&ifds, d.order, entry.Count)
+			if len(entry.Value) <= 4 {
+				value := make([]byte, 4)
+				copy(value, entry.Value)
+				ifds.Write(value)
+			} else {
+				_ = binary.Write(&ifds, d.order, dataOffset+uint32(data.Len()))
+				data.Write(entry.Value)
+				if data.Len()%2 != 0 {
+					data.WriteByte(0) // values should start at word boundaries
+				}
+			}
+		}
+		_ = binary.Write(&ifds, d.order, uint32(0)) // no next IFD
+	}
+
+	return append(append(header.Bytes(), ifds.Bytes()...), data.Bytes()...)
+}
+
+// extractExif returns the exif data (without the `Exif\0\0` header) in given jpeg bytes, or nil if there is none
+func extractExif(jpegBytes []byte) []byte {
+	for _, segment := range jpegSegments(jpegBytes) {
+		if segment.marker == jpegMarkerAPP1 && bytes.HasPrefix(segment.data, exifHeader) {
+			return segment.data[len(exifHeader):]
+		}
+	}
+
+	return nil
+}
+
+// jpeg segment (before the image data)
+type jpegSegment struct {
+	marker byte
+	data   []byte // without the length bytes
+	raw    []byte // whole segment, including the marker and the length bytes
+}
+
+// jpegSegments returns segments of given jpeg bytes before the start of the image data
+func jpegSegments(jpegBytes []byte) (segments []jpegSegment) {
+	if len(jpegBytes) < 4 || jpegBytes[0] != 0xff || jpegBytes[1] != jpegMarkerSOI {
+		return nil
+	}
+
+	for i := 2; i+4 <= len(jpegBytes) && jpegBytes[i] == 0xff; {
+		marker := jpegBytes[i+1]
+		if marker == jpegMarkerSOS {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(jpegBytes[i+2 : i+4]))
+		if length < 2 || i+2+length > len(jpegBytes) {
+			break
+		}
+
+		segments = append(segments, jpegSegment{
+			marker: marker,
+			data:   jpegBytes[i+4 : i+2+length],
+			raw:    jpegBytes[i : i+2+length],
+		})
+		i += 2 + length
+	}
+
+	return segments
+}
+
+// replaceExif replaces the exif data of given jpeg bytes with a new one
+func replaceExif(jpegBytes []byte, payload []byte) ([]byte, error) {
+	segmentLength := 2 + len(exifHeader) + len(payload)
+	if segmentLength > math.MaxUint16 {
+		return nil, fmt.Errorf("exif data too large: %d bytes", len(payload))
+	}
+
+	segments := jpegSegments(jpegBytes)
+	if segments == nil {
+		return nil, fmt.Errorf("not a jpeg image")
+	}
+
+	var buffer bytes.Buffer
+	buffer.Write([]byte{0xff, jpegMarkerSOI})
+
+	// exif segment should come right after SOI (or JFIF APP0)
+	rest := segments
+	if len(rest) > 0 && rest[0].marker == jpegMarkerAPP0 {
+		buffer.Write(rest[0].raw)
+		rest = rest[1:]
+	}
+	buffer.Write([]byte{0xff, jpegMarkerAPP1})
+	_ = binary.Write(&buffer, binary.BigEndian, uint16(segmentLength))
+	buffer.Write(exifHeader)
+	buffer.Write(payload)
+
+	// other segments and the image data (except existing exif segments)
+	consumed := 2
+	for _, segment := range segments {
+		consumed += len(segment.raw)
+	}
+	for _, segment := range rest {
+		if segment.marker == jpegMarkerAPP1 && bytes.HasPrefix(segment.data, exifHeader) {
+			continue
+		}
+		buffer.Write(segment.raw)
+	}
+	buffer.Write(jpegBytes[consumed:])
+
+	return buffer.Bytes(), nil
+}
+
+// writeExif writes exif metadata into the processed jpeg bytes,
+// preserving the one of the original jpeg bytes and injecting values from the config (if any)
+func writeExif(
+	processed, original []byte,
+	conf *exifConfig,
+	capturedAt time.Time,
+	cameraParams map[string]any,
+) ([]byte, error) {
+	reencoded := !bytes.Equal(processed, original)
+	originalExif := extractExif(original)
+
+	// nothing to do
+	if conf == nil && (!reencoded || originalExif == nil) {
+		return processed, nil
+	}
+
+	// preserve the original exif data
+	d := newExifData(binary.LittleEndian)
+	if originalExif != nil {
+		if parsed, err := parseExif(originalExif); err == nil {
+			d = parsed
+		} else {
+			logError("failed to parse exif of the original image, ignoring it: %s", err)
+		}
+	}
+
+	// dimensions may have changed
+	if reencoded {
+		if cfg, err := jpeg.DecodeConfig(bytes.NewReader(processed)); err == nil {
+			d.setLong(ifdExif, exifTagPixelXDimension, uint32(cfg.Width))
+			d.setLong(ifdExif, exifTagPixelYDimension, uint32(cfg.Height))
+		}
+	}
+
+	// inject values
+	if conf != nil {
+		datetime := capturedAt.Format(exifDatetimeFormat)
+		d.setASCII(ifd0, exifTagDateTime, datetime)
+		d.setASCII(ifd0, exifTagSoftware, exifSoftware)
+		d.setASCII(ifdExif, exifTagDateTimeOriginal, datetime)
+		d.setASCII(ifdExif, exifTagDateTimeDigitized, datetime)
+		d.setASCII(ifdExif, exifTagOffsetTimeOriginal, capturedAt.Format("-07:00"))
+
+		if conf.DeviceLabel != "" {
+			d.setASCII(ifd0, exifTagImageDescription, conf.DeviceLabel)
+		}
+		if conf.CameraParams && len(cameraParams) > 0 {
+			d.setBytes(ifdExif, exifTagUserComment, exifTypeUndefined, append([]byte("ASCII\x00\x00\x00"), []byte(formatCameraParams(cameraParams))...))
+		}
+		if conf.Latitude != nil && conf.Longitude != nil {
+			d.setBytes(ifdGPS, exifTagGPSVersionID, exifTypeByte, []byte{2, 3, 0, 0})
+			d.setASCII(ifdGPS, exifTagGPSLatitudeRef, map[bool]string{true: "N", false: "S"}[*conf.Latitude >= 0])
+			d.setRationals(ifdGPS, exifTagGPSLatitude, degreesToRationals(*conf.Latitude)...)
+			d.setASCII(ifdGPS, exifTagGPSLongitudeRef, map[bool]string{true: "E", false: "W"}[*conf.Longitude >= 0])
+			d.setRationals(ifdGPS, exifTagGPSLongitude, degreesToRationals(*conf.Longitude)...)
+			if conf.Altitude != nil {
+				ref := byte(0) // above sea level
+				if *conf.Altitude < 0 {
+					ref = 1
+				}
+				d.setBytes(ifdGPS, exifTagGPSAltitudeRef, exifTypeByte, []byte{ref})
+				d.setRationals(ifdGPS, exifTagGPSAltitude, [2]uint32{uint32(math.Round(math.Abs(*conf.Altitude) * 100)), 100})
+			}
+		}
+	}
+
+	return replaceExif(processed, d.encode())
+}
+
+// degreesToRationals converts decimal degrees into degrees, minutes, and seconds in rationals
+func degreesToRationals(degrees float64) [][2]uint32 {
+	degrees = math.Abs(degrees)
+	d := math.Floor(degrees)
+	m := math.Floor((degrees - d) * 60)
+	s := (degrees - d - m/60) * 3600
+
+	return [][2]uint32{
+		{uint32(d), 1},
+		{uint32(m), 1},
+		{uint32(math.Round(s * 1000)), 1000},
+	}
+}
+
+// formatCameraParams formats camera params as command line arguments, sorted by their names
+func formatCameraParams(cameraParams map[string]any) string {
+	keys := make([]string, 0, len(cameraParams))
+	for k := range cameraParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := []string{}
+	for _, k := range keys {
+		args = append(args, k)
+		if v := cameraParams[k]; v != nil {
+			args = append(args, fmt.Sprintf("%v", v))
+		}
+	}
+
+	return strings.Join(args, " ")
+}
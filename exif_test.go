@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testExifData returns exif data with values of all IFDs in given byte order
+func testExifData(order binary.ByteOrder) *exifData {
+	d := newExifData(order)
+	d.setASCII(ifd0, exifTagImageDescription, "front yard")
+	d.setASCII(ifd0, exifTagSoftware, exifSoftware)
+	d.setLong(ifdExif, exifTagPixelXDimension, 640)
+	d.setLong(ifdExif, exifTagPixelYDimension, 480)
+	d.setBytes(ifdExif, exifTagUserComment, exifTypeUndefined, []byte("ASCII\x00\x00\x00--ev 1"))
+	d.setBytes(ifdGPS, exifTagGPSVersionID, exifTypeByte, []byte{2, 3, 0, 0})
+	d.setASCII(ifdGPS, exifTagGPSLatitudeRef, "N")
+	d.setRationals(ifdGPS, exifTagGPSLatitude, degreesToRationals(37.5665)...)
+
+	return d
+}
+
+// exifSegmentsOf returns exif segments of given jpeg bytes
+func exifSegmentsOf(jpegBytes []byte) (segments []jpegSegment) {
+	for _, segment := range jpegSegments(jpegBytes) {
+		if segment.marker == jpegMarkerAPP1 && bytes.HasPrefix(segment.data, exifHeader) {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+func TestExifRoundTrip(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		written := testExifData(order)
+
+		parsed, err := parseExif(written.encode())
+		if err != nil {
+			t.Fatalf("failed to parse encoded exif (%s): %s", order, err)
+		}
+		if parsed.order != order {
+			t.Errorf("unexpected byte order: %s (expected: %s)", parsed.order, order)
+		}
+		if !reflect.DeepEqual(parsed.ifds, written.ifds) {
+			t.Errorf("tags differ after a round trip (%s):\n%v\n%v", order, parsed.ifds, written.ifds)
+		}
+	}
+}
+
+func TestParseMalformedExif(t *testing.T) {
+	payload := testExifData(binary.BigEndian).encode()
+
+	// truncated (should not panic)
+	for i := range len(payload) {
+		_, _ = parseExif(payload[:i])
+	}
+	if _, err := parseExif(payload[:len(payload)/2]); err == nil {
+		t.Errorf("expected an error for truncated exif")
+	}
+
+	// corrupted (should not panic)
+	for i := range len(payload) {
+		for _, b := range []byte{0x00, 0x7f, 0xff} {
+			corrupted := bytes.Clone(payload)
+			corrupted[i] = b
+			_, _ = parseExif(corrupted)
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"empty":            {},
+		"unknown order":    []byte("XX\x00\x2a\x00\x00\x00\x08"),
+		"wrong magic":      []byte("MM\x00\x2b\x00\x00\x00\x08"),
+		"ifd out of range": []byte("MM\x00\x2a\xff\xff\xff\xff"),
+		"too many entries": []byte("MM\x00\x2a\x00\x00\x00\x08\xff\xff"),
+		"value out of range": append([]byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01"),
+			0x01, 0x0e, 0x00, exifTypeASCII, 0x00, 0x00, 0x00, 0x10, 0xff, 0xff, 0xff, 0xf0, 0, 0, 0, 0),
+	} {
+		if _, err := parseExif(data); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestMalformedJPEGWithExif(t *testing.T) {
+	img, err := replaceExif(testJPEG(t, 16, 16, func(x, y int) color.RGBA { return gray(128) }), testExifData(binary.LittleEndian).encode())
+	if err != nil {
+		t.Fatalf("failed to write exif: %s", err)
+	}
+
+	// truncated jpegs (should not panic)
+	for i := range len(img) {
+		_ = extractExif(img[:i])
+		_, _ = replaceExif(img[:i], nil)
+		_, _ = writeExif(img[:i], img[:i], &exifConfig{}, time.Now(), nil)
+	}
+	if _, err := replaceExif([]byte("not a jpeg"), nil); err == nil {
+		t.Errorf("expected an error for a non-jpeg")
+	}
+}
+
+func TestReplaceExif(t *testing.T) {
+	img := testJPEG(t, 32, 16, func(x, y int) color.RGBA { return gray(200) })
+
+	first, second := testExifData(binary.LittleEndian), newExifData(binary.BigEndian)
+	second.setASCII(ifd0, exifTagImageDescription, "replaced")
+
+	withExif, err := replaceExif(img, first.encode())
+	if err != nil {
+		t.Fatalf("failed to write exif: %s", err)
+	}
+	replaced, err := replaceExif(withExif, second.encode())
+	if err != nil {
+		t.Fatalf("failed to replace exif: %s", err)
+	}
+
+	// only the new exif segment is left
+	if segments := exifSegmentsOf(replaced); len(segments) != 1 {
+		t.Fatalf("expected a single exif segment, got: %d", len(segments))
+	}
+	if parsed, err := parseExif(extractExif(replaced)); err != nil || !reflect.DeepEqual(parsed.ifds, second.ifds) {
+		t.Errorf("exif was not replaced: %v (%v)", parsed, err)
+	}
+
+	// image data is kept
+	if decoded := decodeTestJPEG(t, replaced); decoded.Bounds().Dx() != 32 || !isCloseTo(decoded, 16, 8, gray(200)) {
+		t.Errorf("image was changed")
+	}
+}
+
+func TestWriteExif(t *testing.T) {
+	// original exif with a maker note
+	const exifTagMake = 0x010f
+	d := newExifData(binary.BigEndian)
+	d.setASCII(ifd0, exifTagMake, "Raspberry Pi")
+	d.setBytes(ifdExif, exifTagMakerNote, exifTypeUndefined, []byte("vendor data with offsets"))
+	original, err := replaceExif(testJPEG(t, 32, 16, func(x, y int) color.RGBA { return gray(100) }), d.encode())
+	if err != nil {
+		t.Fatalf("failed to write exif: %s", err)
+	}
+	processed := testJPEG(t, 16, 8, func(x, y int) color.RGBA { return gray(100) })
+
+	latitude, longitude, altitude := 37.5665, -126.978, -2.5
+	capturedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("KST", 9*60*60))
+	written, err := writeExif(processed, original, &exifConfig{
+		DeviceLabel:  "front yard",
+		Latitude:     &latitude,
+		Longitude:    &longitude,
+		Altitude:     &altitude,
+		CameraParams: true,
+	}, capturedAt, map[string]any{"--ev": 1, "--hflip": nil})
+	if err != nil {
+		t.Fatalf("failed to write exif: %s", err)
+	}
+
+	parsed, err := parseExif(extractExif(written))
+	if err != nil {
+		t.Fatalf("failed to parse written exif: %s", err)
+	}
+	if parsed.order != binary.BigEndian {
+		t.Errorf("byte order of the original exif should be kept")
+	}
+
+	// original values are kept, except the maker note
+	if entry := parsed.ifds[ifd0][exifTagMake]; string(entry.Value) != "Raspberry Pi\x00" {
+		t.Errorf("original value was not kept: %q", entry.Value)
+	}
+	if _, exists := parsed.ifds[ifdExif][exifTagMakerNote]; exists {
+		t.Errorf("maker note should be dropped")
+	}
+
+	// injected values
+	for _, expected := range []struct {
+		ifd   exifIFD
+		tag   uint16
+		value string
+	}{
+		{ifd0, exifTagImageDescription, "front yard\x00"},
+		{ifd0, exifTagDateTime, "2026:01:02 03:04:05\x00"},
+		{ifdExif, exifTagOffsetTimeOriginal, "+09:00\x00"},
+		{ifdExif, exifTagUserComment, "ASCII\x00\x00\x00--ev 1 --hflip"},
+		{ifdGPS, exifTagGPSLatitudeRef, "N\x00"},
+		{ifdGPS, exifTagGPSLongitudeRef, "W\x00"},
+		{ifdGPS, exifTagGPSAltitudeRef, "\x01"},
+	} {
+		if entry := parsed.ifds[expected.ifd][expected.tag]; string(entry.Value) != expected.value {
+			t.Errorf("unexpected value of tag 0x%04x: %q (expected: %q)", expected.tag, entry.Value, expected.value)
+		}
+	}
+	if width := parsed.order.Uint32(parsed.ifds[ifdExif][exifTagPixelXDimension].Value); width != 16 {
+		t.Errorf("dimensions should be of the processed image: %d", width)
+	}
+	if rationals := parsed.ifds[ifdGPS][exifTagGPSLatitude].Value; parsed.order.Uint32(rationals[0:4]) != 37 || parsed.order.Uint32(rationals[8:12]) != 33 {
+		t.Errorf("unexpected latitude: %v", rationals)
+	}
+}
+
+func TestWriteExifWithoutChanges(t *testing.T) {
+	img := testJPEG(t, 16, 16, func(x, y int) color.RGBA { return gray(50) })
+
+	// nothing is written without config when the image was not re-encoded
+	if written, err := writeExif(img, img, nil, time.Now(), nil); err != nil || !bytes.Equal(written, img) {
+		t.Errorf("image should not be changed: %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// subcommands
+	subcommandExport = "export"
+	subcommandImport = "import"
+
+	// export formats
+	exportFormatJSON = "json"
+	exportFormatCSV  = "csv"
+	exportFormatZIP  = "zip"
+
+	// entries in exported zip files
+	exportZipPhotosEntry = "photos.json"
+	exportZipImagesDir   = "images"
+
+	// format of `--since`
+	exportSinceFormat = "2006-01-02"
+)
+
+// columns of exported csv files
+var exportCSVHeader = []string{"user_name", "file_id", "caption", "time", "archive_path", "is_document", "is_favorite", "chat_id", "message_id", "camera"}
+
+// runExport exports capture history (and archived images) with given command line arguments
+func runExport(args []string) (err error) {
+	flags := flag.NewFlagSet(subcommandExport, flag.ContinueOnError)
+	since := flags.String("since", "", "export photos taken on or after this date (YYYY-MM-DD)")
+	format := flags.String("format", exportFormatJSON, "export format: json, csv, or zip (with archived images)")
+	output := flags.String("output", "", "output file path (default: stdout)")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+
+	var sinceTime time.Time
+	if *since != "" {
+		if sinceTime, err = time.ParseInLocation(exportSinceFormat, *since, time.Local); err != nil {
+			return fmt.Errorf("malformed `--since` value: %s", *since)
+		}
+	}
+
+	var photos []Photo
+	if photos, err = db.getPhotosSince(sinceTime); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		var file *os.File
+		if file, err = os.Create(*output); err != nil {
+			return fmt.Errorf("failed to create output file: %s", err)
+		}
+		defer func() {
+			if e := file.Close(); err == nil {
+				err = e
+			}
+		}()
+		w = file
+	}
+
+	switch *format {
+	case exportFormatJSON:
+		err = writePhotosJSON(w, photos)
+	case exportFormatCSV:
+		err = writePhotosCSV(w, photos)
+	case exportFormatZIP:
+		err = writePhotosZIP(w, photos, archiveDir)
+	default:
+		return fmt.Errorf("unknown export format: %s", *format)
+	}
+	if err == nil {
+		logMessage("exported %d photo(s)", len(photos))
+	}
+
+	return err
+}
+
+// runImport imports capture history (and archived images) with given command line arguments
+func runImport(args []string) (err error) {
+	flags := flag.NewFlagSet(subcommandImport, flag.ContinueOnError)
+	format := flags.String("format", "", "import format: json, csv, or zip (default: guessed from the file extension)")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: %s [--format json|csv|zip] FILE", subcommandImport)
+	}
+	input := flags.Arg(0)
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(input)), ".")
+	}
+
+	var photos []Photo
+	var zr *zip.ReadCloser
+	switch *format {
+	case exportFormatJSON, exportFormatCSV:
+		var file *os.File
+		if file, err = os.Open(input); err != nil {
+			return fmt.Errorf("failed to open input file: %s", err)
+		}
+		defer func() { _ = file.Close() }()
+
+		if *format == exportFormatJSON {
+			photos, err = readPhotosJSON(file)
+		} else {
+			photos, err = readPhotosCSV(file)
+		}
+	case exportFormatZIP:
+		if zr, photos, err = openPhotosZIP(input); err == nil {
+			defer func() { _ = zr.Close() }()
+		}
+	default:
+		return fmt.Errorf("unknown import format: %s", *format)
+	}
+	if err != nil {
+		return err
+	}
+	if err = validateImportedPhotos(photos); err != nil {
+		return err
+	}
+
+	// skip photos which already exist
+	var existing []Photo
+	if existing, err = db.getPhotosSince(time.Time{}); err != nil {
+		return err
+	}
+	exists := map[string]bool{}
+	for _, photo := range existing {
+		exists[photoKey(photo)] = true
+	}
+
+	imported := []Photo{}
+	for _, photo := range photos {
+		if exists[photoKey(photo)] {
+			continue
+		}
+		exists[photoKey(photo)] = true
+		imported = append(imported, photo)
+	}
+
+	// restore archived images of the imported photos only (from zip files)
+	var restored []string
+	if zr != nil {
+		if restored, err = restoreArchivedImages(zr, imported, archiveDir); err != nil {
+			return err
+		}
+	}
+
+	// (nothing is imported if any of them fails)
+	if err = db.savePhotos(imported); err != nil {
+		removeArchivedFiles(archiveDir, restored)
+		return err
+	}
+
+	logMessage("imported %d photo(s), skipped %d existing one(s)", len(imported), len(photos)-len(imported))
+
+	return nil
+}
+
+// validateImportedPhotos checks values of imported photos (of any format)
+func validateImportedPhotos(photos []Photo) error {
+	for i, photo := range photos {
+		if photo.FileID == "" {
+			return fmt.Errorf("no file id in photo #%d", i+1)
+		}
+		if photo.ArchivePath != "" && !filepath.IsLocal(photo.ArchivePath) {
+			return fmt.Errorf("invalid archive path in photo #%d: %s", i+1, photo.ArchivePath)
+		}
+	}
+
+	return nil
+}
+
+// photoKey returns a key for detecting duplicated photos
+func photoKey(photo Photo) string {
+	return fmt.Sprintf("%s/%d", photo.FileID, photo.Time.Unix())
+}
+
+// writePhotosJSON writes photos as a JSON array
+func writePhotosJSON(w io.Writer, photos []Photo) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(photos)
+}
+
+// readPhotosJSON reads photos from a JSON array
+func readPhotosJSON(r io.Reader) (photos []Photo, err error) {
+	if err = json.NewDecoder(r).Decode(&photos); err != nil {
+		return nil, fmt.Errorf("failed to decode photos: %s", err)
+	}
+
+	return photos, nil
+}
+
+// writePhotosCSV writes photos as CSV rows (with a header)
+func writePhotosCSV(w io.Writer, photos []Photo) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(exportCSVHeader); err != nil {
+		return err
+	}
+	for _, photo := range photos {
+		if err := writer.Write([]string{
+			photo.UserName,
+			photo.FileID,
+			photo.Caption,
+			photo.Time.Format(time.RFC3339),
+			filepath.ToSlash(photo.ArchivePath),
+			strconv.FormatBool(photo.IsDocument),
+			strconv.FormatBool(photo.IsFavorite),
+			strconv.FormatInt(photo.ChatID, 10),
+			strconv.FormatInt(photo.MessageID, 10),
+			photo.Camera,
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// readPhotosCSV reads photos from CSV rows (with a header)
+//
+// (columns are matched by the header, so files exported by older versions can also be read)
+func readPhotosCSV(r io.Reader) (photos []Photo, err error) {
+	reader := csv.NewReader(r)
+
+	var records [][]string
+	if records, err = reader.ReadAll(); err != nil {
+		return nil, fmt.Errorf("failed to read csv: %s", err)
+	}
+	if len(records) <= 0 {
+		return nil, fmt.Errorf("no header in csv")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	for _, name := range []string{"user_name", "file_id", "time"} {
+		if _, exists := columns[name]; !exists {
+			return nil, fmt.Errorf("no `%s` column in csv", name)
+		}
+	}
+	column := func(record []string, name string) string {
+		if i, exists := columns[name]; exists && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	for i, record := range records[1:] {
+		var tm time.Time
+		if tm, err = time.Parse(time.RFC3339, column(record, "time")); err != nil {
+			return nil, fmt.Errorf("malformed time on line %d: %s", i+2, column(record, "time"))
+		}
+		isDocument, _ := strconv.ParseBool(column(record, "is_document"))
+		isFavorite, _ := strconv.ParseBool(column(record, "is_favorite"))
+		chatID, _ := strconv.ParseInt(column(record, "chat_id"), 10, 64)
+		messageID, _ := strconv.ParseInt(column(record, "message_id"), 10, 64)
+
+		photos = append(photos, Photo{
+			UserName:    column(record, "user_name"),
+			FileID:      column(record, "file_id"),
+			Caption:     column(record, "caption"),
+			Time:        tm,
+			ArchivePath: filepath.FromSlash(column(record, "archive_path")),
+			IsDocument:  isDocument,
+			IsFavorite:  isFavorite,
+			ChatID:      chatID,
+			MessageID:   messageID,
+			Camera:      column(record, "camera"),
+		})
+	}
+
+	return photos, nil
+}
+
+// writePhotosZIP writes photos and their archived images into a zip archive
+func writePhotosZIP(w io.Writer, photos []Photo, archiveDir string) (err error) {
+	zw := zip.NewWriter(w)
+	defer func() {
+		if e := zw.Close(); err == nil {
+			err = e
+		}
+	}()
+
+	// archived images
+	exported := []Photo{}
+	for _, photo := range photos {
+		if photo.ArchivePath != "" {
+			if archiveDir == "" {
+				photo.ArchivePath = ""
+			} else if bytes, e := readArchivedImage(archiveDir, photo.ArchivePath); e != nil {
+				logError("skipping missing archived image: %s (%s)", photo.ArchivePath, e)
+				photo.ArchivePath = ""
+			} else {
+				var fw io.Writer
+				if fw, err = zw.Create(path.Join(exportZipImagesDir, filepath.ToSlash(photo.ArchivePath))); err != nil {
+					return err
+				}
+				if _, err = fw.Write(bytes); err != nil {
+					return err
+				}
+			}
+		}
+		exported = append(exported, photo)
+	}
+
+	// photos
+	var fw io.Writer
+	if fw, err = zw.Create(exportZipPhotosEntry); err != nil {
+		return err
+	}
+
+	return writePhotosJSON(fw, exported)
+}
+
+// openPhotosZIP opens a zip archive of exported photos, and reads the photos in it
+// (the returned zip archive should be closed after restoring archived images from it)
+func openPhotosZIP(input string) (zr *zip.ReadCloser, photos []Photo, err error) {
+	if zr, err = zip.OpenReader(input); err != nil {
+		return nil, nil, fmt.Errorf("failed to open zip file: %s", err)
+	}
+
+	var file io.ReadCloser
+	if file, err = zr.Open(exportZipPhotosEntry); err != nil {
+		_ = zr.Close()
+		return nil, nil, fmt.Errorf("no `%s` in zip file: %s", exportZipPhotosEntry, err)
+	}
+	photos, err = readPhotosJSON(file)
+	_ = file.Close()
+	if err != nil {
+		_ = zr.Close()
+		return nil, nil, err
+	}
+
+	return zr, photos, nil
+}
+
+// restoreArchivedImages writes archived images of given (validated) photos from the zip archive into the archive directory,
+// and returns the paths of written files
+//
+// archive paths of photos without images in the zip archive are cleared, and existing files are never overwritten
+// (written files are removed if any of them fails)
+func restoreArchivedImages(zr *zip.ReadCloser, photos []Photo, archiveDir string) (written []string, err error) {
+	for i, photo := range photos {
+		if photo.ArchivePath == "" {
+			continue
+		}
+
+		if archiveDir == "" {
+			logError("`archive_dir` is not set, skipping archived image: %s", photo.ArchivePath)
+			photos[i].ArchivePath = ""
+			continue
+		}
+
+		var bytes []byte
+		if bytes, err = readZipEntry(zr, path.Join(exportZipImagesDir, filepath.ToSlash(photo.ArchivePath))); err != nil {
+			logError("skipping missing archived image: %s (%s)", photo.ArchivePath, err)
+			photos[i].ArchivePath = ""
+			continue
+		}
+		if err = writeArchivedFile(archiveDir, photo.ArchivePath, bytes); err != nil {
+			removeArchivedFiles(archiveDir, written)
+			return nil, err
+		}
+		written = append(written, photo.ArchivePath)
+	}
+
+	return written, nil
+}
+
+// removeArchivedFiles removes files at given paths in the archive directory
+func removeArchivedFiles(archiveDir string, relPaths []string) {
+	for _, relPath := range relPaths {
+		if err := deleteArchivedImage(archiveDir, relPath); err != nil {
+			logError("failed to remove archived image: %s (%s)", relPath, err)
+		}
+	}
+}
+
+// readZipEntry reads all bytes of a named entry in given zip archive
+func readZipEntry(zr *zip.ReadCloser, name string) ([]byte, error) {
+	file, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	return io.ReadAll(file)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportRejectsArchivePathsOutsideArchive(t *testing.T) {
+	inputs := map[string]string{
+		"photos.json": `[
+			{"user_name": "alice", "file_id": "a", "time": "2026-01-01T00:00:00Z", "archive_path": "2026-01/a.jpg"},
+			{"user_name": "alice", "file_id": "b", "time": "2026-01-02T00:00:00Z", "archive_path": "../../etc/passwd"}
+		]`,
+		"photos.csv": "user_name,file_id,time,archive_path\n" +
+			"alice,a,2026-01-01T00:00:00Z,2026-01/a.jpg\n" +
+			"alice,b,2026-01-02T00:00:00Z,/etc/passwd\n",
+	}
+
+	for name, content := range inputs {
+		t.Run(name, func(t *testing.T) {
+			db = newMemoryStore()
+
+			input := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(input, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := runImport([]string{input})
+			if err == nil || !strings.Contains(err.Error(), "invalid archive path") {
+				t.Fatalf("expected an invalid archive path error, got: %v", err)
+			}
+
+			// (nothing is imported, not even the valid ones)
+			if photos, _ := db.getPhotosSince(time.Time{}); len(photos) != 0 {
+				t.Errorf("expected no imported photos, got %d", len(photos))
+			}
+		})
+	}
+}
+
+func TestImportIsAllOrNothing(t *testing.T) {
+	store, err := openDB(filepath.Join(t.TempDir(), DbFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.close() }()
+	db = store
+
+	var buf bytes.Buffer
+	if err := writePhotosCSV(&buf, []Photo{
+		{UserName: "alice", FileID: "a", Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{UserName: "alice", FileID: "b", Time: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(t.TempDir(), "photos.csv")
+	if err := os.WriteFile(input, append(buf.Bytes(), []byte("bob,,2026-01-03T00:00:00Z,,false,false,0,0,\n")...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runImport([]string{input}); err == nil {
+		t.Fatalf("expected an error for the row without a file id")
+	}
+	if photos, _ := db.getPhotosSince(time.Time{}); len(photos) != 0 {
+		t.Errorf("expected no imported photos, got %d", len(photos))
+	}
+
+	// without the bad row
+	if err := os.WriteFile(input, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runImport([]string{input}); err != nil {
+		t.Fatal(err)
+	}
+	if photos, _ := db.getPhotosSince(time.Time{}); len(photos) != 2 {
+		t.Errorf("expected 2 imported photos, got %d", len(photos))
+	}
+}
+
+func TestArchivedFilePath(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, relPath := range []string{"../outside.jpg", "/etc/passwd", "2026-01/../../outside.jpg"} {
+		if _, err := readArchivedImage(dir, relPath); err == nil {
+			t.Errorf("expected an error for reading %s", relPath)
+		}
+		if err := deleteArchivedImage(dir, relPath); err == nil {
+			t.Errorf("expected an error for deleting %s", relPath)
+		}
+	}
+
+	if err := writeArchivedFile(dir, filepath.Join("2026-01", "a.jpg"), []byte("jpeg")); err != nil {
+		t.Fatal(err)
+	}
+	if bytes, err := readArchivedImage(dir, filepath.Join("2026-01", "a.jpg")); err != nil || string(bytes) != "jpeg" {
+		t.Errorf("unexpected archived image: %q (%v)", bytes, err)
+	}
+}
+
+// failingStore is a store which fails saving photos
+type failingStore struct {
+	Store
+}
+
+func (s failingStore) savePhotos(photos []Photo) error {
+	return errors.New("failed to save photos")
+}
+
+// exportZIP exports given photos with their images (keyed by archive paths) into a zip file, and returns its path
+func exportZIP(t *testing.T, photos []Photo, images map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for relPath, content := range images {
+		if err := writeArchivedFile(dir, relPath, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writePhotosZIP(&buf, photos, dir); err != nil {
+		t.Fatalf("failed to export photos: %s", err)
+	}
+	output := filepath.Join(t.TempDir(), "history.zip")
+	if err := os.WriteFile(output, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return output
+}
+
+// archivedFiles returns relative paths of all files in given archive directory
+func archivedFiles(t *testing.T, dir string) (relPaths []string) {
+	t.Helper()
+
+	if err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			relPath, _ := filepath.Rel(dir, path)
+			relPaths = append(relPaths, relPath)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return relPaths
+}
+
+func TestImportZIPWritesNothingOnFailure(t *testing.T) {
+	photos := []Photo{
+		{UserName: "alice", FileID: "a", Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), ArchivePath: filepath.Join("2026-01", "a.jpg")},
+		{UserName: "alice", FileID: "b", Time: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), ArchivePath: filepath.Join("2026-01", "b.jpg")},
+	}
+	images := map[string]string{photos[0].ArchivePath: "a", photos[1].ArchivePath: "b"}
+
+	saved := archiveDir
+	defer func() { db, archiveDir = nil, saved }()
+
+	// invalid photo
+	archiveDir = t.TempDir()
+	db = newMemoryStore()
+	input := exportZIP(t, append(slices.Clone(photos), Photo{UserName: "bob", Time: time.Now()}), images)
+	if err := runImport([]string{input}); err == nil || err.Error() != "no file id in photo #3" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if files := archivedFiles(t, archiveDir); len(files) != 0 {
+		t.Errorf("expected no written files, got %v", files)
+	}
+
+	// existing file at one of the archive paths
+	if err := writeArchivedFile(archiveDir, photos[1].ArchivePath, []byte("orphan")); err != nil {
+		t.Fatal(err)
+	}
+	input = exportZIP(t, photos, images)
+	if err := runImport([]string{input}); err == nil || !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected an error for the existing file, got: %v", err)
+	}
+	if files := archivedFiles(t, archiveDir); !slices.Equal(files, []string{photos[1].ArchivePath}) {
+		t.Errorf("expected only the existing file, got %v", files)
+	}
+	if bytes, _ := readArchivedImage(archiveDir, photos[1].ArchivePath); string(bytes) != "orphan" {
+		t.Errorf("existing file should not be overwritten: %s", bytes)
+	}
+
+	// failed transaction
+	archiveDir = t.TempDir()
+	db = failingStore{newMemoryStore()}
+	if err := runImport([]string{input}); err == nil || err.Error() != "failed to save photos" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if files := archivedFiles(t, archiveDir); len(files) != 0 {
+		t.Errorf("expected written files to be removed, got %v", files)
+	}
+}
+
+func TestImportZIPSkipsExistingPhotos(t *testing.T) {
+	existing := Photo{UserName: "alice", FileID: "a", Time: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), ArchivePath: filepath.Join("2026-01", "a.jpg")}
+	added := Photo{UserName: "alice", FileID: "b", Time: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), ArchivePath: filepath.Join("2026-01", "b.jpg")}
+
+	saved := archiveDir
+	defer func() { db, archiveDir = nil, saved }()
+
+	archiveDir = t.TempDir()
+	db = newMemoryStore()
+	if _, err := db.savePhoto(existing); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeArchivedFile(archiveDir, existing.ArchivePath, []byte("original")); err != nil {
+		t.Fatal(err)
+	}
+
+	// (the existing photo has a different image in the zip file)
+	input := exportZIP(t, []Photo{existing, added}, map[string]string{existing.ArchivePath: "other", added.ArchivePath: "b"})
+	if err := runImport([]string{input}); err != nil {
+		t.Fatalf("failed to import: %s", err)
+	}
+
+	if bytes, _ := readArchivedImage(archiveDir, existing.ArchivePath); string(bytes) != "original" {
+		t.Errorf("archived image of the existing photo should not be overwritten: %s", bytes)
+	}
+	if bytes, _ := readArchivedImage(archiveDir, added.ArchivePath); string(bytes) != "b" {
+		t.Errorf("unexpected archived image of the imported photo: %s", bytes)
+	}
+	if photos, _ := db.getPhotosSince(time.Time{}); len(photos) != 2 {
+		t.Errorf("expected 2 photos, got %d", len(photos))
+	}
+}
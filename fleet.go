@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// subcommand for running as an agent of the fleet
+	subcommandAgent = "agent"
+
+	// endpoints of agents
+	fleetCapturePath = "/v1/capture"
+	fleetCamerasPath = "/v1/cameras"
+
+	defaultFleetListen = ":8088"
+
+	fleetRequestTimeoutMargin = 10 * time.Second // added to the capture timeout of agents
+	fleetReadHeaderTimeout    = 10 * time.Second
+	fleetMaxRequestBytes      = 1 << 20
+	fleetMaxImageBytes        = 64 << 20
+)
+
+// fleetConfig is a configuration for aggregating cameras of multiple Pis
+//
+// a hub (the bot) captures with cameras of agents (`agent` subcommand on other Pis) over HTTP,
+// authenticated with a shared secret
+type fleetConfig struct {
+	Listen string `json:"listen,omitempty"` // address for agents to listen on (default: ":8088")
+	Secret string `json:"secret"`           // shared between the hub and agents
+}
+
+// validate checks if the fleet config has valid values
+func (c fleetConfig) validate() error {
+	if c.Secret == "" {
+		return fmt.Errorf("`secret` is needed for fleet")
+	}
+
+	return nil
+}
+
+// fleetCaptureRequest is a capture request from a hub to an agent
+type fleetCaptureRequest struct {
+	Camera       string         `json:"camera,omitempty"`        // name of the camera (default one if empty)
+	ImageWidth   int            `json:"image_width,omitempty"`   // (agent's one if 0)
+	ImageHeight  int            `json:"image_height,omitempty"`  // (agent's one if 0)
+	CameraParams map[string]any `json:"camera_params,omitempty"` // merged into agent's ones
+}
+
+// run as an agent: serve captures with local cameras to the hub
+func runAgent(args []string) (err error) {
+	flags := flag.NewFlagSet(subcommandAgent, flag.ContinueOnError)
+	listen := flags.String("listen", "", "address to listen on (default: `fleet.listen` of config, or "+defaultFleetListen+")")
+	if err = flags.Parse(args); err != nil {
+		return err
+	}
+
+	if fleet == nil {
+		return fmt.Errorf("`fleet` is not configured")
+	}
+	addr := *listen
+	if addr == "" {
+		addr = fleet.Listen
+	}
+	if addr == "" {
+		addr = defaultFleetListen
+	}
+
+	if len(lightConfs) > 0 {
+		var chips map[string]GPIOChip
+		if lights, chips, err = openLights(lightConfs); err != nil {
+			return err
+		}
+		defer func() {
+			for _, chip := range chips {
+				_ = chip.close()
+			}
+		}()
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           newAgentHandler(fleet.Secret),
+		ReadHeaderTimeout: fleetReadHeaderTimeout,
+		BaseContext:       func(net.Listener) context.Context { return captureCtx }, // (for canceling captures on shutdown)
+	}
+
+	// shut down on SIGINT or SIGTERM, after in-flight captures are finished (or canceled)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		<-ctx.Done()
+		stop()
+		logMessage("shutting down agent...")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownConf.timeout())
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logError("canceling captures which did not finish in %s", shutdownConf.timeout())
+			stopCaptures()
+			_ = server.Close()
+		}
+	}()
+
+	// reload config on SIGHUP (eg. image size and camera params of cameras)
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+	go func() {
+		for {
+			select {
+			case <-hangups:
+				if err := reloadConfig(); err != nil {
+					logError("failed to reload config (%s): %s", syscall.SIGHUP, err)
+				} else {
+					logMessage("reloaded config (%s)", syscall.SIGHUP)
+				}
+			case <-stopped:
+				return
+			}
+		}
+	}()
+
+	logMessage("agent listening on %s with cameras: %s", addr, strings.Join(cameraNames, ", "))
+
+	if err = server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-stopped
+
+	logMessage("stopped agent")
+
+	return nil
+}
+
+// newAgentHandler returns a http handler of agent endpoints, authenticated with given secret
+func newAgentHandler(secret string) http.Handler {
+	mux := http.NewServeMux()
+
+	// names of cameras (default one first)
+	mux.HandleFunc("GET "+fleetCamerasPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(cameraNames)
+	})
+
+	// capture a still image
+	mux.HandleFunc("POST "+fleetCapturePath, func(w http.ResponseWriter, r *http.Request) {
+		var req fleetCaptureRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, fleetMaxRequestBytes)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("malformed request: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		cam, exists := cameras[req.Camera]
+		if req.Camera == "" {
+			cam, exists = cameraNamed(""), true
+		}
+		if !exists {
+			http.Error(w, fmt.Sprintf("no such camera: %s", req.Camera), http.StatusNotFound)
+			return
+		}
+
+		// (camera params from the hub are checked like the ones in the config)
+		for flag := range req.CameraParams {
+			if err := checkCameraFlag(flag, cam.config.Backend); err != nil {
+				http.Error(w, fmt.Sprintf("invalid camera params: %s", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		width, height, params := cam.settings()
+		if req.ImageWidth > 0 && req.ImageHeight > 0 {
+			width, height = req.ImageWidth, req.ImageHeight
+		}
+		params = cloneCameraParams(params)
+		maps.Copy(params, req.CameraParams)
+
+		cam.Lock()
+		lightsOff := switchLightsForCapture(lights, cam.name)
+		image, err := cam.captureStill(r.Context(), width, height, params)
+		lightsOff()
+		cam.Unlock()
+
+		if err != nil {
+			logError("[agent] image capture with camera '%s' failed: %s", cam.name, err)
+			http.Error(w, describeCaptureError(err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = w.Write(image)
+	})
+
+	return authorizedHandler(secret, mux)
+}
+
+// authorizedHandler wraps a handler for allowing only requests with given secret as a bearer token
+func authorizedHandler(secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			logError("[agent] unauthorized request from %s", r.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// captureAgentImage requests a still image capture to an agent of the fleet
+func captureAgentImage(
+	ctx context.Context,
+	agentURL, secret string,
+	remoteCamera string,
+	width, height int,
+	cameraParams map[string]any,
+) (result []byte, err error) {
+	var body []byte
+	if body, err = json.Marshal(fleetCaptureRequest{
+		Camera:       remoteCamera,
+		ImageWidth:   width,
+		ImageHeight:  height,
+		CameraParams: cameraParams,
+	}); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cameraTimeout(cameraParams)+fleetRequestTimeoutMargin)
+	defer cancel()
+
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(agentURL, "/")+fleetCapturePath, bytes.NewReader(body)); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+secret)
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp *http.Response
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		return nil, fmt.Errorf("failed to request capture to agent: %s", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if result, err = io.ReadAll(io.LimitReader(resp.Body, fleetMaxImageBytes)); err != nil {
+		return nil, fmt.Errorf("failed to read response from agent: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent responded with %s: %s", resp.Status, strings.TrimSpace(string(result)))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const testFleetSecret = "fleet-secret"
+
+// startFakeAgent serves agent endpoints with fake cameras ("garage" as the default one, and "yard")
+func startFakeAgent(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	cameras = map[string]*camera{
+		"garage": {name: "garage", config: cameraConfig{Backend: cameraBackendFake, ImageWidth: 64, ImageHeight: 48}},
+		"yard":   {name: "yard", config: cameraConfig{Backend: cameraBackendFake, ImageWidth: 32, ImageHeight: 24}},
+	}
+	cameraNames = []string{"garage", "yard"}
+	fleet = &fleetConfig{Secret: testFleetSecret}
+	health = newWatchdog(healthConfig{}, nil, func() int { return 0 })
+	lights = nil
+
+	server := httptest.NewServer(newAgentHandler(testFleetSecret))
+	t.Cleanup(func() {
+		server.Close()
+		cameras, cameraNames, fleet, health = nil, nil, nil, nil
+	})
+
+	return server
+}
+
+// decodeImageSize returns the size of given jpeg image
+func decodeImageSize(t *testing.T, jpegBytes []byte) image.Point {
+	t.Helper()
+
+	config, err := jpeg.DecodeConfig(bytes.NewReader(jpegBytes))
+	if err != nil {
+		t.Fatalf("failed to decode image: %s", err)
+	}
+
+	return image.Pt(config.Width, config.Height)
+}
+
+// meanBrightness returns the mean value of all color channels of given jpeg image
+func meanBrightness(t *testing.T, jpegBytes []byte) float64 {
+	t.Helper()
+
+	img, err := jpeg.Decode(bytes.NewReader(jpegBytes))
+	if err != nil {
+		t.Fatalf("failed to decode image: %s", err)
+	}
+
+	var sum, n float64
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += float64(r>>8) + float64(g>>8) + float64(b>>8)
+			n += 3
+		}
+	}
+
+	return sum / n
+}
+
+func TestAgentCameras(t *testing.T) {
+	server := startFakeAgent(t)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+fleetCamerasPath, nil)
+	req.Header.Set("Authorization", "Bearer "+testFleetSecret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var names []string
+	if err := json.NewDecoder(resp.Body).Decode(&names); err != nil || !slices.Equal(names, []string{"garage", "yard"}) {
+		t.Errorf("unexpected camera names: %v (%v)", names, err)
+	}
+}
+
+func TestAgentCapture(t *testing.T) {
+	server := startFakeAgent(t)
+	ctx := context.Background()
+
+	// default camera with its own image size
+	captured, err := captureAgentImage(ctx, server.URL, testFleetSecret, "", 0, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to capture: %s", err)
+	}
+	if size := decodeImageSize(t, captured); size != image.Pt(64, 48) {
+		t.Errorf("unexpected image size: %s", size)
+	}
+
+	// named camera with requested image size
+	captured, err = captureAgentImage(ctx, server.URL, testFleetSecret, "yard", 40, 30, nil)
+	if err != nil {
+		t.Fatalf("failed to capture: %s", err)
+	}
+	if size := decodeImageSize(t, captured); size != image.Pt(40, 30) {
+		t.Errorf("unexpected image size: %s", size)
+	}
+
+	// camera params are passed to the agent's camera
+	dark, err := captureAgentImage(ctx, server.URL, testFleetSecret, "yard", 0, 0, map[string]any{cameraParamEV: -2})
+	if err != nil {
+		t.Fatalf("failed to capture: %s", err)
+	}
+	bright, err := captureAgentImage(ctx, server.URL, testFleetSecret, "yard", 0, 0, nil)
+	if err != nil {
+		t.Fatalf("failed to capture: %s", err)
+	}
+	if meanBrightness(t, dark) >= meanBrightness(t, bright)/2 {
+		t.Errorf("expected a darker image with negative ev")
+	}
+
+	// through a hub camera of agent backend
+	hubCamera := &camera{name: "remote", config: cameraConfig{Backend: cameraBackendAgent, URL: server.URL + "/", RemoteCamera: "garage"}}
+	if captured, err := hubCamera.captureStill(ctx, 0, 0, nil); err != nil {
+		t.Errorf("failed to capture through hub camera: %s", err)
+	} else if size := decodeImageSize(t, captured); size != image.Pt(64, 48) {
+		t.Errorf("unexpected image size: %s", size)
+	}
+}
+
+func TestAgentCaptureErrors(t *testing.T) {
+	server := startFakeAgent(t)
+	ctx := context.Background()
+
+	if _, err := captureAgentImage(ctx, server.URL, "wrong-secret", "", 0, 0, nil); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected unauthorized, got: %v", err)
+	}
+	if _, err := captureAgentImage(ctx, server.URL, testFleetSecret, "attic", 0, 0, nil); err == nil || !strings.Contains(err.Error(), "no such camera: attic") {
+		t.Errorf("expected no such camera, got: %v", err)
+	}
+
+	// camera params from the hub are checked like the ones in the config
+	for flag, expected := range map[string]string{
+		"--output":    "invalid camera params: camera flag `--output` is set by the bot, and cannot be used",
+		"--post-exec": "invalid camera params: unknown camera flag for libcamera: --post-exec",
+	} {
+		if _, err := captureAgentImage(ctx, server.URL, testFleetSecret, "yard", 0, 0, map[string]any{flag: "/tmp/x"}); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected '%s', got: %v", expected, err)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+fleetCapturePath, strings.NewReader("{not json"))
+	req.Header.Set("Authorization", "Bearer "+testFleetSecret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %s", resp.Status)
+	}
+
+	// without any secret
+	handler := newAgentHandler("")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, fleetCamerasPath, nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized without a secret, got %d", recorder.Code)
+	}
+}
+
+// config of agent processes (with fake cameras)
+const testAgentConfig = `{
+	"api_token": "unused",
+	"available_ids": [],
+	"image_width": %d,
+	"image_height": 300,
+	"cameras": {
+		"garage": {"backend": "fake"}
+	},
+	"fleet": {"secret": "` + testFleetSecret + `"},
+	"storage": "memory"
+}`
+
+// agentProcess prepares a copy of the test binary with given config in a temporary directory,
+// and returns a command which runs it as an agent with given args (and the path of its config)
+func agentProcess(t *testing.T, config string, args ...string) (cmd *exec.Cmd, configPath string) {
+	t.Helper()
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to get the test binary: %s", err)
+	}
+	binary, err := os.ReadFile(executable)
+	if err != nil {
+		t.Fatalf("failed to read the test binary: %s", err)
+	}
+
+	// (config is read from the directory of the executable)
+	dir := t.TempDir()
+	bin, configPath := filepath.Join(dir, "telegram-rpi-camera-bot"), filepath.Join(dir, configFilename)
+	if err := os.WriteFile(bin, binary, 0o755); err != nil {
+		t.Fatalf("failed to copy the test binary: %s", err)
+	}
+	if err := os.WriteFile(configPath, []byte(config), 0o644); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+
+	cmd = exec.Command(bin, append([]string{subcommandAgent}, args...)...)
+	cmd.Env = append(os.Environ(), envRunAsBot+"=1")
+
+	return cmd, configPath
+}
+
+// freeAddress returns a local address which is not used
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	return listener.Addr().String()
+}
+
+// waitForAgent waits until the agent at given url serves its cameras
+func waitForAgent(t *testing.T, url string) {
+	t.Helper()
+
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		req, _ := http.NewRequest(http.MethodGet, url+fleetCamerasPath, nil)
+		req.Header.Set("Authorization", "Bearer "+testFleetSecret)
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+		}
+	}
+	t.Fatalf("agent did not start at %s", url)
+}
+
+func TestAgentProcess(t *testing.T) {
+	addr := freeAddress(t)
+	url := "http://" + addr
+	cmd, configPath := agentProcess(t, fmt.Sprintf(testAgentConfig, 400), "-listen", addr)
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start agent: %s", err)
+	}
+	exited, stopped := make(chan error, 1), false
+	go func() { exited <- cmd.Wait() }()
+	defer func() {
+		if !stopped {
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+	}()
+
+	waitForAgent(t, url)
+
+	// bearer secret is needed
+	for _, authorization := range []string{"", "Bearer wrong-secret", testFleetSecret} {
+		req, _ := http.NewRequest(http.MethodGet, url+fleetCamerasPath, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to request: %s", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected unauthorized with '%s', got %s", authorization, resp.Status)
+		}
+	}
+
+	ctx := context.Background()
+	if captured, err := captureAgentImage(ctx, url, testFleetSecret, "", 0, 0, nil); err != nil {
+		t.Errorf("failed to capture: %s", err)
+	} else if size := decodeImageSize(t, captured); size != image.Pt(400, 300) {
+		t.Errorf("unexpected image size: %v", size)
+	}
+
+	// reloads config on SIGHUP (instead of being killed)
+	if err := os.WriteFile(configPath, []byte(fmt.Sprintf(testAgentConfig, 800)), 0o644); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+	if err := cmd.Process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatalf("failed to send SIGHUP: %s", err)
+	}
+	reloaded := false
+	for deadline := time.Now().Add(10 * time.Second); !reloaded && time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if captured, err := captureAgentImage(ctx, url, testFleetSecret, "", 0, 0, nil); err == nil {
+			reloaded = decodeImageSize(t, captured) == image.Pt(800, 300)
+		}
+	}
+	if !reloaded {
+		t.Errorf("config was not reloaded on SIGHUP")
+	}
+
+	// shuts down on SIGTERM
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("failed to send SIGTERM: %s", err)
+	}
+	select {
+	case err := <-exited:
+		stopped = true
+		if err != nil {
+			t.Errorf("agent exited with an error: %s\n%s", err, output.String())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("agent did not shut down")
+	}
+	if !strings.Contains(output.String(), "reloaded config (hangup)") {
+		t.Errorf("expected a log of reloading config, got:\n%s", output.String())
+	}
+}
+
+func TestAgentProcessFailures(t *testing.T) {
+	for name, test := range map[string]struct {
+		config   string
+		args     []string
+		expected string
+	}{
+		"unknown flag": {
+			config:   fmt.Sprintf(testAgentConfig, 400),
+			args:     []string{"-bogus"},
+			expected: "flag provided but not defined: -bogus",
+		},
+		"missing flag value": {
+			config:   fmt.Sprintf(testAgentConfig, 400),
+			args:     []string{"-listen"},
+			expected: "flag needs an argument: -listen",
+		},
+		"no fleet": {
+			config:   strings.Replace(fmt.Sprintf(testAgentConfig, 400), `"fleet": {"secret": "`+testFleetSecret+`"},`, "", 1),
+			expected: "`fleet` is not configured",
+		},
+		"invalid address": {
+			config:   fmt.Sprintf(testAgentConfig, 400),
+			args:     []string{"-listen", "127.0.0.1:-1"},
+			expected: "agent failed",
+		},
+	} {
+		cmd, _ := agentProcess(t, test.config, test.args...)
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Errorf("expected %s to fail", name)
+		}
+		if !strings.Contains(string(output), test.expected) {
+			t.Errorf("expected '%s' for %s, got:\n%s", test.expected, name, output)
+		}
+	}
+}
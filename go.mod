@@ -7,6 +7,7 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.37
 	github.com/meinside/telegram-bot-go v0.13.2
 	github.com/tailscale/hujson v0.0.0-20260302212456-ecc657c15afd
+	golang.org/x/image v0.38.0
 )
 
 require (
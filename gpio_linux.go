@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// constants of gpio character device uAPI (v2, <linux/gpio.h>)
+const (
+	gpioV2LinesMax        = 64
+	gpioMaxNameSize       = 32
+	gpioV2LineNumAttrsMax = 10
+
+	gpioV2LineFlagActiveLow    = 1 << 1
+	gpioV2LineFlagInput        = 1 << 2
+	gpioV2LineFlagOutput       = 1 << 3
+	gpioV2LineFlagEdgeRising   = 1 << 4
+	gpioV2LineFlagEdgeFalling  = 1 << 5
+	gpioV2LineFlagBiasPullUp   = 1 << 8
+	gpioV2LineFlagBiasPullDown = 1 << 9
+	gpioV2LineFlagBiasDisabled = 1 << 10
+
+	gpioV2LineAttrIDDebounce = 3
+
+	gpioV2LineEventRisingEdge = 1
+
+	// _IOWR(0xB4, 0x07, struct gpio_v2_line_request)
+	gpioV2GetLineIoctl = 0xC0000000 | (unsafe.Sizeof(gpioV2LineRequest{}) << 16) | (0xB4 << 8) | 0x07
+
+	// _IOWR(0xB4, 0x0F, struct gpio_v2_line_values)
+	gpioV2LineSetValuesIoctl = 0xC0000000 | (unsafe.Sizeof(gpioV2LineValues{}) << 16) | (0xB4 << 8) | 0x0F
+
+	gpioV2LineEventSize = 48
+)
+
+// struct gpio_v2_line_attribute
+//
+// (64-bit values are kept in byte arrays, for the same layout on 32-bit platforms)
+type gpioV2LineAttribute struct {
+	ID      uint32
+	Padding uint32
+	Value   [8]byte // union of flags, values, or debounce_period_us
+}
+
+// struct gpio_v2_line_config_attribute
+type gpioV2LineConfigAttribute struct {
+	Attr gpioV2LineAttribute
+	Mask [8]byte
+}
+
+// struct gpio_v2_line_config
+type gpioV2LineConfig struct {
+	Flags    [8]byte
+	NumAttrs uint32
+	Padding  [5]uint32
+	Attrs    [gpioV2LineNumAttrsMax]gpioV2LineConfigAttribute
+}
+
+// struct gpio_v2_line_request
+type gpioV2LineRequest struct {
+	Offsets         [gpioV2LinesMax]uint32
+	Consumer        [gpioMaxNameSize]byte
+	Config          gpioV2LineConfig
+	NumLines        uint32
+	EventBufferSize uint32
+	Padding         [5]uint32
+	Fd              int32
+}
+
+// struct gpio_v2_line_values
+type gpioV2LineValues struct {
+	Bits [8]byte
+	Mask [8]byte
+}
+
+// cdevGPIOChip is a gpio chip of linux character device (eg. /dev/gpiochip0)
+type cdevGPIOChip struct {
+	sync.Mutex
+
+	file  *os.File
+	lines []*os.File
+}
+
+// openCdevGPIOChip opens a gpio chip of given path
+func openCdevGPIOChip(path string) (GPIOChip, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cdevGPIOChip{file: file}, nil
+}
+
+// watch requests a line as an input with edge detection, and returns a channel of its edge events
+func (c *cdevGPIOChip) watch(line gpioLineConfig) (<-chan gpioEvent, error) {
+	var flags uint64 = gpioV2LineFlagInput
+	switch line.Edge {
+	case gpioEdgeRising:
+		flags |= gpioV2LineFlagEdgeRising
+	case gpioEdgeFalling:
+		flags |= gpioV2LineFlagEdgeFalling
+	default:
+		flags |= gpioV2LineFlagEdgeRising | gpioV2LineFlagEdgeFalling
+	}
+	switch line.Bias {
+	case gpioBiasPullUp:
+		flags |= gpioV2LineFlagBiasPullUp
+	case gpioBiasPullDown:
+		flags |= gpioV2LineFlagBiasPullDown
+	case gpioBiasDisabled:
+		flags |= gpioV2LineFlagBiasDisabled
+	}
+	if line.ActiveLow {
+		flags |= gpioV2LineFlagActiveLow
+	}
+
+	var req gpioV2LineRequest
+	req.Offsets[0] = uint32(line.Offset)
+	req.NumLines = 1
+	copy(req.Consumer[:gpioMaxNameSize-1], gpioConsumer)
+	binary.NativeEndian.PutUint64(req.Config.Flags[:], flags)
+	if line.Debounce > 0 {
+		req.Config.NumAttrs = 1
+		req.Config.Attrs[0].Attr.ID = gpioV2LineAttrIDDebounce
+		binary.NativeEndian.PutUint32(req.Config.Attrs[0].Attr.Value[:4], uint32(line.Debounce.Microseconds()))
+		binary.NativeEndian.PutUint64(req.Config.Attrs[0].Mask[:], 1) // (for the first line)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, c.file.Fd(), gpioV2GetLineIoctl, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return nil, fmt.Errorf("failed to request gpio line %d: %w", line.Offset, errno)
+	}
+
+	// (non-blocking, for closing it while reading)
+	if err := syscall.SetNonblock(int(req.Fd), true); err != nil {
+		_ = syscall.Close(int(req.Fd))
+		return nil, err
+	}
+	lineFile := os.NewFile(uintptr(req.Fd), fmt.Sprintf("%s:%d", c.file.Name(), line.Offset))
+	c.lines = append(c.lines, lineFile)
+
+	events := make(chan gpioEvent)
+	go func() {
+		defer close(events)
+
+		buf := make([]byte, gpioV2LineEventSize)
+		for {
+			if _, err := lineFile.Read(buf); err != nil {
+				if !errors.Is(err, os.ErrClosed) {
+					logError("failed to read event of gpio line %d: %s", line.Offset, err)
+				}
+				return
+			}
+
+			// struct gpio_v2_line_event (timestamp_ns is monotonic, so local time is used instead)
+			events <- gpioEvent{
+				Offset: int(binary.NativeEndian.Uint32(buf[12:16])),
+				Rising: binary.NativeEndian.Uint32(buf[8:12]) == gpioV2LineEventRisingEdge,
+				Time:   time.Now(),
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// output requests a line as an output (initially off)
+func (c *cdevGPIOChip) output(offset int, activeLow bool) (gpioOutput, error) {
+	var flags uint64 = gpioV2LineFlagOutput
+	if activeLow {
+		flags |= gpioV2LineFlagActiveLow
+	}
+
+	var req gpioV2LineRequest
+	req.Offsets[0] = uint32(offset)
+	req.NumLines = 1
+	copy(req.Consumer[:gpioMaxNameSize-1], gpioConsumer)
+	binary.NativeEndian.PutUint64(req.Config.Flags[:], flags)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, c.file.Fd(), gpioV2GetLineIoctl, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return nil, fmt.Errorf("failed to request gpio line %d: %w", offset, errno)
+	}
+	lineFile := os.NewFile(uintptr(req.Fd), fmt.Sprintf("%s:%d", c.file.Name(), offset))
+	c.lines = append(c.lines, lineFile)
+
+	return &cdevGPIOOutput{file: lineFile}, nil
+}
+
+// cdevGPIOOutput is an output line of a gpio character device
+type cdevGPIOOutput struct {
+	file *os.File
+}
+
+// set sets the value of the line
+func (o *cdevGPIOOutput) set(on bool) error {
+	var values gpioV2LineValues
+	if on {
+		binary.NativeEndian.PutUint64(values.Bits[:], 1)
+	}
+	binary.NativeEndian.PutUint64(values.Mask[:], 1)
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, o.file.Fd(), gpioV2LineSetValuesIoctl, uintptr(unsafe.Pointer(&values))); errno != 0 {
+		return fmt.Errorf("failed to set value of gpio line: %w", errno)
+	}
+
+	return nil
+}
+
+// close closes requested lines and the chip
+func (c *cdevGPIOChip) close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, line := range c.lines {
+		_ = line.Close()
+	}
+	c.lines = nil
+
+	return c.file.Close()
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+// openCdevGPIOChip is not supported on platforms other than linux
+func openCdevGPIOChip(path string) (GPIOChip, error) {
+	return nil, fmt.Errorf("gpio character device is not supported on this platform: %s", path)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"strings"
+)
+
+const (
+	// camera params for exposure bracketing
+	cameraParamShutter = "--shutter"
+
+	// well-exposedness of a pixel value (0.0 ~ 1.0) is weighted with a gaussian curve centered at 0.5
+	hdrWellExposedSigma = 0.2
+
+	// weight maps are smoothed with a box blur of radius = (longer side of the map) / ratio, for avoiding seams
+	hdrWeightBlurRatio = 100
+
+	// weight maps are downscaled to this size (of the longer side) at most
+	hdrWeightMapSize = 512
+
+	// small weight for avoiding division by zero
+	hdrWeightEpsilon = 1e-6
+
+	minHDRBrackets = 2
+)
+
+// default brackets for HDR capture: -2, 0, +2 EV
+var defaultHDRBrackets = []hdrBracket{
+	{EV: evPtr(-2)},
+	{EV: evPtr(0)},
+	{EV: evPtr(2)},
+}
+
+// hdrConfig is a configuration for HDR (exposure-bracketing) capture
+type hdrConfig struct {
+	Brackets   []hdrBracket `json:"brackets,omitempty"` // default: -2, 0, +2 EV
+	SendFrames bool         `json:"send_frames"`        // also send the bracketed frames as an album
+}
+
+// hdrBracket is an exposure of bracketed captures
+type hdrBracket struct {
+	EV      *float64 `json:"ev,omitempty"`      // exposure compensation
+	Shutter int      `json:"shutter,omitempty"` // shutter speed in microseconds (0 for auto)
+}
+
+// validate checks if the hdr config has valid values
+func (c hdrConfig) validate() error {
+	if len(c.Brackets) > 0 && len(c.Brackets) < minHDRBrackets {
+		return fmt.Errorf("at least %d brackets are needed for HDR capture: %d", minHDRBrackets, len(c.Brackets))
+	}
+	if len(c.Brackets) > maxBurstCount {
+		return fmt.Errorf("too many brackets for HDR capture (max: %d): %d", maxBurstCount, len(c.Brackets))
+	}
+	for _, bracket := range c.Brackets {
+		if bracket.EV == nil && bracket.Shutter <= 0 {
+			return fmt.Errorf("bracket should have `ev` or `shutter`")
+		}
+		if bracket.Shutter < 0 {
+			return fmt.Errorf("shutter speed should not be negative: %d", bracket.Shutter)
+		}
+	}
+
+	return nil
+}
+
+// brackets returns the configured brackets, or the default ones
+func (c *hdrConfig) brackets() []hdrBracket {
+	if c == nil || len(c.Brackets) <= 0 {
+		return defaultHDRBrackets
+	}
+
+	return c.Brackets
+}
+
+// cameraParams returns a copy of camera params with the exposure of this bracket
+func (b hdrBracket) cameraParams(params map[string]any) map[string]any {
+	params = cloneCameraParams(params)
+	if b.EV != nil {
+		params[cameraParamEV] = *b.EV
+	}
+	if b.Shutter > 0 {
+		params[cameraParamShutter] = b.Shutter
+	}
+
+	return params
+}
+
+// String returns a short description of this bracket (eg. "EV +2, 1/125s")
+func (b hdrBracket) String() string {
+	descriptions := []string{}
+	if b.EV != nil {
+		descriptions = append(descriptions, fmt.Sprintf("EV %+g", *b.EV))
+	}
+	if b.Shutter > 0 {
+		if b.Shutter < 1000000 {
+			descriptions = append(descriptions, fmt.Sprintf("1/%.0fs", 1000000/float64(b.Shutter)))
+		} else {
+			descriptions = append(descriptions, fmt.Sprintf("%gs", float64(b.Shutter)/1000000))
+		}
+	}
+
+	return strings.Join(descriptions, ", ")
+}
+
+// evPtr returns a pointer of given exposure compensation value
+func evPtr(ev float64) *float64 {
+	return &ev
+}
+
+// captureHDRImage captures bracketed still images and fuses them into a single jpeg image
+//
+// the exif metadata of the bracket closest to the neutral exposure is kept in the fused image
+func captureHDRImage(
+	capture func(cameraParams map[string]any) ([]byte, error),
+	cameraParams map[string]any,
+	brackets []hdrBracket,
+) (fused []byte, frames [][]byte, err error) {
+	for _, bracket := range brackets {
+		var frame []byte
+		if frame, err = capture(bracket.cameraParams(cameraParams)); err != nil {
+			return nil, nil, fmt.Errorf("failed to capture bracket (%s): %w", bracket, err)
+		}
+		frames = append(frames, frame)
+	}
+
+	if fused, err = fuseExposures(frames); err != nil {
+		return nil, nil, err
+	}
+
+	// keep the exif metadata of the reference frame
+	reference, closest := 0, math.Inf(1)
+	for i, bracket := range brackets {
+		ev := 0.0
+		if bracket.EV != nil {
+			ev = *bracket.EV
+		}
+		if math.Abs(ev) < closest {
+			reference, closest = i, math.Abs(ev)
+		}
+	}
+	if payload := extractExif(frames[reference]); payload != nil {
+		if withExif, err := replaceExif(fused, payload); err == nil {
+			fused = withExif
+		} else {
+			logError("failed to copy exif metadata to the fused image: %s", err)
+		}
+	}
+
+	return fused, frames, nil
+}
+
+// fuseExposures merges differently-exposed jpeg images into a single jpeg image
+//
+// (a simplified exposure fusion: each pixel is averaged with weights of its well-exposedness,
+// and the weight maps are smoothed for avoiding visible seams between the regions;
+// weight maps are kept downscaled and interpolated while fusing, for saving memory with large images)
+func fuseExposures(frames [][]byte) ([]byte, error) {
+	if len(frames) <= 0 {
+		return nil, fmt.Errorf("no frames to fuse")
+	}
+
+	images := []*image.RGBA{}
+	for i, frame := range frames {
+		img, err := jpeg.Decode(bytes.NewReader(frame))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode frame #%d: %w", i+1, err)
+		}
+		rgba := toRGBA(img)
+		if len(images) > 0 && rgba.Rect.Size() != images[0].Rect.Size() {
+			return nil, fmt.Errorf("size of frame #%d differs: %s vs %s", i+1, rgba.Rect.Size(), images[0].Rect.Size())
+		}
+		images = append(images, rgba)
+	}
+	if len(images) == 1 {
+		return frames[0], nil
+	}
+
+	width, height := images[0].Rect.Dx(), images[0].Rect.Dy()
+
+	// downscaled weight maps of each frame
+	scale := max((max(width, height)+hdrWeightMapSize-1)/hdrWeightMapSize, 1)
+	mapWidth, mapHeight := (width+scale-1)/scale, (height+scale-1)/scale
+	weights := make([]*weightMap, len(images))
+	for i, img := range images {
+		weights[i] = newWeightMap(img, scale, mapWidth, mapHeight)
+	}
+
+	// weighted average of the frames (with weights interpolated row by row)
+	fused := image.NewRGBA(image.Rect(0, 0, width, height))
+	rows := make([][]float32, len(images))
+	for i := range rows {
+		rows[i] = make([]float32, width)
+	}
+	for y := range height {
+		for i, weight := range weights {
+			weight.interpolateRow(rows[i], y)
+		}
+
+		for x := range width {
+			var sum float32
+			for i := range images {
+				sum += rows[i][x]
+			}
+
+			dst := y*fused.Stride + x*4
+			for c := range 3 {
+				var v float32
+				for i, img := range images {
+					v += float32(img.Pix[y*img.Stride+x*4+c]) * rows[i][x]
+				}
+				fused.Pix[dst+c] = uint8(min(math.Round(float64(v/sum)), 255))
+			}
+			fused.Pix[dst+3] = 0xff
+		}
+	}
+
+	return encodeJPEG(fused, defaultJPEGQuality)
+}
+
+// weightMap is a downscaled map of well-exposedness weights of an image
+type weightMap struct {
+	values        []float32
+	width, height int
+	scale         int // (number of pixels of the image per cell, in each direction)
+}
+
+// newWeightMap builds a smoothed `width` x `height` weight map of given image,
+// with each cell averaging the weights of its `scale` x `scale` pixels
+func newWeightMap(img *image.RGBA, scale, width, height int) *weightMap {
+	values := make([]float32, width*height)
+	counts := make([]float32, width*height)
+	bounds := img.Rect.Size()
+	for y := range bounds.Y {
+		for x := range bounds.X {
+			offset := y*img.Stride + x*4
+			weight := 1.0
+			for c := range 3 {
+				v := float64(img.Pix[offset+c])/255 - 0.5
+				weight *= math.Exp(-v * v / (2 * hdrWellExposedSigma * hdrWellExposedSigma))
+			}
+
+			cell := (y/scale)*width + x/scale
+			values[cell] += float32(weight)
+			counts[cell]++
+		}
+	}
+	for i := range values {
+		values[i] = values[i]/counts[i] + hdrWeightEpsilon
+	}
+	boxBlur(values, width, height, max(width, height)/hdrWeightBlurRatio)
+
+	return &weightMap{values: values, width: width, height: height, scale: scale}
+}
+
+// interpolateRow fills `row` with (bilinearly) interpolated weights of the `y`th row of the image
+func (m *weightMap) interpolateRow(row []float32, y int) {
+	// position of the pixel center in the map, and its neighboring cells
+	position := func(v, n int) (from, to int, frac float32) {
+		p := max((float32(v)+0.5)/float32(m.scale)-0.5, 0)
+		from = min(int(p), n-1)
+		to = min(from+1, n-1)
+		return from, to, p - float32(from)
+	}
+
+	top, bottom, fy := position(y, m.height)
+	for x := range row {
+		left, right, fx := position(x, m.width)
+		upper := m.values[top*m.width+left]*(1-fx) + m.values[top*m.width+right]*fx
+		lower := m.values[bottom*m.width+left]*(1-fx) + m.values[bottom*m.width+right]*fx
+		row[x] = upper*(1-fy) + lower*fy
+	}
+}
+
+// boxBlur blurs given values of a `width` x `height` map in place
+func boxBlur(values []float32, width, height, radius int) {
+	if radius <= 0 {
+		return
+	}
+
+	blur := func(get func(i int) float32, set func(i int, v float32), n int) {
+		prefix := make([]float32, n+1)
+		for i := range n {
+			prefix[i+1] = prefix[i] + get(i)
+		}
+		for i := range n {
+			from, to := max(i-radius, 0), min(i+radius+1, n)
+			set(i, (prefix[to]-prefix[from])/float32(to-from))
+		}
+	}
+
+	// horizontally
+	for y := range height {
+		row := values[y*width : (y+1)*width]
+		blur(func(i int) float32 { return row[i] }, func(i int, v float32) { row[i] = v }, width)
+	}
+
+	// vertically
+	for x := range width {
+		blur(func(i int) float32 { return values[i*width+x] }, func(i int, v float32) { values[i*width+x] = v }, height)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+)
+
+// gray returns an opaque gray color of given value
+func gray(v uint8) color.RGBA {
+	return color.RGBA{R: v, G: v, B: v, A: 255}
+}
+
+func TestFuseExposures(t *testing.T) {
+	// (larger than the weight map, for testing interpolation of downscaled weights)
+	width, height := 1200, 300
+
+	// well exposed on the left half of the dark frame, and on the right half of the bright one
+	dark := testJPEG(t, width, height, func(x, y int) color.RGBA {
+		if x < width/2 {
+			return gray(128)
+		}
+		return gray(5)
+	})
+	bright := testJPEG(t, width, height, func(x, y int) color.RGBA {
+		if x < width/2 {
+			return gray(250)
+		}
+		return gray(128)
+	})
+
+	fused, err := fuseExposures([][]byte{dark, bright})
+	if err != nil {
+		t.Fatalf("failed to fuse exposures: %s", err)
+	}
+	img := decodeTestJPEG(t, fused)
+	if size := img.Bounds().Size(); size.X != width || size.Y != height {
+		t.Errorf("unexpected size: %s", size)
+	}
+	for _, x := range []int{0, width / 4, width * 3 / 4, width - 1} {
+		for _, y := range []int{0, height / 2, height - 1} {
+			if !isCloseTo(img, x, y, gray(128)) {
+				t.Errorf("expected well exposed pixel at (%d, %d), got %v", x, y, img.At(x, y))
+			}
+		}
+	}
+
+	// a single frame is returned as it is
+	if fused, err := fuseExposures([][]byte{dark}); err != nil || !bytes.Equal(fused, dark) {
+		t.Errorf("expected the frame itself (%v)", err)
+	}
+}
+
+func TestFuseExposuresErrors(t *testing.T) {
+	if _, err := fuseExposures(nil); err == nil || err.Error() != "no frames to fuse" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	frame := testJPEG(t, 40, 20, func(x, y int) color.RGBA { return gray(128) })
+	smaller := testJPEG(t, 20, 20, func(x, y int) color.RGBA { return gray(128) })
+	if _, err := fuseExposures([][]byte{frame, smaller}); err == nil || err.Error() != "size of frame #2 differs: (20,20) vs (40,20)" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := fuseExposures([][]byte{frame, []byte("not a jpeg")}); err == nil || err.Error() != "failed to decode frame #2: invalid JPEG format: missing SOI marker" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// default values for the health watchdog
+	defaultHealthIntervalSeconds   = 60
+	defaultHealthCaptureFailures   = 3
+	defaultHealthMaxTemperature    = 80.0
+	defaultHealthMinFreeDiskMB     = 512
+	defaultHealthMaxCaptureSeconds = 300
+
+	// files and commands for checking the SoC
+	healthTemperatureFile = "/sys/class/thermal/thermal_zone0/temp"
+	vcgencmdBin           = "vcgencmd"
+	vcgencmdTimeout       = 5 * time.Second // (for not blocking the watchdog with a hung `vcgencmd`)
+
+	// bits of `vcgencmd get_throttled`
+	throttledUnderVoltage = 1 << 0
+	throttledFreqCapped   = 1 << 1
+	throttledThrottling   = 1 << 2
+)
+
+// healthConfig is a configuration of the health watchdog
+type healthConfig struct {
+	// chats which are always warned (along with the ones which subscribed `health`)
+	AdminChats []int64 `json:"admin_chats,omitempty"`
+
+	IntervalSeconds    int     `json:"interval_seconds,omitempty"`    // interval of checks (default: 60)
+	CaptureFailures    int     `json:"capture_failures,omitempty"`    // warn after this many failures in a row (default: 3)
+	MaxTemperature     float64 `json:"max_temperature,omitempty"`     // in celsius (default: 80)
+	MinFreeDiskMB      int     `json:"min_free_disk_mb,omitempty"`    // of the database and archive (default: 512)
+	MaxCaptureSeconds  int     `json:"max_capture_seconds,omitempty"` // capture worker is stuck after this time (default: 300)
+	TemperatureFile    string  `json:"temperature_file,omitempty"`    // (default: "/sys/class/thermal/thermal_zone0/temp")
+	TemperatureDivisor float64 `json:"temperature_divisor,omitempty"` // (default: 1000)
+}
+
+// validate checks if the health config has valid values
+func (c healthConfig) validate() error {
+	if c.IntervalSeconds < 0 || c.CaptureFailures < 0 || c.MaxTemperature < 0 || c.MinFreeDiskMB < 0 || c.MaxCaptureSeconds < 0 || c.TemperatureDivisor < 0 {
+		return fmt.Errorf("values of health watchdog should not be negative")
+	}
+
+	return nil
+}
+
+// interval returns the interval of checks
+func (c healthConfig) interval() time.Duration {
+	if c.IntervalSeconds <= 0 {
+		return defaultHealthIntervalSeconds * time.Second
+	}
+	return time.Duration(c.IntervalSeconds) * time.Second
+}
+
+// captureFailures returns the number of capture failures in a row for warning
+func (c healthConfig) captureFailures() int {
+	if c.CaptureFailures <= 0 {
+		return defaultHealthCaptureFailures
+	}
+	return c.CaptureFailures
+}
+
+// maxTemperature returns the maximum temperature of the SoC
+func (c healthConfig) maxTemperature() float64 {
+	if c.MaxTemperature <= 0 {
+		return defaultHealthMaxTemperature
+	}
+	return c.MaxTemperature
+}
+
+// minFreeDisk returns the minimum free disk space in bytes
+func (c healthConfig) minFreeDisk() uint64 {
+	if c.MinFreeDiskMB <= 0 {
+		return defaultHealthMinFreeDiskMB << 20
+	}
+	return uint64(c.MinFreeDiskMB) << 20
+}
+
+// maxCapture returns the time after which the capture worker is considered stuck
+func (c healthConfig) maxCapture() time.Duration {
+	if c.MaxCaptureSeconds <= 0 {
+		return defaultHealthMaxCaptureSeconds * time.Second
+	}
+	return time.Duration(c.MaxCaptureSeconds) * time.Second
+}
+
+// temperatureFile returns the sensor file of the SoC temperature
+func (c healthConfig) temperatureFile() string {
+	if c.TemperatureFile == "" {
+		return healthTemperatureFile
+	}
+	return c.TemperatureFile
+}
+
+// watchdog checks the health of the bot periodically, and warns about problems
+type watchdog struct {
+	sync.Mutex
+
+	config    healthConfig
+	diskPaths []string // for checking free disk space
+
+	failures         map[string]int   // capture failures in a row, by camera
+	lastErrors       map[string]error // last capture errors, by camera
+	captureStartedAt time.Time        // zero if the capture worker is idle
+	queued           func() int       // returns the number of queued capture requests
+
+	problems map[string]string // current problems (key: kind of the problem, value: detail)
+}
+
+// newWatchdog returns a new health watchdog
+func newWatchdog(config healthConfig, diskPaths []string, queued func() int) *watchdog {
+	return &watchdog{
+		config:     config,
+		diskPaths:  diskPaths,
+		queued:     queued,
+		failures:   map[string]int{},
+		lastErrors: map[string]error{},
+		problems:   map[string]string{},
+	}
+}
+
+// recordCapture records the result of a capture with given camera (canceled ones are ignored)
+func (w *watchdog) recordCapture(cameraName string, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	if err != nil {
+		w.failures[cameraName]++
+		w.lastErrors[cameraName] = err
+	} else {
+		delete(w.failures, cameraName)
+		delete(w.lastErrors, cameraName)
+	}
+}
+
+// captureStarted marks the capture worker as busy
+func (w *watchdog) captureStarted() {
+	w.Lock()
+	defer w.Unlock()
+
+	w.captureStartedAt = time.Now()
+}
+
+// captureFinished marks the capture worker as idle
+func (w *watchdog) captureFinished() {
+	w.Lock()
+	defer w.Unlock()
+
+	w.captureStartedAt = time.Time{}
+}
+
+// watch checks the health periodically, and calls `warn` with changes of problems (never returns)
+func (w *watchdog) watch(warn func(text string)) {
+	ticker := time.NewTicker(w.config.interval())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, text := range w.check() {
+			logError("[health] %s", text)
+			warn(text)
+		}
+	}
+}
+
+// check checks the health, and returns texts of new and resolved problems
+func (w *watchdog) check() (texts []string) {
+	current := map[string]string{}
+
+	// capture failures in a row
+	w.Lock()
+	for name, count := range w.failures {
+		if count >= w.config.captureFailures() {
+			current["capture:"+name] = fmt.Sprintf("Capture with camera '%s' failed %d times in a row: %s", name, count, w.lastErrors[name])
+		}
+	}
+	startedAt := w.captureStartedAt
+	w.Unlock()
+
+	// stuck capture worker
+	if !startedAt.IsZero() {
+		if busy := time.Since(startedAt); busy >= w.config.maxCapture() {
+			current["worker"] = fmt.Sprintf("Capture worker has been busy for %s (%d request(s) queued)", busy.Round(time.Second), w.queued())
+		}
+	}
+
+	// SoC temperature
+	if temperature, err := readTemperature(w.config.temperatureFile(), w.config.TemperatureDivisor); err == nil {
+		if temperature >= w.config.maxTemperature() {
+			current["temperature"] = fmt.Sprintf("SoC is overheating: %.1f°C", temperature)
+		}
+	}
+
+	// under-voltage and throttling
+	if throttled, err := readThrottled(); err == nil {
+		if throttled&throttledUnderVoltage != 0 {
+			current["voltage"] = fmt.Sprintf("Under-voltage detected (throttled=0x%x)", throttled)
+		}
+		if throttled&(throttledFreqCapped|throttledThrottling) != 0 {
+			current["throttling"] = fmt.Sprintf("SoC is throttled (throttled=0x%x)", throttled)
+		}
+	}
+
+	// free disk space
+	for _, path := range w.diskPaths {
+		if free, err := freeDiskSpace(path); err != nil {
+			if !errors.Is(err, errors.ErrUnsupported) {
+				logError("failed to check free disk space of %s: %s", path, err)
+			}
+		} else if free < w.config.minFreeDisk() {
+			current["disk:"+path] = fmt.Sprintf("Low disk space on %s: %.1f MB left", path, float64(free)/1024/1024)
+		}
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	for _, key := range slices.Sorted(maps.Keys(current)) {
+		if _, exists := w.problems[key]; !exists {
+			texts = append(texts, "⚠️ "+current[key])
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(w.problems)) {
+		if _, exists := current[key]; !exists {
+			texts = append(texts, "✅ Recovered: "+w.problems[key])
+		}
+	}
+	w.problems = current
+
+	return texts
+}
+
+// readThrottled reads the throttled state of the SoC with `vcgencmd get_throttled`
+func readThrottled() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), vcgencmdTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, vcgencmdBin, "get_throttled").Output()
+	if err != nil {
+		return 0, err
+	}
+
+	// eg. "throttled=0x50005"
+	_, value, ok := strings.Cut(strings.TrimSpace(string(output)), "=")
+	if !ok {
+		return 0, fmt.Errorf("malformed output of vcgencmd: %s", output)
+	}
+
+	return strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, 64)
+}
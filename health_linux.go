@@ -0,0 +1,15 @@
+package main
+
+import (
+	"syscall"
+)
+
+// freeDiskSpace returns the free disk space (available to unprivileged users) of the filesystem of given path
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// freeDiskSpace is not supported on platforms other than linux
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
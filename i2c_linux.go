@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ioctl request for setting the address of I2C slave device
+const i2cSlave = 0x0703
+
+// openI2CDevice opens an I2C device of given bus and address
+func openI2CDevice(bus, address int) (*os.File, error) {
+	file, err := os.OpenFile(fmt.Sprintf("/dev/i2c-%d", bus), os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open I2C bus %d: %w", bus, err)
+	}
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), i2cSlave, uintptr(address)); errno != 0 {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to set I2C address 0x%02x: %w", address, errno)
+	}
+
+	return file, nil
+}
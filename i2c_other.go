@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// openI2CDevice is not supported on platforms other than linux
+func openI2CDevice(bus, address int) (*os.File, error) {
+	return nil, fmt.Errorf("I2C is not supported on this platform")
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"strconv"
+	"strings"
+)
+
+const (
+	// types of processing steps
+	stepRotate     = "rotate"
+	stepCrop       = "crop"
+	stepResize     = "resize"
+	stepAutoLevels = "autolevels"
+	stepQuality    = "quality"
+
+	// default jpeg quality for re-encoding
+	defaultJPEGQuality = 90
+
+	// ratio of pixels to be clipped on each side of the histogram when auto-leveling
+	autoLevelsClipRatio = 0.005
+)
+
+// processingStep is a step of the image post-processing pipeline
+type processingStep struct {
+	Type string `json:"type"`
+
+	// for `rotate` (clockwise; 90, 180, or 270)
+	Degrees int `json:"degrees,omitempty"`
+
+	// for `crop` (region in ratios of the image size: 0.0 ~ 1.0)
+	X float64 `json:"x,omitempty"`
+	Y float64 `json:"y,omitempty"`
+
+	// for `crop` (in ratios: 0.0 ~ 1.0) and `resize` (in pixels, fitted while keeping aspect ratio; 0 for unbounded)
+	Width  float64 `json:"width,omitempty"`
+	Height float64 `json:"height,omitempty"`
+
+	// for `quality` (jpeg quality of re-encoding: 1 ~ 100)
+	Quality int `json:"quality,omitempty"`
+}
+
+// validate checks if the step has valid values
+func (s processingStep) validate() error {
+	switch s.Type {
+	case stepRotate:
+		switch s.Degrees {
+		case 90, 180, 270:
+			return nil
+		}
+		return fmt.Errorf("rotation should be one of 90, 180, or 270: %d", s.Degrees)
+	case stepCrop:
+		if s.X < 0 || s.Y < 0 || s.Width <= 0 || s.Height <= 0 || s.X+s.Width > 1 || s.Y+s.Height > 1 {
+			return fmt.Errorf("crop region should be within 0.0 ~ 1.0: %g,%g,%g,%g", s.X, s.Y, s.Width, s.Height)
+		}
+		return nil
+	case stepResize:
+		if s.Width < 0 || s.Height < 0 || (s.Width == 0 && s.Height == 0) {
+			return fmt.Errorf("malformed resize size: %gx%g", s.Width, s.Height)
+		}
+		return nil
+	case stepAutoLevels:
+		return nil
+	case stepQuality:
+		if s.Quality < 1 || s.Quality > 100 {
+			return fmt.Errorf("jpeg quality should be within 1 ~ 100: %d", s.Quality)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown processing step: %s", s.Type)
+	}
+}
+
+// parseProcessingStep parses a processing step from given text
+//
+// eg. "rotate:90", "crop:0.25,0.25,0.5,0.5", "resize:640x480", "resize:640x", "autolevels", "quality:80"
+func parseProcessingStep(str string) (step processingStep, err error) {
+	name, param, _ := strings.Cut(strings.ToLower(strings.TrimSpace(str)), ":")
+	step.Type = name
+
+	switch name {
+	case stepRotate:
+		if step.Degrees, err = strconv.Atoi(param); err != nil {
+			return step, fmt.Errorf("malformed rotation: %s", param)
+		}
+	case stepCrop:
+		values := strings.Split(param, ",")
+		if len(values) != 4 {
+			return step, fmt.Errorf("malformed crop region: %s", param)
+		}
+		ptrs := []*float64{&step.X, &step.Y, &step.Width, &step.Height}
+		for i, v := range values {
+			if *ptrs[i], err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				return step, fmt.Errorf("malformed crop region: %s", param)
+			}
+		}
+	case stepResize:
+		w, h, found := strings.Cut(param, "x")
+		if !found {
+			return step, fmt.Errorf("malformed resize size: %s", param)
+		}
+		if w != "" {
+			if step.Width, err = strconv.ParseFloat(w, 64); err != nil {
+				return step, fmt.Errorf("malformed resize width: %s", w)
+			}
+		}
+		if h != "" {
+			if step.Height, err = strconv.ParseFloat(h, 64); err != nil {
+				return step, fmt.Errorf("malformed resize height: %s", h)
+			}
+		}
+	case stepQuality:
+		if step.Quality, err = strconv.Atoi(param); err != nil {
+			return step, fmt.Errorf("malformed jpeg quality: %s", param)
+		}
+	}
+
+	return step, step.validate()
+}
+
+// processImage applies given steps (and overlay text lines, if any) to the jpeg bytes,
+// and returns the re-encoded jpeg bytes
+//
+// (given bytes are returned as they are if there is nothing to do)
+func processImage(jpegBytes []byte, steps []processingStep, overlay *overlayConfig, overlayLines []string) ([]byte, error) {
+	if len(steps) <= 0 && (overlay == nil || len(overlayLines) <= 0) {
+		return jpegBytes, nil
+	}
+
+	decoded, err := jpeg.Decode(bytes.NewReader(jpegBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %s", err)
+	}
+	img := toRGBA(decoded)
+
+	quality := defaultJPEGQuality
+	for _, step := range steps {
+		if err := step.validate(); err != nil {
+			return nil, err
+		}
+
+		switch step.Type {
+		case stepRotate:
+			img = rotateImage(img, step.Degrees)
+		case stepCrop:
+			img = cropImage(img, step.X, step.Y, step.Width, step.Height)
+		case stepResize:
+			img = resizeImage(img, int(step.Width), int(step.Height))
+		case stepAutoLevels:
+			autoLevelImage(img)
+		case stepQuality:
+			quality = step.Quality
+		}
+	}
+
+	if overlay != nil {
+		if err := drawOverlay(img, overlayLines, *overlay); err != nil {
+			return nil, err
+		}
+	}
+
+	return encodeJPEG(img, quality)
+}
+
+// encodeJPEG encodes given image as jpeg with given quality
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %s", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// toRGBA converts given image to a zero-origin *image.RGBA
+func toRGBA(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+
+	return dst
+}
+
+// rotateImage rotates given image clockwise by 90, 180, or 270 degrees
+func rotateImage(src *image.RGBA, degrees int) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	var dst *image.RGBA
+	if degrees == 180 {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := range h {
+		for x := range w {
+			si := src.PixOffset(x, y)
+
+			var dx, dy int
+			switch degrees {
+			case 90:
+				dx, dy = h-1-y, x
+			case 180:
+				dx, dy = w-1-x, h-1-y
+			case 270:
+				dx, dy = y, w-1-x
+			}
+			di := dst.PixOffset(dx, dy)
+
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
+
+// cropImage crops given region (in ratios of the image size) of the image
+func cropImage(src *image.RGBA, x, y, width, height float64) *image.RGBA {
+	w, h := float64(src.Rect.Dx()), float64(src.Rect.Dy())
+
+	region := image.Rect(
+		int(x*w), int(y*h),
+		int((x+width)*w), int((y+height)*h),
+	).Intersect(src.Rect)
+	if region.Empty() {
+		return src
+	}
+
+	return toRGBA(src.SubImage(region))
+}
+
+// resizeImage resizes given image to fit in `maxWidth` x `maxHeight` while keeping its aspect ratio
+// (0 means unbounded)
+func resizeImage(src *image.RGBA, maxWidth, maxHeight int) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	scale := 0.0
+	if maxWidth > 0 {
+		scale = float64(maxWidth) / float64(w)
+	}
+	if maxHeight > 0 {
+		if s := float64(maxHeight) / float64(h); scale == 0 || s < scale {
+			scale = s
+		}
+	}
+	dw, dh := max(int(float64(w)*scale+0.5), 1), max(int(float64(h)*scale+0.5), 1)
+	if dw == w && dh == h {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	// average all source pixels covered by each destination pixel (box filter),
+	// which works well for both down- and up-scaling
+	for dy := range dh {
+		sy0 := dy * h / dh
+		sy1 := max((dy+1)*h/dh, sy0+1)
+
+		for dx := range dw {
+			sx0 := dx * w / dw
+			sx1 := max((dx+1)*w/dw, sx0+1)
+
+			var r, g, b, a, n int
+			for sy := sy0; sy < sy1; sy++ {
+				i := src.PixOffset(sx0, sy)
+				for sx := sx0; sx < sx1; sx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+
+			di := dst.PixOffset(dx, dy)
+			dst.Pix[di] = uint8(r / n)
+			dst.Pix[di+1] = uint8(g / n)
+			dst.Pix[di+2] = uint8(b / n)
+			dst.Pix[di+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// autoLevelImage stretches each color channel of given image to the full range, in place
+func autoLevelImage(img *image.RGBA) {
+	var histograms [3][256]int
+	for i := 0; i < len(img.Pix); i += 4 {
+		histograms[0][img.Pix[i]]++
+		histograms[1][img.Pix[i+1]]++
+		histograms[2][img.Pix[i+2]]++
+	}
+
+	numPixels := len(img.Pix) / 4
+	clip := int(float64(numPixels) * autoLevelsClipRatio)
+
+	var tables [3][256]uint8
+	for c := range 3 {
+		low, high := 0, 255
+		for sum := 0; low < 255; low++ {
+			if sum += histograms[c][low]; sum > clip {
+				break
+			}
+		}
+		for sum := 0; high > 0; high-- {
+			if sum += histograms[c][high]; sum > clip {
+				break
+			}
+		}
+
+		for v := range 256 {
+			switch {
+			case high <= low:
+				tables[c][v] = uint8(v)
+			case v <= low:
+				tables[c][v] = 0
+			case v >= high:
+				tables[c][v] = 255
+			default:
+				tables[c][v] = uint8((v - low) * 255 / (high - low))
+			}
+		}
+	}
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i] = tables[0][img.Pix[i]]
+		img.Pix[i+1] = tables[1][img.Pix[i+1]]
+		img.Pix[i+2] = tables[2][img.Pix[i+2]]
+	}
+}
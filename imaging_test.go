@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// testJPEG generates a jpeg image of given size, colored by `colorAt`
+func testJPEG(t *testing.T, width, height int, colorAt func(x, y int) color.RGBA) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetRGBA(x, y, colorAt(x, y))
+		}
+	}
+
+	bytes, err := encodeJPEG(img, 100)
+	if err != nil {
+		t.Fatalf("failed to encode test image: %s", err)
+	}
+
+	return bytes
+}
+
+// decodeTestJPEG decodes given jpeg bytes
+func decodeTestJPEG(t *testing.T, jpegBytes []byte) image.Image {
+	t.Helper()
+
+	img, err := jpeg.Decode(bytes.NewReader(jpegBytes))
+	if err != nil {
+		t.Fatalf("failed to decode processed image: %s", err)
+	}
+
+	return img
+}
+
+// returns if the pixel at given point is close to given color (allowing jpeg artifacts)
+func isCloseTo(img image.Image, x, y int, c color.RGBA) bool {
+	r, g, b, _ := img.At(x, y).RGBA()
+
+	near := func(v uint32, expected uint8) bool {
+		d := int(v>>8) - int(expected)
+		return d > -32 && d < 32
+	}
+
+	return near(r, c.R) && near(g, c.G) && near(b, c.B)
+}
+
+var (
+	testRed  = color.RGBA{R: 255, A: 255}
+	testBlue = color.RGBA{B: 255, A: 255}
+)
+
+// 40x20 image: red on the left half, blue on the right half
+func halfRedHalfBlue(t *testing.T) []byte {
+	return testJPEG(t, 40, 20, func(x, y int) color.RGBA {
+		if x < 20 {
+			return testRed
+		}
+		return testBlue
+	})
+}
+
+func TestParseProcessingStep(t *testing.T) {
+	valid := map[string]processingStep{
+		"rotate:90":              {Type: stepRotate, Degrees: 90},
+		"ROTATE:270":             {Type: stepRotate, Degrees: 270},
+		"crop:0.25,0.25,0.5,0.5": {Type: stepCrop, X: 0.25, Y: 0.25, Width: 0.5, Height: 0.5},
+		"resize:640x480":         {Type: stepResize, Width: 640, Height: 480},
+		"resize:640x":            {Type: stepResize, Width: 640},
+		"resize:x480":            {Type: stepResize, Height: 480},
+		"autolevels":             {Type: stepAutoLevels},
+		"quality:80":             {Type: stepQuality, Quality: 80},
+	}
+	for str, expected := range valid {
+		step, err := parseProcessingStep(str)
+		if err != nil {
+			t.Errorf("failed to parse '%s': %s", str, err)
+		} else if step != expected {
+			t.Errorf("expected %+v from '%s', got %+v", expected, str, step)
+		}
+	}
+
+	invalid := map[string]string{
+		"rotate:abc":          "malformed rotation: abc",
+		"rotate:45":           "rotation should be one of 90, 180, or 270: 45",
+		"crop:0.1,0.2":        "malformed crop region: 0.1,0.2",
+		"crop:0.1,0.2,a,0.5":  "malformed crop region: 0.1,0.2,a,0.5",
+		"crop:0.5,0.5,0.6,.5": "crop region should be within 0.0 ~ 1.0: 0.5,0.5,0.6,0.5",
+		"resize:640":          "malformed resize size: 640",
+		"resize:abcx480":      "malformed resize width: abc",
+		"resize:640xabc":      "malformed resize height: abc",
+		"resize:x":            "malformed resize size: 0x0",
+		"quality:high":        "malformed jpeg quality: high",
+		"quality:0":           "jpeg quality should be within 1 ~ 100: 0",
+		"sharpen":             "unknown processing step: sharpen",
+	}
+	for str, expected := range invalid {
+		if _, err := parseProcessingStep(str); err == nil {
+			t.Errorf("expected an error for '%s'", str)
+		} else if err.Error() != expected {
+			t.Errorf("expected error '%s' for '%s', got '%s'", expected, str, err)
+		}
+	}
+}
+
+func TestProcessingPresets(t *testing.T) {
+	var presets map[string][]processingStep
+	if err := json.Unmarshal([]byte(`{
+		"thumbnail": [{"type": "resize", "width": 320}, {"type": "quality", "quality": 70}],
+		"upside_down": [{"type": "rotate", "degrees": 180}],
+		"tilted": [{"type": "rotate", "degrees": 45}]
+	}`), &presets); err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range presets["thumbnail"] {
+		if err := step.validate(); err != nil {
+			t.Errorf("unexpected error for thumbnail preset: %s", err)
+		}
+	}
+	if err := presets["tilted"][0].validate(); err == nil {
+		t.Errorf("expected an error for tilted preset")
+	}
+
+	processingPresets, defaultPreset = presets, "thumbnail"
+	defer func() { processingPresets, defaultPreset = nil, "" }()
+
+	// default preset without arguments
+	if steps, _, err := getCaptureOptions(""); err != nil || len(steps) != 2 || steps[0].Width != 320 {
+		t.Errorf("expected the default preset, got %+v (%v)", steps, err)
+	}
+
+	// presets and steps combined
+	steps, _, err := getCaptureOptions("upside_down autolevels")
+	if err != nil || len(steps) != 2 || steps[0].Degrees != 180 || steps[1].Type != stepAutoLevels {
+		t.Errorf("unexpected steps: %+v (%v)", steps, err)
+	}
+
+	// unknown preset or malformed step
+	if _, _, err := getCaptureOptions("upside_down rotate:abc"); err == nil || err.Error() != "malformed rotation: abc" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, _, err := getCaptureOptions("no_such_preset"); err == nil || err.Error() != "unknown processing step: no_such_preset" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestProcessImage(t *testing.T) {
+	src := halfRedHalfBlue(t)
+
+	tests := []struct {
+		name          string
+		steps         []processingStep
+		width, height int
+		red, blue     image.Point // points expected to be red or blue
+	}{
+		{
+			name:   "rotate 90",
+			steps:  []processingStep{{Type: stepRotate, Degrees: 90}},
+			width:  20,
+			height: 40,
+			red:    image.Pt(10, 5),
+			blue:   image.Pt(10, 35),
+		},
+		{
+			name:   "rotate 180",
+			steps:  []processingStep{{Type: stepRotate, Degrees: 180}},
+			width:  40,
+			height: 20,
+			red:    image.Pt(35, 10),
+			blue:   image.Pt(5, 10),
+		},
+		{
+			name:   "rotate 270",
+			steps:  []processingStep{{Type: stepRotate, Degrees: 270}},
+			width:  20,
+			height: 40,
+			red:    image.Pt(10, 35),
+			blue:   image.Pt(10, 5),
+		},
+		{
+			name:   "crop",
+			steps:  []processingStep{{Type: stepCrop, X: 0.25, Y: 0, Width: 0.5, Height: 0.5}},
+			width:  20,
+			height: 10,
+			red:    image.Pt(3, 5),
+			blue:   image.Pt(16, 5),
+		},
+		{
+			name:   "resize with width",
+			steps:  []processingStep{{Type: stepResize, Width: 20}},
+			width:  20,
+			height: 10,
+			red:    image.Pt(3, 5),
+			blue:   image.Pt(16, 5),
+		},
+		{
+			name:   "resize with height",
+			steps:  []processingStep{{Type: stepResize, Height: 40}},
+			width:  80,
+			height: 40,
+			red:    image.Pt(10, 20),
+			blue:   image.Pt(70, 20),
+		},
+		{
+			name:   "resize to fit",
+			steps:  []processingStep{{Type: stepResize, Width: 10, Height: 10}},
+			width:  10,
+			height: 5,
+			red:    image.Pt(1, 2),
+			blue:   image.Pt(8, 2),
+		},
+		{
+			name: "combined",
+			steps: []processingStep{
+				{Type: stepCrop, X: 0, Y: 0, Width: 0.5, Height: 1},
+				{Type: stepRotate, Degrees: 90},
+				{Type: stepResize, Width: 10},
+				{Type: stepQuality, Quality: 50},
+			},
+			width:  10,
+			height: 10,
+			red:    image.Pt(5, 5),
+			blue:   image.Pt(-1, -1),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			processed, err := processImage(src, test.steps, nil, nil)
+			if err != nil {
+				t.Fatalf("failed to process image: %s", err)
+			}
+
+			img := decodeTestJPEG(t, processed)
+			if size := img.Bounds().Size(); size.X != test.width || size.Y != test.height {
+				t.Fatalf("expected size %dx%d, got %dx%d", test.width, test.height, size.X, size.Y)
+			}
+			if !isCloseTo(img, test.red.X, test.red.Y, testRed) {
+				t.Errorf("expected red at %s, got %v", test.red, img.At(test.red.X, test.red.Y))
+			}
+			if test.blue.X >= 0 && !isCloseTo(img, test.blue.X, test.blue.Y, testBlue) {
+				t.Errorf("expected blue at %s, got %v", test.blue, img.At(test.blue.X, test.blue.Y))
+			}
+		})
+	}
+
+	// nothing to do
+	if processed, err := processImage(src, nil, nil, nil); err != nil || !bytes.Equal(processed, src) {
+		t.Errorf("expected the same bytes without steps (%v)", err)
+	}
+
+	// invalid step
+	if _, err := processImage(src, []processingStep{{Type: stepRotate, Degrees: 45}}, nil, nil); err == nil {
+		t.Errorf("expected an error for an invalid step")
+	}
+
+	// not a jpeg
+	if _, err := processImage([]byte("not a jpeg"), []processingStep{{Type: stepAutoLevels}}, nil, nil); err == nil {
+		t.Errorf("expected an error for a malformed image")
+	}
+}
+
+func TestAutoLevels(t *testing.T) {
+	// horizontal gray gradient of 64 ~ 191
+	src := testJPEG(t, 128, 8, func(x, y int) color.RGBA {
+		v := uint8(64 + x)
+		return color.RGBA{R: v, G: v, B: v, A: 255}
+	})
+
+	processed, err := processImage(src, []processingStep{{Type: stepAutoLevels}}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to process image: %s", err)
+	}
+	img := decodeTestJPEG(t, processed)
+
+	if !isCloseTo(img, 0, 4, color.RGBA{}) {
+		t.Errorf("expected black on the left edge, got %v", img.At(0, 4))
+	}
+	if !isCloseTo(img, 127, 4, color.RGBA{R: 255, G: 255, B: 255}) {
+		t.Errorf("expected white on the right edge, got %v", img.At(127, 4))
+	}
+	if !isCloseTo(img, 64, 4, color.RGBA{R: 128, G: 128, B: 128}) {
+		t.Errorf("expected mid gray in the middle, got %v", img.At(64, 4))
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+const (
+	// callback actions (of inline keyboards of photos)
+	callbackActionOriginal       = "original"
+	callbackActionRetake         = "retake"
+	callbackActionRetakeBrighter = "brighter"
+	callbackActionZoomCenter     = "zoom"
+	callbackActionDelete         = "delete"
+	callbackActionFavorite       = "favorite"
+	callbackActionPanLeft        = "left"
+	callbackActionPanRight       = "right"
+	callbackActionTiltUp         = "up"
+	callbackActionTiltDown       = "down"
+
+	// separator of callback data: "action:photo_id"
+	callbackDataSeparator = ":"
+
+	// camera params for retaking
+	cameraParamEV        = "--ev"
+	cameraParamROI       = "--roi"
+	retakeBrighterEVStep = 1.0
+	zoomCenterROI        = "0.25,0.25,0.5,0.5" // x,y,width,height in ratios of the sensor
+)
+
+// inline keyboard markup for a sent photo captured with given camera
+// (with buttons for retaking brighter or zoomed only if the camera supports exposure params,
+// and arrow buttons for moving the mount only if the camera is on it)
+func photoKeyboardMarkup(photoID int64, isFavorite bool, cameraName string) bot.InlineKeyboardMarkup {
+	favorite := messageFavorite
+	if isFavorite {
+		favorite = messageUnfavorite
+	}
+
+	button := func(text, action string) bot.InlineKeyboardButton {
+		return bot.NewInlineKeyboardButton(text).
+			SetCallbackData(callbackData(action, photoID))
+	}
+
+	retakes := []bot.InlineKeyboardButton{
+		button(messageRetake, callbackActionRetake),
+	}
+	if cameraNamed(cameraName).supportsExposure() {
+		retakes = append(retakes,
+			button(messageRetakeBrighter, callbackActionRetakeBrighter),
+			button(messageZoomCenter, callbackActionZoomCenter),
+		)
+	}
+
+	rows := [][]bot.InlineKeyboardButton{
+		retakes,
+		{
+			button(messageGetOriginal, callbackActionOriginal),
+			button(favorite, callbackActionFavorite),
+			button(messageDelete, callbackActionDelete),
+		},
+	}
+	if hasMount(cameraName) {
+		rows = append(rows, []bot.InlineKeyboardButton{
+			button(messagePanLeft, callbackActionPanLeft),
+			button(messageTiltUp, callbackActionTiltUp),
+			button(messageTiltDown, callbackActionTiltDown),
+			button(messagePanRight, callbackActionPanRight),
+		})
+	}
+
+	return bot.NewInlineKeyboardMarkup(rows)
+}
+
+// callbackData generates callback data for an action on a photo
+func callbackData(action string, photoID int64) string {
+	return action + callbackDataSeparator + strconv.FormatInt(photoID, 10)
+}
+
+// parseCallbackData parses callback data into an action and a photo id
+func parseCallbackData(data string) (action string, photoID int64, err error) {
+	action, id, found := strings.Cut(data, callbackDataSeparator)
+	if !found {
+		return "", 0, fmt.Errorf("malformed callback data: %s", data)
+	}
+	if photoID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return "", 0, fmt.Errorf("malformed photo id in callback data: %s", data)
+	}
+
+	return action, photoID, nil
+}
+
+// brighterCameraParams returns a copy of camera params with increased exposure compensation
+func brighterCameraParams(params map[string]any) map[string]any {
+	params = cloneCameraParams(params)
+
+	ev := 0.0
+	switch v := params[cameraParamEV].(type) {
+	case float64:
+		ev = v
+	case string:
+		ev, _ = strconv.ParseFloat(v, 64)
+	}
+	params[cameraParamEV] = ev + retakeBrighterEVStep
+
+	return params
+}
+
+// zoomedCameraParams returns a copy of camera params with the center region of the sensor
+func zoomedCameraParams(params map[string]any) map[string]any {
+	params = cloneCameraParams(params)
+	params[cameraParamROI] = zoomCenterROI
+
+	return params
+}
+
+// cloneCameraParams returns a non-nil copy of camera params
+func cloneCameraParams(params map[string]any) map[string]any {
+	if params == nil {
+		return map[string]any{}
+	}
+
+	return maps.Clone(params)
+}
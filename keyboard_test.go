@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// callbackActionsOf returns callback actions of all buttons in given keyboard markup
+func callbackActionsOf(t *testing.T, markup bot.InlineKeyboardMarkup) (actions []string) {
+	t.Helper()
+
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			action, _, err := parseCallbackData(*button.CallbackData)
+			if err != nil {
+				t.Fatalf("failed to parse callback data: %s", err)
+			}
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// setupRetakeCameras sets up cameras ("front" of libcamera, and "back" of fswebcam) and an in-memory database for retaking
+func setupRetakeCameras(t *testing.T) {
+	t.Helper()
+
+	cameras = map[string]*camera{
+		"front": {name: "front", config: cameraConfig{Backend: cameraBackendLibcamera}},
+		"back":  {name: "back", config: cameraConfig{Backend: cameraBackendFswebcam}},
+	}
+	cameraNames = []string{"front", "back"}
+	db = newMemoryStore()
+	captureChannel = make(chan _captureRequest, 10)
+	captureJobs = _captureJobs{Cancels: map[string]map[int64]context.CancelFunc{}}
+	t.Cleanup(func() {
+		cameras, cameraNames, db, captureChannel = nil, nil, nil, nil
+		captureJobs = _captureJobs{}
+	})
+}
+
+func TestPhotoKeyboardMarkup(t *testing.T) {
+	setupRetakeCameras(t)
+
+	if actions := callbackActionsOf(t, photoKeyboardMarkup(1, false, "front")); !slices.Equal(actions, []string{
+		callbackActionRetake, callbackActionRetakeBrighter, callbackActionZoomCenter,
+		callbackActionOriginal, callbackActionFavorite, callbackActionDelete,
+	}) {
+		t.Errorf("unexpected actions for libcamera: %v", actions)
+	}
+	if actions := callbackActionsOf(t, photoKeyboardMarkup(1, false, "back")); !slices.Equal(actions, []string{
+		callbackActionRetake,
+		callbackActionOriginal, callbackActionFavorite, callbackActionDelete,
+	}) {
+		t.Errorf("unexpected actions for fswebcam: %v", actions)
+	}
+}
+
+func TestRetake(t *testing.T) {
+	setupRetakeCameras(t)
+
+	front, _ := db.savePhoto(Photo{UserName: "alice", FileID: "f", Camera: "front"})
+	back, _ := db.savePhoto(Photo{UserName: "alice", FileID: "b", Camera: "back"})
+
+	// retaken with adjusted params
+	if answer, err := retake("alice", 1, front, brighterCameraParams); err != nil || answer != messageRetaking {
+		t.Errorf("unexpected result: %s (%v)", answer, err)
+	}
+	if request := <-captureChannel; request.Camera != "front" || request.CameraParams[cameraParamEV] == nil {
+		t.Errorf("unexpected capture request: %+v", request)
+	}
+
+	// params cannot be adjusted for cameras without exposure params
+	if _, err := retake("alice", 1, back, zoomedCameraParams); err == nil || err.Error() != "adjusted retake is not supported by camera 'back' (fswebcam)" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if answer, err := retake("alice", 1, back, nil); err != nil || answer != messageRetaking {
+		t.Errorf("unexpected result: %s (%v)", answer, err)
+	}
+	if request := <-captureChannel; request.Camera != "back" {
+		t.Errorf("unexpected capture request: %+v", request)
+	}
+
+	// not accessible by other users in other chats
+	if _, err := retake("bob", 2, front, nil); err == nil || !strings.Contains(err.Error(), "not accessible") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(captureChannel) != 0 {
+		t.Errorf("nothing should be queued")
+	}
+}
+
+func TestCallbacksOnInaccessiblePhotos(t *testing.T) {
+	setupRetakeCameras(t)
+
+	id, _ := db.savePhoto(Photo{UserName: "alice", FileID: "f", Camera: "front", ChatID: 1, MessageID: 10})
+
+	for name, callback := range map[string]func() (string, error){
+		callbackActionOriginal: func() (string, error) { return sendOriginal(nil, "bob", 2, id) },
+		callbackActionFavorite: func() (string, error) { return toggleFavorite(nil, "bob", 2, 10, id) },
+		callbackActionDelete:   func() (string, error) { return deletePhoto(nil, "bob", 2, 10, id) },
+	} {
+		if _, err := callback(); err == nil || !strings.Contains(err.Error(), "not accessible") {
+			t.Errorf("expected an error for %s, got: %v", name, err)
+		}
+	}
+
+	if photo, err := db.getPhoto(id); err != nil || photo.IsFavorite {
+		t.Errorf("photo should not be changed: %+v (%v)", photo, err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// arguments of light command
+	lightArgOn  = "on"
+	lightArgOff = "off"
+
+	// lights are switched on this time before capturing (when not configured)
+	defaultLightWarmupMillis = 200
+)
+
+// lightConfig is a configuration of a light (eg. IR illuminator, white LED) on a gpio output line
+type lightConfig struct {
+	Name string `json:"name"`
+
+	// gpio line
+	Chip      string `json:"chip,omitempty"` // (default: "/dev/gpiochip0", or "fake")
+	Line      int    `json:"line"`
+	ActiveLow bool   `json:"active_low"`
+
+	// switched on this time before capturing (default: 200ms)
+	WarmupMillis int `json:"warmup_ms,omitempty"`
+
+	// camera which this light is for (default camera if empty)
+	Camera string `json:"camera,omitempty"`
+
+	// switched only with the light command (not with captures)
+	Manual bool `json:"manual"`
+}
+
+// validate checks if the light config has valid values
+func (c lightConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("`name` is needed for light")
+	}
+	if c.Line < 0 {
+		return fmt.Errorf("gpio line of light '%s' should not be negative: %d", c.Name, c.Line)
+	}
+	if c.WarmupMillis < 0 {
+		return fmt.Errorf("warmup time of light '%s' should not be negative: %d", c.Name, c.WarmupMillis)
+	}
+
+	return nil
+}
+
+// chip returns the path of the gpio chip
+func (c lightConfig) chip() string {
+	if c.Chip == "" {
+		return defaultGPIOChip
+	}
+	return c.Chip
+}
+
+// warmup returns the time for switching on before capturing
+func (c lightConfig) warmup() time.Duration {
+	if c.WarmupMillis <= 0 {
+		return defaultLightWarmupMillis * time.Millisecond
+	}
+	return time.Duration(c.WarmupMillis) * time.Millisecond
+}
+
+// light is a light on a gpio output line
+type light struct {
+	sync.Mutex
+
+	config   lightConfig
+	output   gpioOutput
+	on       bool
+	manualOn bool // switched on with the light command
+}
+
+// openLights requests gpio output lines of lights, and returns them with the opened chips
+func openLights(configs []lightConfig) (lights []*light, chips map[string]GPIOChip, err error) {
+	chips = map[string]GPIOChip{}
+	closeAll := func() {
+		for _, chip := range chips {
+			_ = chip.close()
+		}
+	}
+
+	for _, conf := range configs {
+		chip, exists := chips[conf.chip()]
+		if !exists {
+			if chip, err = openGPIOChip(conf.chip()); err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("failed to open gpio chip for light '%s': %w", conf.Name, err)
+			}
+			chips[conf.chip()] = chip
+		}
+
+		var output gpioOutput
+		if output, err = chip.output(conf.Line, conf.ActiveLow); err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("failed to request gpio line for light '%s': %w", conf.Name, err)
+		}
+
+		lights = append(lights, &light{config: conf, output: output})
+	}
+
+	return lights, chips, nil
+}
+
+// setLocked switches the light on or off (should be called while holding its lock)
+func (l *light) setLocked(on bool) error {
+	if err := l.output.set(on); err != nil {
+		return fmt.Errorf("failed to switch light '%s': %w", l.config.Name, err)
+	}
+	l.on = on
+
+	return nil
+}
+
+// switchManually switches the light on or off with the light command
+// (lights switched on manually are not switched off after captures)
+func (l *light) switchManually(on bool) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if err := l.setLocked(on); err != nil {
+		return err
+	}
+	l.manualOn = on
+
+	return nil
+}
+
+// switchLightsForCapture switches on lights for the camera with given name, and waits for their warmup,
+// then returns a function for switching them off after capturing
+//
+// (should be called while holding the lock of the camera)
+func switchLightsForCapture(lights []*light, cameraName string) (off func()) {
+	switched := []*light{}
+	warmup := time.Duration(0)
+	for _, l := range lights {
+		if l.config.Manual || cameraNamed(l.config.Camera).name != cameraNamed(cameraName).name {
+			continue
+		}
+
+		l.Lock()
+		if !l.on {
+			if err := l.setLocked(true); err == nil {
+				switched = append(switched, l)
+				warmup = max(warmup, l.config.warmup())
+			} else {
+				logError("%s", err)
+			}
+		}
+		l.Unlock()
+	}
+	time.Sleep(warmup)
+
+	return func() {
+		for _, l := range switched {
+			l.Lock()
+			if !l.manualOn { // (not switched on manually while capturing)
+				if err := l.setLocked(false); err != nil {
+					logError("%s", err)
+				}
+			}
+			l.Unlock()
+		}
+	}
+}
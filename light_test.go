@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// openFakeLights opens lights of given configs on the in-memory gpio chip
+func openFakeLights(t *testing.T, configs ...lightConfig) ([]*light, *fakeGPIOChip) {
+	t.Helper()
+
+	for i := range configs {
+		configs[i].Chip = gpioChipFake
+		if configs[i].WarmupMillis <= 0 {
+			configs[i].WarmupMillis = 1
+		}
+	}
+
+	opened, chips, err := openLights(configs)
+	if err != nil {
+		t.Fatalf("failed to open lights: %s", err)
+	}
+	chip := chips[gpioChipFake].(*fakeGPIOChip)
+	t.Cleanup(func() { _ = chip.close() })
+
+	return opened, chip
+}
+
+func TestSwitchLightsForCapture(t *testing.T) {
+	cameras = map[string]*camera{"front": {name: "front"}, "back": {name: "back"}}
+	cameraNames = []string{"front", "back"}
+	defer func() { cameras, cameraNames = nil, nil }()
+
+	lights, chip := openFakeLights(t,
+		lightConfig{Name: "ir", Line: 5, WarmupMillis: 100}, // (for the default camera)
+		lightConfig{Name: "led", Line: 6, Camera: "front"},
+		lightConfig{Name: "porch", Line: 7, Camera: "back"},
+		lightConfig{Name: "lamp", Line: 8, Manual: true},
+	)
+	values := func() (values [4]bool) {
+		for i, line := range []int{5, 6, 7, 8} {
+			values[i] = chip.value(line)
+		}
+		return values
+	}
+
+	// switched on (after the longest warmup) while capturing, and off afterwards
+	startedAt := time.Now()
+	off := switchLightsForCapture(lights, "front")
+	if elapsed := time.Since(startedAt); elapsed < 100*time.Millisecond {
+		t.Errorf("expected to wait for the warmup, waited %s", elapsed)
+	}
+	if v := values(); v != [4]bool{true, true, false, false} {
+		t.Errorf("unexpected lights while capturing: %v", v)
+	}
+	off()
+	if v := values(); v != [4]bool{false, false, false, false} {
+		t.Errorf("unexpected lights after capturing: %v", v)
+	}
+
+	// for the other camera
+	off = switchLightsForCapture(lights, "back")
+	if v := values(); v != [4]bool{false, false, true, false} {
+		t.Errorf("unexpected lights while capturing: %v", v)
+	}
+	off()
+
+	// switched on manually before capturing: kept on
+	if msg := processLightCommandWith(lights, "on led"); !strings.Contains(msg, "led") {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	off = switchLightsForCapture(lights, "front")
+	off()
+	if v := values(); v != [4]bool{false, true, false, false} {
+		t.Errorf("unexpected lights after capturing: %v", v)
+	}
+
+	// switched on manually while capturing: kept on
+	off = switchLightsForCapture(lights, "front")
+	if msg := processLightCommandWith(lights, "on ir"); !strings.Contains(msg, "ir") {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	off()
+	if v := values(); v != [4]bool{true, true, false, false} {
+		t.Errorf("unexpected lights after capturing: %v", v)
+	}
+
+	// all off manually
+	if msg := processLightCommandWith(lights, "off"); msg != "Switched off: ir, led, porch, lamp" {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	if v := values(); v != [4]bool{false, false, false, false} {
+		t.Errorf("unexpected lights: %v", v)
+	}
+}
+
+func TestLightCommand(t *testing.T) {
+	lights, chip := openFakeLights(t, lightConfig{Name: "lamp", Line: 8, ActiveLow: true, Manual: true})
+
+	if msg := processLightCommandWith(lights, "on lamp"); msg != "Switched on: lamp" || !chip.value(8) {
+		t.Errorf("unexpected result: %s, %t", msg, chip.value(8))
+	}
+	if msg := processLightCommandWith(lights, "on attic"); msg != "No such light: attic" {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	if msg := processLightCommandWith(lights, "blink"); msg != messageUsageLight {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	if msg := processLightCommandWith(nil, "on"); msg != messageNoLights {
+		t.Errorf("unexpected message: %s", msg)
+	}
+}
+
+// processLightCommandWith processes the light command with given lights
+func processLightCommandWith(with []*light, args string) string {
+	saved := lights
+	defer func() { lights = saved }()
+
+	lights = with
+	return processLightCommand(args)
+}
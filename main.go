@@ -2,11 +2,18 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"maps"
 	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -47,35 +54,91 @@ type _sessionPool struct {
 	sync.Mutex
 }
 
-// for making sure the camera is not used simultaneously
-var cameraLock sync.Mutex
-
 // capture request
 type _captureRequest struct {
 	UserName       string
 	ChatID         any
 	ImageWidth     int
 	ImageHeight    int
-	CameraParams   map[string]any
+	CameraParams   map[string]any // (full sensor resolution if ImageWidth and ImageHeight are 0)
+	Processing     []processingStep
+	Camera         string
+	AllCameras     bool
+	Move           *mountMove // move the mount before capturing
+	Trigger        string     // name of the trigger which requested this capture
+	OtherChatIDs   []int64    // other chats where the captured image is also sent to (for triggers)
+	AsDocument     bool
+	BurstCount     int
+	HDR            bool
+	SendFrames     bool
+	NightMode      bool
 	MessageOptions map[string]any
+
+	Context context.Context // canceled with `/cancel` or on shutdown (set when queued)
+	JobID   int64
+}
+
+// capture requests (pending or in-flight) which can be canceled, by user
+type _captureJobs struct {
+	Cancels map[string]map[int64]context.CancelFunc
+	LastID  int64
+	sync.Mutex
+}
+
+// a frame of album
+type _albumFrame struct {
+	Original     []byte
+	CapturedAt   time.Time
+	Caption      string
+	CameraParams map[string]any // camera params of this frame (nil for the ones of the request)
+	Camera       string         // name of the camera of this frame (empty for the one of the request)
 }
 
 // variables
 var (
-	apiToken                string
-	monitorInterval         int
-	isVerbose               bool
-	availableIds            []string
-	imageWidth, imageHeight int
-	cameraParams            map[string]any
-	isInMaintenance         bool
-	maintenanceMessage      string
-	pool                    _sessionPool
-	captureChannel          chan _captureRequest
-	launched                time.Time
-	db                      *Database
+	apiToken           string
+	botUsername        string // (set when the bot starts)
+	monitorInterval    int
+	isVerbose          bool
+	availableIds       []string
+	adminChats         []int64
+	cameras            map[string]*camera
+	cameraNames        []string // (default one first)
+	processingPresets  map[string][]processingStep
+	defaultPreset      string
+	overlay            *overlayConfig
+	exif               *exifConfig
+	sendAsDocument     bool
+	burstInterval      time.Duration
+	hdr                *hdrConfig
+	night              *nightModeConfig
+	fleet              *fleetConfig
+	mountConf          *mountConfig
+	mount              *panTilt // (opened when the bot starts)
+	triggers           []triggerConfig
+	lightConfs         []lightConfig
+	lights             []*light // (opened when the bot starts)
+	notificationsConf  notificationsConfig
+	notifications      *notifier // (created when the bot starts)
+	healthConf         healthConfig
+	watchHealth        bool // (only when `health` is configured)
+	health             *watchdog
+	retry              *retryConfig
+	shutdownConf       shutdownConfig
+	watchConfigFile    bool
+	isInMaintenance    bool
+	maintenanceMessage string
+	pool               _sessionPool
+	captureChannel     chan _captureRequest
+	captureJobs        _captureJobs
+	launched           time.Time
+	db                 Store
+	archiveDir         string
 )
 
+// root context of captures (canceled on shutdown)
+var captureCtx, stopCaptures = context.WithCancel(context.Background())
+
 // keyboards
 var allKeyboards = [][]bot.KeyboardButton{
 	bot.NewKeyboardButtons(commandCapture),
@@ -88,54 +151,233 @@ var (
 	_stderr = log.New(os.Stderr, "", log.LstdFlags)
 )
 
-// initialization
-func init() {
-	launched = time.Now()
-
+// set up variables with the config file (and open the local database)
+func setup() (err error) {
 	// read variables from config file
-	if config, err := loadConfig(); err == nil {
-		apiToken = config.APIToken
-		availableIds = config.AvailableIds
-		monitorInterval = config.MonitorInterval
-		if monitorInterval <= 0 {
-			monitorInterval = defaultMonitorIntervalSeconds
-		}
-		isVerbose = config.IsVerbose
-
-		// image width * height
-		imageWidth = max(config.ImageWidth, minImageWidth)
-		imageHeight = max(config.ImageHeight, minImageHeight)
-
-		// other camera params
-		cameraParams = config.CameraParams
-
-		// maintenance
-		isInMaintenance = config.IsInMaintenance
-		maintenanceMessage = config.MaintenanceMessage
-		if len(maintenanceMessage) <= 0 {
-			maintenanceMessage = defaultMaintenanceMessage
-		}
-
-		// initialize session variables
-		sessions := make(map[string]_session)
-		for _, v := range availableIds {
-			sessions[v] = _session{
-				UserID:        v,
-				CurrentStatus: statusWaiting,
-				LastUpdateID:  -1,
+	var config config
+	if config, err = loadConfig(); err != nil {
+		return err
+	}
+	runningConfig = config
+
+	apiToken = config.APIToken
+	availableIds = config.AvailableIds
+	adminChats = config.AdminChats
+	monitorInterval = config.MonitorInterval
+	if monitorInterval <= 0 {
+		monitorInterval = defaultMonitorIntervalSeconds
+	}
+	isVerbose = config.IsVerbose
+
+	// image width * height
+	imageWidth := max(config.ImageWidth, minImageWidth)
+	imageHeight := max(config.ImageHeight, minImageHeight)
+
+	// fleet of multiple Pis
+	fleet = config.Fleet
+	if fleet != nil {
+		if err := fleet.validate(); err != nil {
+			return err
+		}
+	}
+
+	// cameras (with the top-level image size and camera params as defaults)
+	if cameras, cameraNames, err = newCameras(config.Cameras, config.DefaultCamera, imageWidth, imageHeight, config.CameraParams); err != nil {
+		return err
+	}
+	// pan/tilt mount
+	mountConf = config.Mount
+	if mountConf != nil {
+		if err := mountConf.validate(); err != nil {
+			return err
+		}
+		if _, exists := cameras[mountConf.Camera]; mountConf.Camera != "" && !exists {
+			return fmt.Errorf("no such camera for mount: %s", mountConf.Camera)
+		}
+	}
+
+	// gpio triggers
+	triggers = config.Triggers
+	for _, trigger := range triggers {
+		if err := trigger.validate(); err != nil {
+			return err
+		}
+		if _, exists := cameras[trigger.Camera]; trigger.Camera != "" && !exists {
+			return fmt.Errorf("no such camera for trigger '%s': %s", trigger.Name, trigger.Camera)
+		}
+	}
+
+	// lights (eg. IR illuminators)
+	lightConfs = config.Lights
+	lightNames := map[string]bool{}
+	for _, conf := range lightConfs {
+		if err := conf.validate(); err != nil {
+			return err
+		}
+		if lightNames[conf.Name] {
+			return fmt.Errorf("duplicated light name: %s", conf.Name)
+		}
+		lightNames[conf.Name] = true
+		if _, exists := cameras[conf.Camera]; conf.Camera != "" && !exists {
+			return fmt.Errorf("no such camera for light '%s': %s", conf.Name, conf.Camera)
+		}
+	}
+
+	// health watchdog
+	if config.Health != nil {
+		healthConf = *config.Health
+		if err := healthConf.validate(); err != nil {
+			return err
+		}
+		watchHealth = true
+	}
+
+	// retries of failed captures
+	retry = config.Retry
+	if retry != nil {
+		if err := retry.validate(); err != nil {
+			return err
+		}
+	}
+
+	// shutting down
+	if config.Shutdown != nil {
+		shutdownConf = *config.Shutdown
+		if err := shutdownConf.validate(); err != nil {
+			return err
+		}
+	}
+
+	// notifications to subscribed chats
+	if config.Notifications != nil {
+		notificationsConf = *config.Notifications
+		if err := notificationsConf.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range cameraNames {
+		if cameras[name].config.Backend == cameraBackendAgent && fleet == nil {
+			return fmt.Errorf("`fleet` is needed for camera '%s' of agent", name)
+		}
+	}
+
+	// burst capture
+	burstInterval = time.Duration(config.BurstIntervalMillis) * time.Millisecond
+	if burstInterval <= 0 {
+		burstInterval = defaultBurstIntervalMillis * time.Millisecond
+	}
+
+	// image post-processing
+	processingPresets = config.ProcessingPresets
+	for name, steps := range processingPresets {
+		for _, step := range steps {
+			if err := step.validate(); err != nil {
+				return fmt.Errorf("invalid processing preset '%s': %s", name, err)
 			}
 		}
-		pool = _sessionPool{
-			Sessions: sessions,
+	}
+	defaultPreset = config.DefaultPreset
+	if _, exists := processingPresets[defaultPreset]; defaultPreset != "" && !exists {
+		return fmt.Errorf("no such processing preset: %s", defaultPreset)
+	}
+	for _, name := range cameraNames {
+		if _, exists := processingPresets[name]; exists || name == captureArgDocument || name == captureArgFrames {
+			return fmt.Errorf("camera name '%s' conflicts with a processing preset or an argument", name)
 		}
+	}
 
-		// channels
-		captureChannel = make(chan _captureRequest, numQueue)
+	// text overlay
+	overlay = config.Overlay
+	if overlay != nil {
+		if err := overlay.validate(); err != nil {
+			return err
+		}
+	}
 
-		// local database
-		db = openDB()
-	} else {
-		panic(err)
+	// exif metadata
+	exif = config.Exif
+	if exif != nil {
+		if err := exif.validate(); err != nil {
+			return err
+		}
+	}
+	sendAsDocument = config.SendAsDocument
+
+	// hdr capture
+	hdr = config.HDR
+	if hdr != nil {
+		if err := hdr.validate(); err != nil {
+			return err
+		}
+	}
+
+	// night mode
+	night = config.NightMode
+	if night != nil {
+		if err := night.validate(); err != nil {
+			return err
+		}
+	}
+
+	// reload config when the config file is modified
+	watchConfigFile = config.WatchConfig
+
+	// maintenance
+	isInMaintenance = config.IsInMaintenance
+	maintenanceMessage = config.MaintenanceMessage
+	if len(maintenanceMessage) <= 0 {
+		maintenanceMessage = defaultMaintenanceMessage
+	}
+
+	// initialize session variables
+	sessions := make(map[string]_session)
+	for _, v := range availableIds {
+		sessions[v] = newSession(v)
+	}
+	pool = _sessionPool{
+		Sessions: sessions,
+	}
+
+	// channels
+	captureChannel = make(chan _captureRequest, numQueue)
+	captureJobs = _captureJobs{
+		Cancels: map[string]map[int64]context.CancelFunc{},
+	}
+
+	// local database
+	if db, err = openStore(config.Storage, config.DBPath); err != nil {
+		return err
+	}
+
+	// archive of original images
+	if config.ArchiveDir != "" {
+		if archiveDir, err = resolvePath(config.ArchiveDir); err != nil {
+			return err
+		}
+	}
+
+	// (free disk space of the database and archive is watched)
+	diskPaths := []string{}
+	if config.Storage == "" || config.Storage == storageSQLite {
+		if dbPath, err := resolvePath(cmp.Or(config.DBPath, DbFilename)); err == nil {
+			diskPaths = append(diskPaths, filepath.Dir(dbPath))
+		}
+	}
+	if archiveDir != "" {
+		diskPaths = append(diskPaths, archiveDir)
+	}
+	health = newWatchdog(healthConf, diskPaths, func() int { return len(captureChannel) })
+
+	return nil
+}
+
+// new session of given user
+func newSession(userID string) _session {
+	return _session{
+		UserID:        userID,
+		CurrentStatus: statusWaiting,
+		LastUpdateID:  -1,
 	}
 }
 
@@ -145,9 +387,17 @@ func isAvailableID(id *string) bool {
 		return false
 	}
 
+	configLock.RLock()
+	defer configLock.RUnlock()
+
 	return slices.Contains(availableIds, *id)
 }
 
+// check if given chat is one of the admin chats
+func isAdminChat(chatID int64) bool {
+	return slices.Contains(adminChats, chatID)
+}
+
 // for showing help message
 func getHelp() string {
 	return fmt.Sprintf(`
@@ -156,9 +406,29 @@ Following commands are supported:
 *For Raspberry Pi Camera Module*
 
 %s : capture a still image with *raspistill*
+%s <camera> : capture a still image with given camera (%s)
+%s : capture still images with all cameras, and send them as an album
+%s <preset or steps> : capture and process a still image (eg. rotate:90, crop:0.25,0.25,0.5,0.5, resize:640x, autolevels, quality:80)
+%s document : capture a still image and send it as a document (uncompressed, with metadata)
+%s N : capture N still images in a row, and send them as an album
+%s [frames] : capture bracketed exposures and merge them into a HDR image (with its frames, if requested)
+%s DEGREES, %s DEGREES : move the mount (-90 ~ 90), and capture a still image
+%s [preset] : move the mount to a preset position and capture a still image (or show the current position)
+%s on|off [name] : switch lights on or off (all lights if no name is given)
+
+*Notifications*
+
+%s [topic] : subscribe a topic of notifications (%s), or show subscriptions of this chat
+%s topic : unsubscribe a topic of notifications
+%s [22:00-07:00 | off] : set (or clear) quiet hours of this chat (notifications are held back until they end)
 
 *Others*
 
+%s : delete your photo (reply to it, or give its ids)
+%s --older-than 30d : delete photos older than given age (except favorites, only in admin chats)
+
+%s : cancel your pending and in-flight captures
+%s : reload config (only in admin chats)
 %s : show this bot's status
 %s : show this bot's privacy policy
 %s : show this help message
@@ -166,7 +436,28 @@ Following commands are supported:
 %s
 `,
 		commandCapture,
-
+		commandCapture,
+		strings.Join(cameraNames, ", "),
+		commandCaptureAll,
+		commandCapture,
+		commandCapture,
+		commandBurst,
+		commandHDR,
+		commandPan,
+		commandTilt,
+		commandPosition,
+		commandLight,
+
+		commandSubscribe,
+		strings.Join(notificationTopics, ", "),
+		commandUnsubscribe,
+		commandQuiet,
+
+		commandDelete,
+		commandPurge,
+
+		commandCancel,
+		commandReload,
 		commandStatus,
 		commandPrivacy,
 		commandHelp,
@@ -184,6 +475,146 @@ Privacy Policy:
 `, githubPageURL)
 }
 
+// strip the username of this bot from the command of given text
+// (eg. "/capture@SomeBot gray" => "/capture gray", as sent in group chats)
+func stripBotUsername(txt, username string) string {
+	if !strings.HasPrefix(txt, "/") || username == "" {
+		return txt
+	}
+
+	command, rest, _ := strings.Cut(txt, " ")
+	if name, mentioned, found := strings.Cut(command, "@"); found && strings.EqualFold(mentioned, username) {
+		return strings.TrimSuffix(name+" "+rest, " ")
+	}
+
+	return txt
+}
+
+// get the camera with given name (or the default one if there is no such camera)
+func cameraNamed(name string) *camera {
+	if cam, exists := cameras[name]; exists {
+		return cam
+	}
+
+	return cameras[cameraNames[0]]
+}
+
+// split a camera name (if any) from the arguments of capture commands
+func splitCameraName(args string) (name, rest string) {
+	fields := []string{}
+	for _, field := range strings.Fields(args) {
+		if _, exists := cameras[field]; exists && name == "" {
+			name = field
+		} else {
+			fields = append(fields, field)
+		}
+	}
+
+	return name, strings.Join(fields, " ")
+}
+
+// returns if the camera with given name is on the mount
+func hasMount(cameraName string) bool {
+	return mount != nil && cameraNamed(mount.config.Camera).name == cameraNamed(cameraName).name
+}
+
+// get a move of the mount from pan/tilt/position commands (or a message if there's no move)
+func getMountMove(txt string) (move *mountMove, msg string) {
+	if mount == nil {
+		return nil, messageNoMount
+	}
+
+	var command, args string
+	for _, command = range []string{commandPan, commandTilt, commandPosition} {
+		if rest, found := strings.CutPrefix(txt, command); found {
+			args = strings.TrimSpace(rest)
+			break
+		}
+	}
+
+	if command == commandPosition {
+		if args == "" {
+			names := slices.Sorted(maps.Keys(mount.config.Presets))
+			return nil, fmt.Sprintf("Current position: %s\nPresets: %s", mount.current(), strings.Join(names, ", "))
+		}
+		preset, exists := mount.config.Presets[args]
+		if !exists {
+			return nil, fmt.Sprintf("No such preset: %s", args)
+		}
+		return &mountMove{Pan: &preset.Pan, Tilt: &preset.Tilt}, ""
+	}
+
+	degrees, err := parseMountDegrees(args)
+	if err != nil {
+		return nil, fmt.Sprintf("Usage: %s DEGREES (%g ~ %g)", command, float64(minServoDegrees), float64(maxServoDegrees))
+	}
+	if command == commandPan {
+		return &mountMove{Pan: &degrees}, ""
+	}
+	return &mountMove{Tilt: &degrees}, ""
+}
+
+// get the number of captures from the arguments of burst command
+func parseBurstCount(args string) (int, error) {
+	count, err := strconv.Atoi(strings.TrimSpace(args))
+	if err != nil || count < minBurstCount || count > maxBurstCount {
+		return 0, fmt.Errorf("Usage: %s N (%d ~ %d)", commandBurst, minBurstCount, maxBurstCount)
+	}
+
+	return count, nil
+}
+
+// get capture options from the arguments of hdr command
+func getHDROptions(args string) (steps []processingStep, asDocument, sendFrames bool, err error) {
+	sendFrames = hdr != nil && hdr.SendFrames
+
+	fields := []string{}
+	for _, field := range strings.Fields(args) {
+		if field == captureArgFrames {
+			sendFrames = true
+		} else {
+			fields = append(fields, field)
+		}
+	}
+
+	steps, asDocument, err = getCaptureOptions(strings.Join(fields, " "))
+	return steps, asDocument, sendFrames, err
+}
+
+// get capture options from the arguments of capture command
+//
+// (each argument can be a name of preset, a step like "rotate:90", or "document" for sending as a document)
+func getCaptureOptions(args string) (steps []processingStep, asDocument bool, err error) {
+	asDocument = sendAsDocument
+
+	fields := []string{}
+	for _, field := range strings.Fields(args) {
+		if field == captureArgDocument {
+			asDocument = true
+		} else {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) <= 0 {
+		return processingPresets[defaultPreset], asDocument, nil
+	}
+
+	steps = []processingStep{}
+	for _, field := range fields {
+		if preset, exists := processingPresets[field]; exists {
+			steps = append(steps, preset...)
+		} else {
+			var step processingStep
+			if step, err = parseProcessingStep(field); err != nil {
+				return nil, false, err
+			}
+			steps = append(steps, step)
+		}
+	}
+
+	return steps, asDocument, nil
+}
+
 // for showing current status of this bot
 func getStatus() string {
 	return fmt.Sprintf("Uptime: %s\nMemory Usage: %s", getUptime(launched), getMemoryUsage())
@@ -223,12 +654,18 @@ func processUpdate(b *bot.Bot, update bot.Update, message bot.Message) bool {
 			// text from message
 			var txt string
 			if message.HasText() {
-				txt = *message.Text
+				txt = stripBotUsername(*message.Text, botUsername)
 			} else {
 				txt = ""
 			}
 
 			var msg string
+			var processing []processingStep
+			var asDocument bool
+			var burstCount int
+			var isHDR, sendFrames, allCameras bool
+			var cameraName string
+			var move *mountMove
 			options := bot.OptionsSendMessage{}.
 				SetReplyMarkup(replyKeyboardMarkup(resizeKeyboard)).
 				SetParseMode(bot.ParseModeMarkdown)
@@ -239,9 +676,61 @@ func processUpdate(b *bot.Bot, update bot.Update, message bot.Message) bool {
 				// start
 				case strings.HasPrefix(txt, commandStart):
 					msg = messageDefault
+				// capture with all cameras (should be checked before `commandCapture`)
+				case strings.HasPrefix(txt, commandCaptureAll):
+					allCameras = true
+					processing = processingPresets[defaultPreset]
 				// capture
 				case strings.HasPrefix(txt, commandCapture):
-					msg = ""
+					var err error
+					var args string
+					cameraName, args = splitCameraName(strings.TrimPrefix(txt, commandCapture))
+					if processing, asDocument, err = getCaptureOptions(args); err != nil {
+						msg = fmt.Sprintf("Invalid processing option: %s", err)
+					}
+				// burst
+				case strings.HasPrefix(txt, commandBurst):
+					var err error
+					var args string
+					cameraName, args = splitCameraName(strings.TrimPrefix(txt, commandBurst))
+					if burstCount, err = parseBurstCount(args); err != nil {
+						msg = err.Error()
+					} else {
+						processing = processingPresets[defaultPreset]
+					}
+				// hdr
+				case strings.HasPrefix(txt, commandHDR):
+					var err error
+					var args string
+					isHDR = true
+					cameraName, args = splitCameraName(strings.TrimPrefix(txt, commandHDR))
+					if processing, asDocument, sendFrames, err = getHDROptions(args); err != nil {
+						msg = fmt.Sprintf("Invalid processing option: %s", err)
+					}
+				// pan/tilt
+				case strings.HasPrefix(txt, commandPan), strings.HasPrefix(txt, commandTilt), strings.HasPrefix(txt, commandPosition):
+					if move, msg = getMountMove(txt); move != nil {
+						cameraName = mount.config.Camera
+						processing = processingPresets[defaultPreset]
+					}
+				// light
+				case strings.HasPrefix(txt, commandLight):
+					msg = processLightCommand(strings.TrimPrefix(txt, commandLight))
+				// subscribe
+				case strings.HasPrefix(txt, commandSubscribe):
+					msg = processSubscribeCommand(message, strings.TrimPrefix(txt, commandSubscribe))
+				// unsubscribe
+				case strings.HasPrefix(txt, commandUnsubscribe):
+					msg = processUnsubscribeCommand(message, strings.TrimPrefix(txt, commandUnsubscribe))
+				// quiet hours
+				case strings.HasPrefix(txt, commandQuiet):
+					msg = processQuietCommand(message, strings.TrimPrefix(txt, commandQuiet))
+				// reload config
+				case strings.HasPrefix(txt, commandReload):
+					msg = processReloadCommand(b, message)
+				// cancel
+				case strings.HasPrefix(txt, commandCancel):
+					msg = processCancelCommand(userID)
 				// status
 				case strings.HasPrefix(txt, commandStatus):
 					msg = getStatus()
@@ -251,6 +740,12 @@ func processUpdate(b *bot.Bot, update bot.Update, message bot.Message) bool {
 					// privacy
 				case strings.HasPrefix(txt, commandPrivacy):
 					msg = getPrivacyPolicy()
+				// delete
+				case strings.HasPrefix(txt, commandDelete):
+					msg = processDeleteCommand(b, message, strings.TrimPrefix(txt, commandDelete))
+				// purge
+				case strings.HasPrefix(txt, commandPurge):
+					msg = processPurgeCommand(b, message, strings.TrimPrefix(txt, commandPurge))
 				// fallback
 				default:
 					if len(txt) > 0 {
@@ -276,25 +771,39 @@ func processUpdate(b *bot.Bot, update bot.Update, message bot.Message) bool {
 					logError("failed to send message: %s", *sent.Description)
 				}
 			} else {
-				if isInMaintenance {
+				configLock.RLock()
+				inMaintenance, maintenanceMsg := isInMaintenance, maintenanceMessage
+				configLock.RUnlock()
+
+				if inMaintenance {
 					// send message
 					sendMessageCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
 					defer cancel()
-					if sent, _ := b.SendMessage(sendMessageCtx, message.Chat.ID, maintenanceMessage, options); sent.OK {
+					if sent, _ := b.SendMessage(sendMessageCtx, message.Chat.ID, maintenanceMsg, options); sent.OK {
 						result = true
 					} else {
 						logError("failed to send maintenance message: %s", *sent.Description)
 					}
 				} else {
 					// push to capture request channel
-					captureChannel <- _captureRequest{
+					cam := cameraNamed(cameraName)
+					width, height, params := cam.settings()
+					enqueueCapture(_captureRequest{
 						UserName:       *message.From.Username,
 						ChatID:         message.Chat.ID,
-						ImageWidth:     imageWidth,
-						ImageHeight:    imageHeight,
-						CameraParams:   cameraParams,
+						ImageWidth:     width,
+						ImageHeight:    height,
+						CameraParams:   params,
+						Camera:         cam.name,
+						AllCameras:     allCameras,
+						Move:           move,
+						Processing:     processing,
+						AsDocument:     asDocument,
+						BurstCount:     burstCount,
+						HDR:            isHDR,
+						SendFrames:     sendFrames,
 						MessageOptions: options,
-					}
+					})
 				}
 			}
 		} else {
@@ -308,55 +817,198 @@ func processUpdate(b *bot.Bot, update bot.Update, message bot.Message) bool {
 	return result
 }
 
+// queue a capture request with a cancelable context
+// (dropped when shutting down, or if captures are stopped while waiting for the queue)
+func enqueueCapture(request _captureRequest) {
+	if shuttingDown.Load() {
+		logMessage("dropping capture request of '%s' while shutting down", request.UserName)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(captureCtx)
+	request.Context = ctx
+
+	captureJobs.Lock()
+	captureJobs.LastID++
+	request.JobID = captureJobs.LastID
+	if _, exists := captureJobs.Cancels[request.UserName]; !exists {
+		captureJobs.Cancels[request.UserName] = map[int64]context.CancelFunc{}
+	}
+	captureJobs.Cancels[request.UserName][request.JobID] = cancel
+	captureJobs.Unlock()
+
+	select {
+	case captureChannel <- request:
+	case <-captureCtx.Done():
+		finishCapture(request)
+	}
+}
+
+// release the context of a capture request
+func finishCapture(request _captureRequest) {
+	captureJobs.Lock()
+	defer captureJobs.Unlock()
+
+	if cancel, exists := captureJobs.Cancels[request.UserName][request.JobID]; exists {
+		cancel()
+		delete(captureJobs.Cancels[request.UserName], request.JobID)
+		if len(captureJobs.Cancels[request.UserName]) <= 0 {
+			delete(captureJobs.Cancels, request.UserName)
+		}
+	}
+}
+
+// cancel pending and in-flight capture requests of a user, and return the number of them
+func cancelCaptures(userName string) int {
+	captureJobs.Lock()
+	defer captureJobs.Unlock()
+
+	canceled := 0
+	for _, cancel := range captureJobs.Cancels[userName] {
+		cancel()
+		canceled++
+	}
+	delete(captureJobs.Cancels, userName)
+
+	return canceled
+}
+
+// process `/cancel` command: cancel pending and in-flight captures of the user
+func processCancelCommand(userName string) string {
+	if canceled := cancelCaptures(userName); canceled > 0 {
+		return fmt.Sprintf("%s (%d capture(s))", messageCanceled, canceled)
+	}
+
+	return messageNothingToCancel
+}
+
+// process queued capture requests one by one, until `ctx` is done
+func runCaptureWorker(ctx context.Context, b *bot.Bot) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case request := <-captureChannel:
+			if request.Context.Err() != nil { // (canceled while pending)
+				logMessage("capture request of '%s' was canceled before started", request.UserName)
+			} else {
+				// do capture and send response
+				health.captureStarted()
+				processCaptureRequest(b, request)
+				health.captureFinished()
+			}
+			finishCapture(request)
+		}
+	}
+}
+
 // process capture request
 func processCaptureRequest(b *bot.Bot, request _captureRequest) bool {
 	// process result
 	result := false
 
-	cameraLock.Lock()
-	defer cameraLock.Unlock()
-
 	// 'typing...'
-	chatActionCtx, cancel := context.WithTimeout(context.Background(), chatActionTimeout)
+	chatActionCtx, cancel := context.WithTimeout(request.Context, chatActionTimeout)
 	defer cancel()
 	_, _ = b.SendChatAction(chatActionCtx, request.ChatID, bot.ChatActionTyping, nil)
 
+	// capture with all cameras
+	if request.AllCameras {
+		return processCaptureAllRequest(b, request)
+	}
+
+	cam := cameraNamed(request.Camera)
+	cam.Lock()
+	defer cam.Unlock()
+
+	// move the mount first (while holding the lock of its camera)
+	var position *mountPosition
+	if request.Move != nil {
+		if mount == nil {
+			return sendCaptureError(b, request, messageNoMount)
+		}
+
+		moved, err := mount.move(*request.Move)
+		if err != nil {
+			return sendCaptureError(b, request, fmt.Sprintf("Failed to move the mount: %s", err))
+		}
+		position = &moved
+	}
+
+	// burst capture
+	if request.BurstCount > 1 {
+		return processBurstRequest(b, cam, request)
+	}
+
 	// send photo
-	if bytes, err := captureStillImage(libCameraStillBin, request.ImageWidth, request.ImageHeight, request.CameraParams); err == nil {
+	original, frames, err := captureImage(cam, &request)
+	if request.Context.Err() != nil {
+		logMessage("capture request of '%s' was canceled: %s", request.UserName, request.Context.Err())
+		return false
+	}
+	if err == nil {
 		// captured time
-		caption := time.Now().Format("2006-01-02 (Mon) 15:04:05")
+		capturedAt := time.Now()
+		caption := capturedAt.Format(captionTimeFormat)
+		if request.NightMode {
+			caption = fmt.Sprintf("%s (%s)", caption, messageNightModeUsed)
+		}
+		if position != nil {
+			caption = fmt.Sprintf("%s (%s)", caption, position)
+		}
+		if request.Trigger != "" {
+			caption = fmt.Sprintf("%s (%s)", caption, request.Trigger)
+		}
 		request.MessageOptions["caption"] = caption
 
-		// 'uploading photo...'
-		chatActionCtx, cancel := context.WithTimeout(context.Background(), chatActionTimeout)
-		defer cancel()
-		_, _ = b.SendChatAction(chatActionCtx, request.ChatID, bot.ChatActionUploadPhoto, nil)
-
-		// send photo
-		sendPhotoCtx, cancel := context.WithTimeout(context.Background(), sendPhotoTimeout)
-		defer cancel()
-		if sent, _ := b.SendPhoto(sendPhotoCtx, request.ChatID, bot.NewInputFileFromBytes(bytes), request.MessageOptions); sent.OK {
-			photo := sent.Result.LargestPhoto()
+		// archive, post-process, and write metadata
+		bytes, archivePath := prepareImage(original, capturedAt, request)
 
-			db.savePhoto(request.UserName, photo.FileID, caption)
+		// send to the chat of the request, then to the other chats (without uploading it again)
+		chatIDs := []any{request.ChatID}
+		for _, chatID := range request.OtherChatIDs {
+			chatIDs = append(chatIDs, chatID)
+		}
+		input := bot.NewInputFileFromBytes(bytes)
+		for i, chatID := range chatIDs {
+			fileID, sent := sendCapturedImage(b, request, chatID, input, Photo{
+				UserName:    request.UserName,
+				Caption:     caption,
+				Time:        capturedAt,
+				ArchivePath: archivePath, // (shared by the photos of all chats)
+				IsDocument:  request.AsDocument,
+				Camera:      cam.name,
+			})
+			if !sent {
+				continue
+			}
+			if fileID != "" {
+				input = bot.NewInputFileFromFileID(fileID)
+			}
 
 			result = true
-		} else {
-			msg := fmt.Sprintf("Failed to send photo: %s", *sent.Description)
 
-			logError("%s", msg)
-
-			// send error message
-			sendMessageCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
-			defer cancel()
-			_, _ = b.SendMessage(sendMessageCtx, request.ChatID, msg, nil)
+			// send bracketed frames of HDR capture
+			if i == 0 && request.SendFrames && len(frames) > 0 {
+				brackets := hdr.brackets()
+				albumFrames := []_albumFrame{}
+				for i, frame := range frames {
+					albumFrames = append(albumFrames, _albumFrame{
+						Original:     frame,
+						CapturedAt:   capturedAt,
+						Caption:      fmt.Sprintf("%s (%s)", caption, brackets[i]),
+						CameraParams: brackets[i].cameraParams(request.CameraParams),
+					})
+				}
+				_ = sendAlbum(b, request, albumFrames)
+			}
 		}
 	} else {
-		message := fmt.Sprintf("Image capture failed: %s", err)
+		message := fmt.Sprintf("Image capture failed: %s", describeCaptureError(err))
 
 		logError("%s", message)
 
-		sendMessageCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
+		sendMessageCtx, cancel := context.WithTimeout(request.Context, sendMessageTimeout)
 		defer cancel()
 		_, _ = b.SendMessage(sendMessageCtx, request.ChatID, message, request.MessageOptions)
 	}
@@ -364,61 +1016,936 @@ func processCaptureRequest(b *bot.Bot, request _captureRequest) bool {
 	return result
 }
 
-// process inline query
-func processInlineQuery(b *bot.Bot, update bot.Update, inlineQuery bot.InlineQuery) bool {
-	// check username
-	from := update.GetFrom()
-	if from != nil {
-		if !isAvailableID(from.Username) {
-			logError("[inline query] user not allowed: %+v", from.Username)
-			return false
+// send a captured (and prepared) image of a request to a chat, and save it as `photo`,
+// then return the file id of the sent image (for sending it to other chats without uploading again)
+func sendCapturedImage(b *bot.Bot, request _captureRequest, chatID any, input bot.InputFile, photo Photo) (fileID string, ok bool) {
+	// 'uploading photo...' or 'uploading document...'
+	chatAction := bot.ChatActionUploadPhoto
+	if request.AsDocument {
+		chatAction = bot.ChatActionUploadDocument
+	}
+	chatActionCtx, cancel := context.WithTimeout(request.Context, chatActionTimeout)
+	defer cancel()
+	_, _ = b.SendChatAction(chatActionCtx, chatID, chatAction, nil)
+
+	// save the photo first, so that the inline keyboard can reference it
+	// (its file id will be filled after it is sent)
+	options := maps.Clone(request.MessageOptions)
+	photoID, err := db.savePhoto(photo)
+	if err != nil {
+		logError("failed to save photo: %s", err)
+	} else if !request.AsDocument {
+		options["reply_markup"] = photoKeyboardMarkup(photoID, false, photo.Camera)
+	}
+
+	// send photo (or document, for keeping it uncompressed with its metadata)
+	sendPhotoCtx, cancel := context.WithTimeout(request.Context, sendPhotoTimeout)
+	defer cancel()
+	var sent bot.APIResponse[bot.Message]
+	if request.AsDocument {
+		if sent, _ = b.SendDocument(sendPhotoCtx, chatID, input, options); sent.OK && sent.Result.Document != nil {
+			fileID = sent.Result.Document.FileID
 		}
 	} else {
-		logError("[inline query] user not allowed (has no `from`)")
-		return false
+		if sent, _ = b.SendPhoto(sendPhotoCtx, chatID, input, options); sent.OK {
+			fileID = sent.Result.LargestPhoto().FileID
+		}
 	}
+	if !sent.OK {
+		if photoID > 0 {
+			if err := db.deletePhoto(photoID); err != nil {
+				logError("failed to delete unsent photo: %s", err)
+			}
+		}
 
-	userID := *from.Username
-
-	// retrieve cached photos,
-	photos := db.getPhotos(userID, numLatestPhotos)
+		msg := fmt.Sprintf("Failed to send photo: %s", *sent.Description)
 
-	if len(photos) > 0 {
-		photoResults := []any{}
+		logError("%s", msg)
 
-		// build up inline query results with cached photos,
-		for _, photo := range photos {
-			caption := photo.Caption
+		// send error message
+		sendMessageCtx, cancel := context.WithTimeout(request.Context, sendMessageTimeout)
+		defer cancel()
+		_, _ = b.SendMessage(sendMessageCtx, chatID, msg, nil)
 
-			if newPhoto, id := bot.NewInlineQueryResultCachedPhoto(photo.FileId); id != nil {
-				newPhoto.Caption = &caption
+		return "", false
+	}
 
-				photoResults = append(photoResults, newPhoto)
-			}
+	if photoID > 0 {
+		if err := db.updateSentPhoto(Photo{
+			ID:         photoID,
+			FileID:     fileID,
+			IsDocument: request.AsDocument,
+			ChatID:     sent.Result.Chat.ID,
+			MessageID:  sent.Result.MessageID,
+		}); err != nil {
+			logError("failed to update photo: %s", err)
 		}
+	}
 
-		// then answer inline query
-		answerQueryCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
-		defer cancel()
-		sent, _ := b.AnswerInlineQuery(
-			answerQueryCtx,
-			inlineQuery.ID,
-			photoResults,
-			nil,
-		)
+	return fileID, true
+}
 
-		if sent.OK {
-			return true
-		}
+// send an error message for a capture request, and return false
+func sendCaptureError(b *bot.Bot, request _captureRequest, message string) bool {
+	logError("%s", message)
 
-		logError("failed to answer inline query: %s", *sent.Description)
-	} else {
+	sendMessageCtx, cancel := context.WithTimeout(request.Context, sendMessageTimeout)
+	defer cancel()
+	_, _ = b.SendMessage(sendMessageCtx, request.ChatID, message, request.MessageOptions)
+
+	return false
+}
+
+// capture an image for the request
+// (for HDR request, bracketed frames are fused into the returned image and also returned;
+// when night mode is used, camera params of the request are replaced with the night ones)
+func captureImage(cam *camera, request *_captureRequest) (original []byte, frames [][]byte, err error) {
+	lightsOff := switchLightsForCapture(lights, cam.name)
+	defer lightsOff()
+
+	capture := func(params map[string]any) ([]byte, error) {
+		return cam.captureStill(request.Context, request.ImageWidth, request.ImageHeight, params)
+	}
+
+	if request.HDR {
+		if !cam.supportsExposure() {
+			return nil, nil, fmt.Errorf("HDR capture is not supported by camera '%s' (%s)", cam.name, cam.config.Backend)
+		}
+		return captureHDRImage(capture, request.CameraParams, hdr.brackets())
+	}
+
+	// night mode
+	if night != nil && cam.supportsExposure() {
+		var params map[string]any
+		if original, params, request.NightMode, err = captureNightImage(capture, request.CameraParams, *night, time.Now()); err != nil {
+			return nil, nil, err
+		}
+		request.CameraParams = params
+
+		return original, nil, nil
+	}
+
+	if original, err = capture(request.CameraParams); err != nil {
+		return nil, nil, err
+	}
+
+	return original, nil, nil
+}
+
+// process burst capture request (should be called while holding the lock of `cam`)
+func processBurstRequest(b *bot.Bot, cam *camera, request _captureRequest) bool {
+	lightsOff := switchLightsForCapture(lights, cam.name)
+	startedAt := time.Now()
+	originals, err := cam.captureBurst(request.Context, request.ImageWidth, request.ImageHeight, request.CameraParams, request.BurstCount, burstInterval)
+	lightsOff()
+	if request.Context.Err() != nil {
+		logMessage("burst capture request of '%s' was canceled: %s", request.UserName, request.Context.Err())
+		return false
+	}
+	if err != nil {
+		message := fmt.Sprintf("Burst capture failed: %s", describeCaptureError(err))
+
+		logError("%s", message)
+
+		sendMessageCtx, cancel := context.WithTimeout(request.Context, sendMessageTimeout)
+		defer cancel()
+		_, _ = b.SendMessage(sendMessageCtx, request.ChatID, message, request.MessageOptions)
+
+		return false
+	}
+
+	notifyTimelapse(cam.name, request.UserName, len(originals), startedAt)
+
+	frames := []_albumFrame{}
+	for i, original := range originals {
+		capturedAt := startedAt.Add(burstInterval * time.Duration(i))
+		frames = append(frames, _albumFrame{
+			Original:   original,
+			CapturedAt: capturedAt,
+			Caption:    capturedAt.Format(captionTimeFormat),
+		})
+	}
+
+	return sendAlbum(b, request, frames)
+}
+
+// notify chats which subscribed timelapse of a finished timelapse (burst capture)
+func notifyTimelapse(cameraName, userName string, count int, startedAt time.Time) {
+	if notifications == nil {
+		return
+	}
+
+	notifications.publish(notification{
+		Topic: topicTimelapse,
+		Text:  fmt.Sprintf("Timelapse of %d images captured by %s (camera: %s)", count, userName, cameraName),
+		Time:  startedAt,
+	})
+}
+
+// process capture request with all cameras, one shot from each
+func processCaptureAllRequest(b *bot.Bot, request _captureRequest) bool {
+	frames, failures := captureWithAllCameras(request)
+	if request.Context.Err() != nil {
+		logMessage("capture request of '%s' with all cameras was canceled: %s", request.UserName, request.Context.Err())
+		return false
+	}
+
+	if len(failures) > 0 {
+		message := fmt.Sprintf("Image capture failed:\n%s", strings.Join(failures, "\n"))
+
+		sendMessageCtx, cancel := context.WithTimeout(request.Context, sendMessageTimeout)
+		defer cancel()
+		_, _ = b.SendMessage(sendMessageCtx, request.ChatID, message, nil)
+	}
+
+	switch len(frames) {
+	case 0:
+		return false
+	case 1: // (a media group needs at least 2 items)
+		frame := frames[0]
+		frameRequest := requestOfFrame(request, frame)
+		frameRequest.MessageOptions = maps.Clone(request.MessageOptions)
+		if frameRequest.MessageOptions == nil {
+			frameRequest.MessageOptions = map[string]any{}
+		}
+		frameRequest.MessageOptions["caption"] = frame.Caption
+
+		bytes, archivePath := prepareImage(frame.Original, frame.CapturedAt, frameRequest)
+		_, sent := sendCapturedImage(b, frameRequest, request.ChatID, bot.NewInputFileFromBytes(bytes), Photo{
+			UserName:    request.UserName,
+			Caption:     frame.Caption,
+			Time:        frame.CapturedAt,
+			ArchivePath: archivePath,
+			IsDocument:  request.AsDocument,
+			Camera:      frameRequest.Camera,
+		})
+		return sent
+	default:
+		return sendAlbum(b, request, frames)
+	}
+}
+
+// capture with all cameras, one shot from each
+// (returns frames of the succeeded ones, and failures of the others; stops when the request is canceled)
+func captureWithAllCameras(request _captureRequest) (frames []_albumFrame, failures []string) {
+	for _, name := range cameraNames {
+		cam := cameras[name]
+
+		cam.Lock()
+		width, height, params := cam.settings()
+		lightsOff := switchLightsForCapture(lights, name)
+		original, err := cam.captureStill(request.Context, width, height, params)
+		lightsOff()
+		cam.Unlock()
+
+		if request.Context.Err() != nil {
+			return frames, failures
+		}
+		if err != nil {
+			logError("image capture with camera '%s' failed: %s", name, err)
+			failures = append(failures, fmt.Sprintf("%s: %s", name, describeCaptureError(err)))
+			continue
+		}
+
+		capturedAt := time.Now()
+		frames = append(frames, _albumFrame{
+			Original:     original,
+			CapturedAt:   capturedAt,
+			Caption:      fmt.Sprintf("%s (%s)", capturedAt.Format(captionTimeFormat), name),
+			CameraParams: params,
+			Camera:       name,
+		})
+	}
+
+	return frames, failures
+}
+
+// requestOfFrame returns a copy of the request with the camera and camera params of given frame (if any)
+func requestOfFrame(request _captureRequest, frame _albumFrame) _captureRequest {
+	if frame.CameraParams != nil {
+		request.CameraParams = frame.CameraParams
+	}
+	if frame.Camera != "" {
+		request.Camera = frame.Camera
+	}
+
+	return request
+}
+
+// archive, post-process, and send captured images as an album
+func sendAlbum(b *bot.Bot, request _captureRequest, frames []_albumFrame) bool {
+	// build up a media group with attached files
+	media := []bot.InputMedia{}
+	options := bot.OptionsSendMediaGroup{}
+	photos := []Photo{}
+	for i, frame := range frames {
+		frameRequest := requestOfFrame(request, frame)
+		bytes, archivePath := prepareImage(frame.Original, frame.CapturedAt, frameRequest)
+
+		attachment := fmt.Sprintf("photo%d", i)
+		options[attachment] = bot.NewInputFileFromBytes(bytes)
+		media = append(media, bot.InputMediaPhoto{
+			Type:    bot.InputMediaTypePhoto,
+			Media:   "attach://" + attachment,
+			Caption: &frame.Caption,
+		})
+
+		photos = append(photos, Photo{
+			UserName:    request.UserName,
+			Caption:     frame.Caption,
+			Time:        frame.CapturedAt,
+			ArchivePath: archivePath,
+			Camera:      frameRequest.Camera,
+		})
+	}
+
+	// 'uploading photo...'
+	chatActionCtx, cancel := context.WithTimeout(request.Context, chatActionTimeout)
+	defer cancel()
+	_, _ = b.SendChatAction(chatActionCtx, request.ChatID, bot.ChatActionUploadPhoto, nil)
+
+	// send media group
+	sendMediaGroupCtx, cancel := context.WithTimeout(request.Context, sendPhotoTimeout*time.Duration(len(media)))
+	defer cancel()
+	if sent, _ := b.SendMediaGroup(sendMediaGroupCtx, request.ChatID, media, options); sent.OK {
+		for i, message := range *sent.Result {
+			if i >= len(photos) || len(message.Photo) <= 0 {
+				continue
+			}
+
+			photo := photos[i]
+			photo.FileID = message.LargestPhoto().FileID
+			photo.ChatID = message.Chat.ID
+			photo.MessageID = message.MessageID
+			if _, err := db.savePhoto(photo); err != nil {
+				logError("failed to save photo: %s", err)
+			}
+		}
+
+		return true
+	} else {
+		msg := fmt.Sprintf("Failed to send photos: %s", *sent.Description)
+
+		logError("%s", msg)
+
+		// send error message
+		sendMessageCtx, cancel := context.WithTimeout(request.Context, sendMessageTimeout)
+		defer cancel()
+		_, _ = b.SendMessage(sendMessageCtx, request.ChatID, msg, nil)
+	}
+
+	return false
+}
+
+// archive, post-process, and write metadata of a captured image,
+// and return the image bytes to be sent and the path of its archived original (if archived)
+func prepareImage(original []byte, capturedAt time.Time, request _captureRequest) (bytes []byte, archivePath string) {
+	var err error
+
+	// archive the original image
+	if archiveDir != "" {
+		if archivePath, err = archiveImage(archiveDir, capturedAt, original); err != nil {
+			logError("failed to archive image: %s", err)
+		}
+	}
+
+	// post-process the image (and burn in the overlay)
+	var overlayLines []string
+	if overlay != nil {
+		overlayLines = overlay.lines(capturedAt)
+	}
+	if bytes, err = processImage(original, request.Processing, overlay, overlayLines); err != nil {
+		logError("failed to process image, sending the original one: %s", err)
+		bytes = original
+	}
+
+	// preserve/inject exif metadata
+	if withExif, err := writeExif(bytes, original, exif, capturedAt, request.CameraParams); err == nil {
+		bytes = withExif
+	} else {
+		logError("failed to write exif metadata: %s", err)
+	}
+
+	return bytes, archivePath
+}
+
+// process inline query
+func processInlineQuery(b *bot.Bot, update bot.Update, inlineQuery bot.InlineQuery) bool {
+	// check username
+	from := update.GetFrom()
+	if from != nil {
+		if !isAvailableID(from.Username) {
+			logError("[inline query] user not allowed: %+v", from.Username)
+			return false
+		}
+	} else {
+		logError("[inline query] user not allowed (has no `from`)")
+		return false
+	}
+
+	userID := *from.Username
+
+	// retrieve cached photos,
+	photos, err := db.getPhotos(userID, numLatestPhotos)
+	if err != nil {
+		logError("failed to retrieve cached photos: %s", err)
+		return false
+	}
+
+	if len(photos) > 0 {
+		photoResults := []any{}
+
+		// build up inline query results with cached photos,
+		for _, photo := range photos {
+			caption := photo.Caption
+
+			if photo.IsDocument {
+				if newDocument, id := bot.NewInlineQueryResultCachedDocument(caption, photo.FileID); id != nil {
+					newDocument.Caption = &caption
+
+					photoResults = append(photoResults, newDocument)
+				}
+			} else if newPhoto, id := bot.NewInlineQueryResultCachedPhoto(photo.FileID); id != nil {
+				newPhoto.Caption = &caption
+
+				photoResults = append(photoResults, newPhoto)
+			}
+		}
+
+		// then answer inline query
+		answerQueryCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
+		defer cancel()
+		sent, _ := b.AnswerInlineQuery(
+			answerQueryCtx,
+			inlineQuery.ID,
+			photoResults,
+			nil,
+		)
+
+		if sent.OK {
+			return true
+		}
+
+		logError("failed to answer inline query: %s", *sent.Description)
+	} else {
 		logError("no cached photos for inline query.")
 	}
 
 	return false
 }
 
+// process callback query (from inline keyboards of photos)
+func processCallbackQuery(b *bot.Bot, update bot.Update, callbackQuery bot.CallbackQuery) bool {
+	// check username
+	from := update.GetFrom()
+	if from != nil {
+		if !isAvailableID(from.Username) {
+			logError("[callback query] user not allowed: %+v", from.Username)
+			return false
+		}
+	} else {
+		logError("[callback query] user not allowed (has no `from`)")
+		return false
+	}
+
+	if callbackQuery.Data == nil || callbackQuery.Message == nil {
+		logError("[callback query] no data or message in callback query")
+		return false
+	}
+	userName := *from.Username
+	chatID := callbackQuery.Message.Chat.ID
+	messageID := callbackQuery.Message.MessageID
+
+	var answer string
+	action, photoID, err := parseCallbackData(*callbackQuery.Data)
+	if err == nil {
+		switch action {
+		case callbackActionRetake:
+			answer, err = retake(userName, chatID, photoID, nil)
+		case callbackActionRetakeBrighter:
+			answer, err = retake(userName, chatID, photoID, brighterCameraParams)
+		case callbackActionZoomCenter:
+			answer, err = retake(userName, chatID, photoID, zoomedCameraParams)
+		case callbackActionPanLeft, callbackActionPanRight, callbackActionTiltUp, callbackActionTiltDown:
+			answer, err = moveAndCapture(userName, chatID, action)
+		case callbackActionOriginal:
+			answer, err = sendOriginal(b, userName, chatID, photoID)
+		case callbackActionFavorite:
+			answer, err = toggleFavorite(b, userName, chatID, messageID, photoID)
+		case callbackActionDelete:
+			answer, err = deletePhoto(b, userName, chatID, messageID, photoID)
+		default:
+			err = fmt.Errorf("unknown callback action: %s", action)
+		}
+	}
+	if err != nil {
+		logError("[callback query] %s", err)
+		answer = err.Error()
+	}
+
+	// answer callback query
+	answerCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
+	defer cancel()
+	if sent, _ := b.AnswerCallbackQuery(answerCtx, callbackQuery.ID, bot.OptionsAnswerCallbackQuery{}.SetText(answer)); !sent.OK {
+		logError("failed to answer callback query: %s", *sent.Description)
+		return false
+	}
+
+	return err == nil
+}
+
+// send the original image of a photo as a document,
+// or request a fresh capture in full resolution if it was not archived
+func sendOriginal(b *bot.Bot, userName string, chatID int64, photoID int64) (answer string, err error) {
+	var photo Photo
+	if photo, err = getAccessiblePhoto(photoID, userName, chatID); err != nil {
+		return "", err
+	}
+
+	if archiveDir != "" && photo.ArchivePath != "" {
+		var original []byte
+		if original, err = readArchivedImage(archiveDir, photo.ArchivePath); err == nil {
+			// 'uploading document...'
+			chatActionCtx, cancel := context.WithTimeout(context.Background(), chatActionTimeout)
+			defer cancel()
+			_, _ = b.SendChatAction(chatActionCtx, chatID, bot.ChatActionUploadDocument, nil)
+
+			// send document
+			sendDocumentCtx, cancel := context.WithTimeout(context.Background(), sendPhotoTimeout)
+			defer cancel()
+			if sent, _ := b.SendDocument(sendDocumentCtx, chatID, bot.NewInputFileFromBytes(original), bot.OptionsSendDocument{}.SetCaption(photo.Caption)); !sent.OK {
+				return "", fmt.Errorf("failed to send original: %s", *sent.Description)
+			}
+
+			return messageSendingOriginal, nil
+		}
+
+		logError("failed to read archived image, capturing a new one: %s", err)
+	}
+
+	// push a full-resolution capture request to the channel
+	cam := cameraNamed(photo.Camera)
+	_, _, params := cam.settings()
+	enqueueCapture(_captureRequest{
+		UserName:       userName,
+		ChatID:         chatID,
+		CameraParams:   params,
+		Camera:         cam.name,
+		AsDocument:     true,
+		MessageOptions: map[string]any{},
+	})
+
+	return messageCapturingOriginal, nil
+}
+
+// request a new capture with the camera of a photo, and its camera params adjusted with `adjust` (if not nil)
+//
+// (camera params can be adjusted only for cameras which support exposure params)
+func retake(userName string, chatID, photoID int64, adjust func(params map[string]any) map[string]any) (answer string, err error) {
+	var photo Photo
+	if photo, err = getAccessiblePhoto(photoID, userName, chatID); err != nil {
+		return "", err
+	}
+	cam := cameraNamed(photo.Camera)
+
+	width, height, params := cam.settings()
+	if adjust != nil {
+		if !cam.supportsExposure() {
+			return "", fmt.Errorf("adjusted retake is not supported by camera '%s' (%s)", cam.name, cam.config.Backend)
+		}
+		params = adjust(params)
+	}
+
+	enqueueCapture(_captureRequest{
+		UserName:       userName,
+		ChatID:         chatID,
+		ImageWidth:     width,
+		ImageHeight:    height,
+		CameraParams:   params,
+		Camera:         cam.name,
+		Processing:     processingPresets[defaultPreset],
+		AsDocument:     sendAsDocument,
+		MessageOptions: bot.OptionsSendMessage{}.SetParseMode(bot.ParseModeMarkdown),
+	})
+
+	return messageRetaking, nil
+}
+
+// request a capture for the chats of a trigger, on its gpio event
+// (captured once, and sent to all the chats)
+func captureTriggered(trigger triggerConfig, event gpioEvent) {
+	logMessage("gpio trigger '%s' fired (line: %d, rising: %t)", trigger.Name, event.Offset, event.Rising)
+
+	cam := cameraNamed(trigger.Camera)
+
+	// notify chats which subscribed motion
+	if notifications != nil {
+		notifications.publish(notification{
+			Topic: topicMotion,
+			Text:  fmt.Sprintf("Motion detected by '%s' (camera: %s)", trigger.Name, cam.name),
+			Time:  event.Time,
+		})
+	}
+
+	if len(trigger.Chats) <= 0 {
+		return
+	}
+
+	width, height, params := cam.settings()
+	enqueueCapture(_captureRequest{
+		UserName:       triggerUserName(trigger),
+		ChatID:         trigger.Chats[0],
+		OtherChatIDs:   trigger.Chats[1:],
+		ImageWidth:     width,
+		ImageHeight:    height,
+		CameraParams:   params,
+		Camera:         cam.name,
+		Trigger:        trigger.Name,
+		Processing:     processingPresets[defaultPreset],
+		AsDocument:     sendAsDocument,
+		MessageOptions: bot.OptionsSendMessage{}.SetParseMode(bot.ParseModeMarkdown),
+	})
+}
+
+// request moving the mount by a step and capturing
+func moveAndCapture(userName string, chatID int64, action string) (answer string, err error) {
+	if mount == nil {
+		return "", fmt.Errorf("%s", messageNoMount)
+	}
+
+	step, back := mount.step(), -mount.step()
+	var move mountMove
+	switch action {
+	case callbackActionPanLeft:
+		move = mountMove{Pan: &back, Relative: true}
+	case callbackActionPanRight:
+		move = mountMove{Pan: &step, Relative: true}
+	case callbackActionTiltUp:
+		move = mountMove{Tilt: &step, Relative: true}
+	case callbackActionTiltDown:
+		move = mountMove{Tilt: &back, Relative: true}
+	}
+
+	cam := cameraNamed(mount.config.Camera)
+	width, height, params := cam.settings()
+	enqueueCapture(_captureRequest{
+		UserName:       userName,
+		ChatID:         chatID,
+		ImageWidth:     width,
+		ImageHeight:    height,
+		CameraParams:   params,
+		Camera:         cam.name,
+		Move:           &move,
+		Processing:     processingPresets[defaultPreset],
+		AsDocument:     sendAsDocument,
+		MessageOptions: bot.OptionsSendMessage{}.SetParseMode(bot.ParseModeMarkdown),
+	})
+
+	return messageMoving, nil
+}
+
+// toggle favorite mark of a photo, and update the inline keyboard of its message
+func toggleFavorite(b *bot.Bot, userName string, chatID, messageID, photoID int64) (answer string, err error) {
+	var photo Photo
+	if photo, err = getAccessiblePhoto(photoID, userName, chatID); err != nil {
+		return "", err
+	}
+
+	favorite := !photo.IsFavorite
+	if err = db.setFavorite(photoID, favorite); err != nil {
+		return "", fmt.Errorf("failed to mark photo %d as favorite: %s", photoID, err)
+	}
+
+	editCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
+	defer cancel()
+	if edited, _ := b.EditMessageReplyMarkup(editCtx, bot.OptionsEditMessageReplyMarkup{}.
+		SetIDs(chatID, messageID).
+		SetReplyMarkup(photoKeyboardMarkup(photoID, favorite, photo.Camera))); !edited.OK {
+		logError("failed to update inline keyboard: %s", *edited.Description)
+	}
+
+	if favorite {
+		return messageFavorited, nil
+	}
+	return messageUnfavorited, nil
+}
+
+// delete a photo (from the inline keyboard of given message)
+func deletePhoto(b *bot.Bot, userName string, chatID, messageID, photoID int64) (answer string, err error) {
+	var photo Photo
+	if photo, err = getAccessiblePhoto(photoID, userName, chatID); err != nil {
+		return "", err
+	}
+
+	// (photos saved before chat and message ids were recorded)
+	if photo.ChatID == 0 || photo.MessageID == 0 {
+		photo.ChatID, photo.MessageID = chatID, messageID
+	}
+
+	if err = removePhoto(b, photo); err != nil {
+		return "", err
+	}
+
+	return messageDeleted, nil
+}
+
+// returns if a photo can be accessed by given user in given chat
+// (taken by the user, or sent to the chat, eg. by a trigger)
+func isPhotoAccessible(photo Photo, userName string, chatID int64) bool {
+	return photo.UserName == userName || (photo.ChatID != 0 && photo.ChatID == chatID)
+}
+
+// get a photo with given id, only if it can be accessed by given user in given chat
+func getAccessiblePhoto(photoID int64, userName string, chatID int64) (photo Photo, err error) {
+	if photo, err = db.getPhoto(photoID); err != nil {
+		return Photo{}, fmt.Errorf("failed to get photo %d: %s", photoID, err)
+	}
+	if !isPhotoAccessible(photo, userName, chatID) {
+		return Photo{}, fmt.Errorf("photo %d is not accessible by '%s' in chat %d", photoID, userName, chatID)
+	}
+
+	return photo, nil
+}
+
+// remove a photo from the local database, archive, and chat
+func removePhoto(b *bot.Bot, photo Photo) error {
+	if err := db.deletePhoto(photo.ID); err != nil {
+		return fmt.Errorf("failed to delete photo %d: %s", photo.ID, err)
+	}
+	if archiveDir != "" && photo.ArchivePath != "" {
+		// (kept if other photos still have it, eg. ones sent to other chats by a trigger)
+		if inUse, err := db.hasArchivePath(photo.ArchivePath); err != nil {
+			logError("failed to check archived image: %s", err)
+		} else if !inUse {
+			if err := deleteArchivedImage(archiveDir, photo.ArchivePath); err != nil {
+				logError("%s", err)
+			}
+		}
+	}
+
+	if photo.ChatID != 0 && photo.MessageID != 0 {
+		deleteCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
+		defer cancel()
+		if deleted, _ := b.DeleteMessage(deleteCtx, photo.ChatID, photo.MessageID); !deleted.OK {
+			logError("failed to delete message: %s", *deleted.Description)
+		}
+	}
+
+	return nil
+}
+
+// process `/delete` command: delete a replied photo, or photos with given ids
+// (only the ones taken by the user, or sent to the chat)
+func processDeleteCommand(b *bot.Bot, message bot.Message, args string) string {
+	userName := *message.From.Username
+	photos := []Photo{}
+
+	if ids := strings.Fields(args); len(ids) > 0 {
+		for _, str := range ids {
+			id, err := strconv.ParseInt(strings.TrimPrefix(str, "#"), 10, 64)
+			if err != nil {
+				return fmt.Sprintf("%s: %s", messageMalformedPhotoID, str)
+			}
+
+			photo, err := db.getPhoto(id)
+			if err != nil || !isPhotoAccessible(photo, userName, message.Chat.ID) {
+				return fmt.Sprintf("%s: %d", messageNoSuchPhoto, id)
+			}
+			photos = append(photos, photo)
+		}
+	} else if message.ReplyToMessage != nil {
+		photo, err := db.getPhotoByMessage(message.Chat.ID, message.ReplyToMessage.MessageID)
+		if err != nil || !isPhotoAccessible(photo, userName, message.Chat.ID) {
+			return messageNoSuchPhoto
+		}
+		photos = append(photos, photo)
+	} else {
+		return messageUsageDelete
+	}
+
+	for _, photo := range photos {
+		if err := removePhoto(b, photo); err != nil {
+			logError("%s", err)
+			return fmt.Sprintf("Failed to delete photo: %s", err)
+		}
+	}
+
+	return fmt.Sprintf("Deleted %d photo(s).", len(photos))
+}
+
+// process `/light` command: switch lights on or off (all lights if no name is given)
+func processLightCommand(args string) string {
+	if len(lights) <= 0 {
+		return messageNoLights
+	}
+
+	state, name, _ := strings.Cut(strings.TrimSpace(args), " ")
+	name = strings.TrimSpace(name)
+
+	var on bool
+	switch state {
+	case lightArgOn:
+		on = true
+	case lightArgOff:
+		on = false
+	default:
+		return messageUsageLight
+	}
+
+	switched := []string{}
+	for _, l := range lights {
+		if name != "" && l.config.Name != name {
+			continue
+		}
+		if err := l.switchManually(on); err != nil {
+			logError("%s", err)
+			return fmt.Sprintf("Failed to switch lights: %s", err)
+		}
+		switched = append(switched, l.config.Name)
+	}
+	if len(switched) <= 0 {
+		return fmt.Sprintf("No such light: %s", name)
+	}
+
+	return fmt.Sprintf("Switched %s: %s", state, strings.Join(switched, ", "))
+}
+
+// process `/subscribe` command: subscribe a topic of notifications for the chat (or list subscriptions)
+func processSubscribeCommand(message bot.Message, args string) string {
+	topic := strings.TrimSpace(args)
+	if topic == "" {
+		subscriptions, err := db.getSubscriptions(message.Chat.ID)
+		if err != nil {
+			logError("failed to get subscriptions: %s", err)
+			return fmt.Sprintf("Failed to get subscriptions: %s", err)
+		}
+		if len(subscriptions) <= 0 {
+			return fmt.Sprintf("No subscriptions.\n%s", messageUsageSubscribe)
+		}
+		topics := []string{}
+		for _, subscription := range subscriptions {
+			topics = append(topics, subscription.Topic)
+		}
+		return fmt.Sprintf("Subscriptions: %s", strings.Join(topics, ", "))
+	}
+
+	if !isNotificationTopic(topic) {
+		return messageUsageSubscribe
+	}
+	if err := db.subscribe(Subscription{
+		ChatID:   message.Chat.ID,
+		Topic:    topic,
+		UserName: *message.From.Username,
+	}); err != nil {
+		logError("failed to subscribe: %s", err)
+		return fmt.Sprintf("Failed to subscribe: %s", err)
+	}
+
+	return fmt.Sprintf("Subscribed to %s.", topic)
+}
+
+// process `/unsubscribe` command: unsubscribe a topic of notifications for the chat
+func processUnsubscribeCommand(message bot.Message, args string) string {
+	topic := strings.TrimSpace(args)
+	if topic == "" { // (topics which are no longer supported can also be unsubscribed)
+		return messageUsageSubscribe
+	}
+
+	if err := db.unsubscribe(message.Chat.ID, topic); err != nil {
+		if errors.Is(err, errSubscriptionNotFound) {
+			return fmt.Sprintf("Not subscribed to %s.", topic)
+		}
+		logError("failed to unsubscribe: %s", err)
+		return fmt.Sprintf("Failed to unsubscribe: %s", err)
+	}
+
+	return fmt.Sprintf("Unsubscribed from %s.", topic)
+}
+
+// process `/quiet` command: set, clear, or show quiet hours of the chat
+func processQuietCommand(message bot.Message, args string) string {
+	args = strings.TrimSpace(args)
+	switch args {
+	case "":
+		hours, err := db.getQuietHours(message.Chat.ID)
+		if err != nil {
+			logError("failed to get quiet hours: %s", err)
+			return fmt.Sprintf("Failed to get quiet hours: %s", err)
+		}
+		if hours == nil {
+			return fmt.Sprintf("%s\n%s", messageNoQuietHours, messageUsageQuiet)
+		}
+		return fmt.Sprintf("Quiet hours: %s", hours)
+	case quietArgOff:
+		if err := db.setQuietHours(message.Chat.ID, nil); err != nil {
+			logError("failed to clear quiet hours: %s", err)
+			return fmt.Sprintf("Failed to clear quiet hours: %s", err)
+		}
+		return "Quiet hours cleared."
+	}
+
+	hours, err := parseQuietHours(args)
+	if err != nil {
+		return fmt.Sprintf("%s\n%s", err, messageUsageQuiet)
+	}
+	if err := db.setQuietHours(message.Chat.ID, &hours); err != nil {
+		logError("failed to set quiet hours: %s", err)
+		return fmt.Sprintf("Failed to set quiet hours: %s", err)
+	}
+
+	return fmt.Sprintf("Quiet hours: %s", hours)
+}
+
+// process `/purge` command: delete photos older than given duration (except favorites) in background
+// (only in admin chats, as it deletes photos of all users)
+func processPurgeCommand(b *bot.Bot, message bot.Message, args string) string {
+	if !isAdminChat(message.Chat.ID) {
+		return messageNotAdminChat
+	}
+
+	flags := flag.NewFlagSet(commandPurge, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	olderThan := flags.String("older-than", "", "")
+	if err := flags.Parse(strings.Fields(args)); err != nil || *olderThan == "" {
+		return messageUsagePurge
+	}
+
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		return fmt.Sprintf("%s: %s", messageUsagePurge, err)
+	}
+
+	photos, err := db.getPhotosBefore(time.Now().Add(-age))
+	if err != nil {
+		logError("failed to get photos for purging: %s", err)
+		return fmt.Sprintf("Failed to get photos: %s", err)
+	}
+	photos = slices.DeleteFunc(photos, func(photo Photo) bool {
+		return photo.IsFavorite
+	})
+	if len(photos) <= 0 {
+		return messageNothingToPurge
+	}
+
+	// (deleting messages one by one can take a while)
+	go func(chatID int64) {
+		purged := 0
+		for _, photo := range photos {
+			if err := removePhoto(b, photo); err != nil {
+				logError("failed to purge photo: %s", err)
+			} else {
+				purged++
+			}
+		}
+
+		sendMessageCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
+		defer cancel()
+		_, _ = b.SendMessage(sendMessageCtx, chatID, fmt.Sprintf("Purged %d photo(s).", purged), nil)
+	}(message.Chat.ID)
+
+	return fmt.Sprintf("Purging %d photo(s) older than %s...", len(photos), *olderThan)
+}
+
 // keyboard markup for reply
 func replyKeyboardMarkup(resize bool) bot.ReplyKeyboardMarkup {
 	return bot.NewReplyKeyboardMarkup(allKeyboards).
@@ -426,6 +1953,65 @@ func replyKeyboardMarkup(resize bool) bot.ReplyKeyboardMarkup {
 }
 
 func main() {
+	launched = time.Now()
+
+	// stdout is reserved for the output of subcommands (eg. `export`)
+	if len(os.Args) > 1 {
+		_stdout.SetOutput(os.Stderr)
+	}
+
+	// (config is checked without being loaded)
+	if len(os.Args) > 1 && os.Args[1] == subcommandCheckConfig {
+		if err := runCheckConfig(os.Args[2:]); err != nil {
+			logError("%s failed: %s", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := setup(); err != nil {
+		logError("failed to set up: %s", err)
+		os.Exit(1)
+	}
+
+	// subcommands
+	if len(os.Args) > 1 {
+		var err error
+
+		switch os.Args[1] {
+		case subcommandExport:
+			err = runExport(os.Args[2:])
+		case subcommandImport:
+			err = runImport(os.Args[2:])
+		case subcommandAgent:
+			err = runAgent(os.Args[2:])
+		default:
+			logError("unknown subcommand: %s", os.Args[1])
+			_ = db.close()
+			os.Exit(1)
+		}
+
+		_ = db.close()
+
+		if err != nil {
+			logError("%s failed: %s", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	err := runBot()
+
+	_ = db.close()
+
+	if err != nil {
+		logError("bot failed: %s", err)
+		os.Exit(1)
+	}
+}
+
+// runBot runs the bot until it gets stopped
+func runBot() error {
 	client := bot.NewClient(apiToken)
 	client.Verbose = isVerbose
 
@@ -435,16 +2021,70 @@ func main() {
 	if me, _ := client.GetMe(getMeCtx); me.OK {
 		logMessage("starting bot: @%s (%s)", *me.Result.Username, me.Result.FirstName)
 
+		botUsername = *me.Result.Username
+
 		// delete webhook (getting updates will not work when wehbook is set up)
 		deleteWebhookCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
 		defer cancel()
 		if unhooked, _ := client.DeleteWebhook(deleteWebhookCtx, false); unhooked.OK {
-			// monitor request capture channel
-			go func() {
-				for request := range captureChannel {
-					// do capture and send response
-					processCaptureRequest(client, request)
+			// open pan/tilt mount
+			if mountConf != nil {
+				var err error
+				if mount, err = openMount(*mountConf); err != nil {
+					logError("failed to open mount, running without it: %s", err)
+				} else {
+					defer func() { _ = mount.close() }()
+				}
+			}
+
+			// open lights
+			if len(lightConfs) > 0 {
+				if opened, chips, err := openLights(lightConfs); err != nil {
+					logError("failed to open lights, running without them: %s", err)
+				} else {
+					lights = opened
+					defer func() {
+						for _, chip := range chips {
+							_ = chip.close()
+						}
+					}()
+				}
+			}
+
+			// notify subscribed chats
+			notifications = newNotifier(db, notificationsConf.digestWindow(), func(chatID int64, text string) error {
+				sendMessageCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
+				defer cancel()
+				if sent, err := client.SendMessage(sendMessageCtx, chatID, text, nil); err != nil {
+					return err
+				} else if !sent.OK {
+					return fmt.Errorf("%s", *sent.Description)
+				}
+				return nil
+			})
+			defer notifications.stop()
+
+			// watch health, and warn admins (and chats which subscribed health)
+			if watchHealth {
+				go health.watch(func(text string) {
+					notifications.publish(notification{Topic: topicHealth, Text: text}, healthConf.AdminChats...)
+				})
+			}
+
+			// watch gpio triggers
+			if len(triggers) > 0 {
+				if _, stop, err := watchTriggers(triggers, captureTriggered); err != nil {
+					logError("failed to watch gpio triggers, running without them: %s", err)
+				} else {
+					defer stop()
 				}
+			}
+
+			// monitor request capture channel (stopped with all pending and in-flight captures canceled)
+			workerStopped := make(chan struct{})
+			go func() {
+				runCaptureWorker(captureCtx, client)
+				close(workerStopped)
 			}()
 
 			// handle updates
@@ -454,6 +2094,17 @@ func main() {
 			client.SetInlineQueryHandler(func(b *bot.Bot, update bot.Update, inlineQuery bot.InlineQuery) {
 				processInlineQuery(b, update, inlineQuery)
 			})
+			client.SetCallbackQueryHandler(func(b *bot.Bot, update bot.Update, callbackQuery bot.CallbackQuery) {
+				processCallbackQuery(b, update, callbackQuery)
+			})
+
+			// reload config when the config file is modified
+			if watchConfigFile {
+				go watchConfig(client)
+			}
+
+			// stop polling on SIGINT or SIGTERM (and reload config on SIGHUP)
+			go handleSignals(client)
 
 			// start polling
 			client.StartPollingUpdates(0, monitorInterval, func(b *bot.Bot, update bot.Update, err error) {
@@ -463,12 +2114,20 @@ func main() {
 					logError("error while receiving update (%s)", err)
 				}
 			})
+
+			// shut down: finish (or cancel) captures, and let admins know
+			drainCaptures(shutdownConf.timeout(), workerStopped)
+			notifyOffline(client)
+
+			logMessage("stopped bot")
 		} else {
-			panic("failed to delete webhook")
+			return fmt.Errorf("failed to delete webhook")
 		}
 	} else {
-		panic("failed to get info of the bot")
+		return fmt.Errorf("failed to get info of the bot")
 	}
+
+	return nil
 }
 
 func logMessage(format string, a ...any) {
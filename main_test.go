@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+// set for running the test binary as the bot itself (for testing it in separate processes)
+const envRunAsBot = "TEST_RUN_AS_BOT"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envRunAsBot) != "" {
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestStripBotUsername(t *testing.T) {
+	tests := []struct {
+		txt      string
+		expected string
+	}{
+		{"/capture@CameraBot", "/capture"},
+		{"/capture@camerabot gray document", "/capture gray document"},
+		{"/burst@CameraBot 5", "/burst 5"},
+		{"/hdr@CameraBot back frames", "/hdr back frames"},
+		{"/capture@OtherBot gray", "/capture@OtherBot gray"},
+		{"/capture gray", "/capture gray"},
+		{"hello @CameraBot", "hello @CameraBot"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if stripped := stripBotUsername(test.txt, "CameraBot"); stripped != test.expected {
+			t.Errorf("expected '%s' from '%s', got '%s'", test.expected, test.txt, stripped)
+		}
+	}
+
+	if stripped := stripBotUsername("/capture@CameraBot", ""); stripped != "/capture@CameraBot" {
+		t.Errorf("nothing should be stripped without the username of the bot, got '%s'", stripped)
+	}
+}
+
+func TestCaptureCommandsWithBotUsername(t *testing.T) {
+	cameras = map[string]*camera{"front": {name: "front"}, "back": {name: "back"}}
+	cameraNames = []string{"front", "back"}
+	processingPresets = map[string][]processingStep{"gray": {{Type: stepAutoLevels}}}
+	defer func() { cameras, cameraNames, processingPresets = nil, nil, nil }()
+
+	// capture
+	txt := stripBotUsername("/capture@CameraBot back gray rotate:90 document", "CameraBot")
+	name, args := splitCameraName(strings.TrimPrefix(txt, commandCapture))
+	steps, asDocument, err := getCaptureOptions(args)
+	if err != nil {
+		t.Fatalf("failed to parse capture options: %s", err)
+	}
+	if name != "back" || !asDocument || len(steps) != 2 || steps[0].Type != stepAutoLevels || steps[1].Degrees != 90 {
+		t.Errorf("unexpected capture options: %s, %+v, %v", name, steps, asDocument)
+	}
+
+	// burst
+	txt = stripBotUsername("/burst@CameraBot 5", "CameraBot")
+	name, args = splitCameraName(strings.TrimPrefix(txt, commandBurst))
+	if count, err := parseBurstCount(args); err != nil || count != 5 || name != "" {
+		t.Errorf("unexpected burst count: %d (%v)", count, err)
+	}
+
+	// hdr
+	txt = stripBotUsername("/hdr@CameraBot front frames", "CameraBot")
+	name, args = splitCameraName(strings.TrimPrefix(txt, commandHDR))
+	if _, _, sendFrames, err := getHDROptions(args); err != nil || !sendFrames || name != "front" {
+		t.Errorf("unexpected hdr options: %s, %v (%v)", name, sendFrames, err)
+	}
+}
+
+func TestDeleteCommandScope(t *testing.T) {
+	db = newMemoryStore()
+	defer func() { db = nil }()
+
+	alice, bob := "alice", "bob"
+	own, _ := db.savePhoto(Photo{UserName: alice, FileID: "a"})
+	others, _ := db.savePhoto(Photo{UserName: bob, FileID: "b", ChatID: 2, MessageID: 20})
+	triggered, _ := db.savePhoto(Photo{UserName: "gpio:doorbell", FileID: "c", ChatID: 1})
+
+	message := bot.Message{From: &bot.User{Username: &alice}, Chat: bot.Chat{ID: 1}}
+
+	// photo of another user in another chat
+	if msg := processDeleteCommand(nil, message, fmt.Sprintf("%d", others)); msg != fmt.Sprintf("%s: %d", messageNoSuchPhoto, others) {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	if _, err := db.getPhoto(others); err != nil {
+		t.Errorf("photo of another user should not be deleted: %s", err)
+	}
+
+	// (nothing is deleted if any of them is not accessible)
+	if msg := processDeleteCommand(nil, message, fmt.Sprintf("%d #%d", own, others)); !strings.HasPrefix(msg, messageNoSuchPhoto) {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	if _, err := db.getPhoto(own); err != nil {
+		t.Errorf("photo should not be deleted: %s", err)
+	}
+
+	// own photo, and a photo sent to the chat
+	if msg := processDeleteCommand(nil, message, fmt.Sprintf("%d #%d", own, triggered)); msg != "Deleted 2 photo(s)." {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	if photos, _ := db.getPhotosSince(time.Time{}); len(photos) != 1 || photos[0].ID != others {
+		t.Errorf("unexpected photos after deletion: %+v", photos)
+	}
+}
+
+func TestPurgeCommandOnlyInAdminChats(t *testing.T) {
+	db = newMemoryStore()
+	adminChats = []int64{100}
+	healthConf = healthConfig{AdminChats: []int64{1}} // (receiving health alerts doesn't make a chat an admin one)
+	defer func() { db, adminChats, healthConf = nil, nil, healthConfig{} }()
+
+	_, _ = db.savePhoto(Photo{UserName: "bob", FileID: "b", Time: time.Now().AddDate(-1, 0, 0)})
+
+	alice := "alice"
+	message := bot.Message{From: &bot.User{Username: &alice}, Chat: bot.Chat{ID: 1}}
+	if msg := processPurgeCommand(nil, message, "--older-than 30d"); msg != messageNotAdminChat {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	if photos, _ := db.getPhotosSince(time.Time{}); len(photos) != 1 {
+		t.Errorf("photos should not be purged out of admin chats")
+	}
+}
+
+// setupCaptureAllCameras sets up cameras for capturing with all of them ("broken" one fails, as `fleet` is not configured)
+func setupCaptureAllCameras(t *testing.T) {
+	t.Helper()
+
+	cameras = map[string]*camera{
+		"front":  {name: "front", config: cameraConfig{Backend: cameraBackendFake, ImageWidth: 64, ImageHeight: 48, CameraParams: map[string]any{"--ev": 1}}},
+		"broken": {name: "broken", config: cameraConfig{Backend: cameraBackendAgent, URL: "http://127.0.0.1:1"}},
+		"back":   {name: "back", config: cameraConfig{Backend: cameraBackendFake, ImageWidth: 32, ImageHeight: 24}},
+	}
+	cameraNames = []string{"front", "broken", "back"}
+	health = newWatchdog(healthConfig{}, nil, func() int { return 0 })
+	fleet, lights = nil, nil
+	t.Cleanup(func() {
+		cameras, cameraNames, health = nil, nil, nil
+	})
+}
+
+func TestCaptureWithAllCameras(t *testing.T) {
+	setupCaptureAllCameras(t)
+
+	// failures of some cameras don't stop captures with the others
+	frames, failures := captureWithAllCameras(_captureRequest{Context: context.Background()})
+	if len(frames) != 2 || frames[0].Camera != "front" || frames[1].Camera != "back" {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	if !slices.Equal(failures, []string{"broken: `fleet` is not configured for camera 'broken'"}) {
+		t.Errorf("unexpected failures: %v", failures)
+	}
+	if frames[0].CameraParams["--ev"] != 1 || !strings.HasSuffix(frames[0].Caption, "(front)") {
+		t.Errorf("unexpected frame: %+v", frames[0])
+	}
+	if size := decodeImageSize(t, frames[1].Original); size != image.Pt(32, 24) {
+		t.Errorf("unexpected image size of back: %v", size)
+	}
+
+	// stops when canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if frames, failures := captureWithAllCameras(_captureRequest{Context: ctx}); len(frames) != 0 || len(failures) != 0 {
+		t.Errorf("expected nothing captured after canceled, got: %+v, %v", frames, failures)
+	}
+}
+
+func TestRequestOfFrame(t *testing.T) {
+	request := _captureRequest{Camera: "front", CameraParams: map[string]any{"--ev": 1}}
+
+	// camera and params of the frame
+	if frameRequest := requestOfFrame(request, _albumFrame{Camera: "back", CameraParams: map[string]any{"--ev": 2}}); frameRequest.Camera != "back" || frameRequest.CameraParams["--ev"] != 2 {
+		t.Errorf("unexpected request: %+v", frameRequest)
+	}
+
+	// the ones of the request if the frame has none
+	if frameRequest := requestOfFrame(request, _albumFrame{}); frameRequest.Camera != "front" || frameRequest.CameraParams["--ev"] != 1 {
+		t.Errorf("unexpected request: %+v", frameRequest)
+	}
+	if request.Camera != "front" || request.CameraParams["--ev"] != 1 {
+		t.Errorf("request should not be changed: %+v", request)
+	}
+}
+
+// useFakeLibcamera replaces libcamera-still with a fake camera script of given body
+func useFakeLibcamera(t *testing.T, body string) {
+	t.Helper()
+
+	bin := libCameraStillBin
+	libCameraStillBin = fakeCameraScript(t, body)
+	t.Cleanup(func() { libCameraStillBin = bin })
+}
+
+// waitForFile waits until a file exists at given path, and returns its content
+func waitForFile(t *testing.T, path string) string {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if bytes, err := os.ReadFile(path); err == nil && len(bytes) > 0 {
+			return strings.TrimSpace(string(bytes))
+		}
+	}
+	t.Fatalf("file was not written: %s", path)
+	return ""
+}
+
+func TestCancelKillsCameraProcess(t *testing.T) {
+	setupRetakeCameras(t)
+	health = newWatchdog(healthConfig{}, nil, func() int { return 0 })
+	defer func() { health = nil }()
+
+	// (camera process which writes its pid, and hangs)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	useFakeLibcamera(t, fmt.Sprintf(`echo $$ > %s; exec sleep 30`, pidFile))
+
+	enqueueCapture(_captureRequest{UserName: "alice", Camera: "front"})
+	request := <-captureChannel
+	captured := make(chan error, 1)
+	go func() {
+		_, err := cameras["front"].captureStill(request.Context, 64, 48, nil)
+		captured <- err
+	}()
+	pid, err := strconv.Atoi(waitForFile(t, pidFile))
+	if err != nil {
+		t.Fatalf("malformed pid: %s", err)
+	}
+
+	if message := processCancelCommand("alice"); message != fmt.Sprintf("%s (1 capture(s))", messageCanceled) {
+		t.Errorf("unexpected message: %s", message)
+	}
+	select {
+	case err := <-captured:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a canceled capture, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("capture was not canceled")
+	}
+
+	// the camera process is killed
+	if process, err := os.FindProcess(pid); err == nil && process.Signal(syscall.Signal(0)) == nil {
+		t.Errorf("camera process %d should be killed", pid)
+	}
+
+	// canceled captures are not counted as failures
+	health.Lock()
+	failures := health.failures["front"]
+	health.Unlock()
+	if failures != 0 {
+		t.Errorf("canceled capture should not be counted as a failure: %d", failures)
+	}
+
+	// (but failed ones are)
+	useFakeLibcamera(t, `echo "ERROR: *** no cameras available ***" >&2; exit 255`)
+	if _, err := cameras["front"].captureStill(context.Background(), 64, 48, nil); err == nil {
+		t.Errorf("expected a failure")
+	}
+	health.Lock()
+	failures = health.failures["front"]
+	health.Unlock()
+	if failures != 1 {
+		t.Errorf("failed capture should be counted: %d", failures)
+	}
+
+	if message := processCancelCommand("alice"); message != messageNothingToCancel {
+		t.Errorf("unexpected message: %s", message)
+	}
+}
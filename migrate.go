@@ -0,0 +1,124 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// up-migrations, embedded in the binary
+//
+// (file names should be in `NNNN_description.sql` format, and will be applied in order)
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration struct
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// loadMigrations reads embedded migrations and returns them sorted by version
+func loadMigrations() (migrations []migration, err error) {
+	var entries []fs.DirEntry
+	if entries, err = migrationFiles.ReadDir("migrations"); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+
+		prefix, _, _ := strings.Cut(name, "_")
+		var version int
+		if version, err = strconv.Atoi(prefix); err != nil {
+			return nil, fmt.Errorf("malformed migration file name: %s", name)
+		}
+
+		var bytes []byte
+		if bytes, err = migrationFiles.ReadFile(path.Join("migrations", name)); err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{
+			Version: version,
+			Name:    name,
+			SQL:     string(bytes),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicated migration version: %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// schemaVersion returns the current schema version of given database
+func schemaVersion(db *sql.DB) (version int, err error) {
+	if _, err = db.Exec(`create table if not exists schema_version(
+		version integer not null,
+		applied_at datetime default current_timestamp
+	)`); err != nil {
+		return 0, fmt.Errorf("failed to create schema_version table: %s", err)
+	}
+
+	if err = db.QueryRow(`select coalesce(max(version), 0) from schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %s", err)
+	}
+
+	return version, nil
+}
+
+// migrateDB applies all pending up-migrations to given database, each in its own transaction
+func migrateDB(db *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		var tx *sql.Tx
+		if tx, err = db.Begin(); err != nil {
+			return fmt.Errorf("failed to begin transaction for migration %s: %s", m.Name, err)
+		}
+		if _, err = tx.Exec(m.SQL); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to apply migration %s: %s", m.Name, err)
+		}
+		if _, err = tx.Exec(`insert into schema_version(version) values(?)`, m.Version); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %s", m.Name, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %s: %s", m.Name, err)
+		}
+
+		logMessage("applied database migration: %s", m.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openBaselineDB opens a database with the schema created by `openDB` before migrations were introduced
+func openBaselineDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), DbFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	for _, query := range []string{
+		`create table if not exists photos(
+			id integer primary key autoincrement,
+			user_name text not null,
+			file_id text not null,
+			caption text default null,
+			time datetime default current_timestamp
+		)`,
+		`create index if not exists idx_photos on photos(
+			user_name,
+			time
+		)`,
+		`insert into photos(user_name, file_id, caption, time) values('alice', 'file-1', 'first', '2020-01-01 00:00:00')`,
+		`insert into photos(user_name, file_id, caption) values('bob', 'file-2', null)`,
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("failed to build baseline database: %s", err)
+		}
+	}
+
+	return db
+}
+
+// latestMigrationVersion returns the version of the last embedded migration
+func latestMigrationVersion(t *testing.T) int {
+	t.Helper()
+
+	migrations, err := loadMigrations()
+	if err != nil || len(migrations) <= 0 {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	return migrations[len(migrations)-1].Version
+}
+
+// columnsOf returns names of the columns of given table
+func columnsOf(t *testing.T, db *sql.DB, table string) (columns []string) {
+	t.Helper()
+
+	rows, err := db.Query(`select name from pragma_table_info(?)`, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		columns = append(columns, name)
+	}
+
+	return columns
+}
+
+// countRows returns the number of rows of given table
+func countRows(t *testing.T, db *sql.DB, table string) (count int) {
+	t.Helper()
+
+	if err := db.QueryRow(`select count(*) from ` + table).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestMigrateBaselineDB(t *testing.T) {
+	db := openBaselineDB(t)
+
+	if err := migrateDB(db); err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+
+	// schema version
+	if version, err := schemaVersion(db); err != nil || version != latestMigrationVersion(t) {
+		t.Errorf("expected schema version %d, got %d (%v)", latestMigrationVersion(t), version, err)
+	}
+
+	// new columns and tables
+	columns := columnsOf(t, db, "photos")
+	for _, column := range []string{"archive_path", "is_document", "is_favorite", "chat_id", "message_id", "camera"} {
+		if !slices.Contains(columns, column) {
+			t.Errorf("expected column '%s' in photos, got %v", column, columns)
+		}
+	}
+	for _, table := range []string{"subscriptions", "quiet_hours"} {
+		if len(columnsOf(t, db, table)) <= 0 {
+			t.Errorf("expected table '%s'", table)
+		}
+	}
+
+	// existing rows with default values
+	rows, err := db.Query(`select user_name, file_id, caption, archive_path, is_document, is_favorite, chat_id, camera from photos order by id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var userNames []string
+	for rows.Next() {
+		var userName, fileID string
+		var caption, archivePath, camera sql.NullString
+		var isDocument, isFavorite bool
+		var chatID sql.NullInt64
+		if err := rows.Scan(&userName, &fileID, &caption, &archivePath, &isDocument, &isFavorite, &chatID, &camera); err != nil {
+			t.Fatal(err)
+		}
+		if archivePath.Valid || isDocument || isFavorite || chatID.Valid || camera.Valid {
+			t.Errorf("expected default values for existing photo %s", fileID)
+		}
+		userNames = append(userNames, userName)
+	}
+	if !slices.Equal(userNames, []string{"alice", "bob"}) {
+		t.Errorf("expected existing photos to survive, got %v", userNames)
+	}
+
+	// the migrated database works as a store
+	store := &Database{db: db}
+	photos, err := store.getPhotosSince(time.Time{})
+	if err != nil || len(photos) != 2 || photos[0].Caption != "first" {
+		t.Errorf("unexpected photos after migration: %+v (%v)", photos, err)
+	}
+}
+
+func TestMigrateTwice(t *testing.T) {
+	db := openBaselineDB(t)
+
+	if err := migrateDB(db); err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+	applied := countRows(t, db, "schema_version")
+	columns := columnsOf(t, db, "photos")
+
+	if err := migrateDB(db); err != nil {
+		t.Fatalf("failed to migrate again: %s", err)
+	}
+	if count := countRows(t, db, "schema_version"); count != applied {
+		t.Errorf("expected no more applied migrations, got %d (was %d)", count, applied)
+	}
+	if after := columnsOf(t, db, "photos"); !slices.Equal(after, columns) {
+		t.Errorf("expected the same columns, got %v (was %v)", after, columns)
+	}
+	if count := countRows(t, db, "photos"); count != 2 {
+		t.Errorf("expected 2 photos, got %d", count)
+	}
+}
+
+func TestMigrateEmptyDB(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), DbFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if err := migrateDB(db); err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+	if count := countRows(t, db, "schema_version"); count != latestMigrationVersion(t) {
+		t.Errorf("expected all %d migrations applied, got %d", latestMigrationVersion(t), count)
+	}
+}
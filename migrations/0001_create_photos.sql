@@ -0,0 +1,12 @@
+-- initial schema (same as the one created by `openDB` before migrations were introduced)
+create table if not exists photos(
+	id integer primary key autoincrement,
+	user_name text not null,
+	file_id text not null,
+	caption text default null,
+	time datetime default current_timestamp
+);
+create index if not exists idx_photos on photos(
+	user_name,
+	time
+);
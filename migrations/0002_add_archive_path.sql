@@ -0,0 +1,2 @@
+-- path of the archived original image (relative to `archive_dir`)
+alter table photos add column archive_path text default null;
@@ -0,0 +1,2 @@
+-- whether the photo was sent as a document (uncompressed) or not
+alter table photos add column is_document integer not null default 0;
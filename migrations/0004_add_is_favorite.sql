@@ -0,0 +1,2 @@
+-- whether the photo was marked as favorite or not
+alter table photos add column is_favorite integer not null default 0;
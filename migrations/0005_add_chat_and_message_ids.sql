@@ -0,0 +1,7 @@
+-- chat id and message id of the sent photo (for deleting it from the chat later)
+alter table photos add column chat_id integer default null;
+alter table photos add column message_id integer default null;
+create index if not exists idx_photos_message on photos(
+	chat_id,
+	message_id
+);
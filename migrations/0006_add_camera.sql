@@ -0,0 +1,2 @@
+-- name of the camera which captured the photo (for retaking with the same camera)
+alter table photos add column camera text default null;
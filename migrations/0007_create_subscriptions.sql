@@ -0,0 +1,18 @@
+-- topics of notifications subscribed by chats (eg. motion, health)
+create table if not exists subscriptions(
+	chat_id integer not null,
+	topic text not null,
+	user_name text not null,
+	time datetime default current_timestamp,
+	primary key(chat_id, topic)
+);
+create index if not exists idx_subscriptions_topic on subscriptions(
+	topic
+);
+
+-- quiet hours of chats (in minutes from midnight, local time)
+create table if not exists quiet_hours(
+	chat_id integer primary key,
+	start_minute integer not null,
+	end_minute integer not null
+);
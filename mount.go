@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// mount drivers
+	mountDriverPWM     = "pwm"     // hardware PWM via sysfs
+	mountDriverPCA9685 = "pca9685" // PCA9685 PWM controller via I2C
+	mountDriverFake    = "fake"    // no-op (for testing without mounts)
+
+	// default values for mounts
+	defaultServoMinPulseMicros = 500  // pulse width for -90 degrees
+	defaultServoMaxPulseMicros = 2500 // pulse width for +90 degrees
+	defaultMountStepDegrees    = 10
+	defaultMountSettleMillis   = 500
+	defaultPCA9685Bus          = 1
+	defaultPCA9685Address      = 0x40
+
+	// servos are controlled with 50Hz PWM
+	servoPWMPeriod = 20 * time.Millisecond
+
+	// range of servo angles
+	minServoDegrees = -90
+	maxServoDegrees = 90
+
+	// sysfs pwm
+	sysfsPWMDir         = "/sys/class/pwm"
+	sysfsPWMExportDelay = 100 * time.Millisecond
+)
+
+// Mount is an interface for drivers of pan/tilt mounts
+type Mount interface {
+	// setPulse sets the pulse width of given servo channel
+	setPulse(channel int, pulse time.Duration) error
+
+	// close releases the resources of the driver
+	close() error
+}
+
+// mountConfig is a configuration of a pan/tilt mount
+type mountConfig struct {
+	Driver string `json:"driver"`           // "pwm", "pca9685", or "fake"
+	Camera string `json:"camera,omitempty"` // name of the camera on the mount (default camera if empty)
+
+	Pan  mountAxisConfig `json:"pan"`
+	Tilt mountAxisConfig `json:"tilt"`
+
+	// for `pwm`
+	PWMChip int `json:"pwm_chip,omitempty"`
+
+	// for `pca9685`
+	I2CBus     *int `json:"i2c_bus,omitempty"`     // default: 1
+	I2CAddress *int `json:"i2c_address,omitempty"` // default: 0x40 (64)
+
+	// pulse widths of servos in microseconds for -90 and +90 degrees
+	MinPulseMicros int `json:"min_pulse_us,omitempty"`
+	MaxPulseMicros int `json:"max_pulse_us,omitempty"`
+
+	StepDegrees  float64 `json:"step,omitempty"`      // degrees of a move with arrow buttons
+	SettleMillis int     `json:"settle_ms,omitempty"` // time for waiting servos to settle before capturing
+
+	// named positions
+	Presets map[string]mountPosition `json:"presets,omitempty"`
+}
+
+// mountAxisConfig is a configuration of an axis (servo) of a mount
+type mountAxisConfig struct {
+	Channel int      `json:"channel"`
+	Min     *float64 `json:"min,omitempty"` // in degrees (default: -90)
+	Max     *float64 `json:"max,omitempty"` // in degrees (default: 90)
+	Invert  bool     `json:"invert"`
+}
+
+// mountPosition is a position of a mount in degrees
+type mountPosition struct {
+	Pan  float64 `json:"pan"`
+	Tilt float64 `json:"tilt"`
+}
+
+// String returns a short description of the position
+func (p mountPosition) String() string {
+	return fmt.Sprintf("pan %g°, tilt %g°", p.Pan, p.Tilt)
+}
+
+// mountMove is a move of a mount (nil values for not moving the axis)
+type mountMove struct {
+	Pan      *float64
+	Tilt     *float64
+	Relative bool // move relative to the current position
+}
+
+// validate checks if the mount config has valid values
+func (c mountConfig) validate() error {
+	switch c.Driver {
+	case mountDriverPWM, mountDriverPCA9685, mountDriverFake:
+	default:
+		return fmt.Errorf("unknown mount driver: %s", c.Driver)
+	}
+	if c.Pan.Channel < 0 || c.Tilt.Channel < 0 {
+		return fmt.Errorf("servo channels should not be negative: %d, %d", c.Pan.Channel, c.Tilt.Channel)
+	}
+	if c.Pan.Channel == c.Tilt.Channel {
+		return fmt.Errorf("servo channels of pan and tilt should differ: %d", c.Pan.Channel)
+	}
+	for _, axis := range []mountAxisConfig{c.Pan, c.Tilt} {
+		if axis.min() >= axis.max() {
+			return fmt.Errorf("malformed range of servo: %g ~ %g", axis.min(), axis.max())
+		}
+	}
+	if c.MinPulseMicros < 0 || c.MaxPulseMicros < 0 || (c.MaxPulseMicros > 0 && c.MinPulseMicros >= c.MaxPulseMicros) {
+		return fmt.Errorf("malformed pulse widths: %d ~ %d", c.MinPulseMicros, c.MaxPulseMicros)
+	}
+	if c.StepDegrees < 0 || c.SettleMillis < 0 {
+		return fmt.Errorf("step and settle time should not be negative: %g, %d", c.StepDegrees, c.SettleMillis)
+	}
+
+	return nil
+}
+
+// min returns the minimum angle of the axis
+func (a mountAxisConfig) min() float64 {
+	if a.Min == nil {
+		return minServoDegrees
+	}
+	return math.Max(*a.Min, minServoDegrees)
+}
+
+// max returns the maximum angle of the axis
+func (a mountAxisConfig) max() float64 {
+	if a.Max == nil {
+		return maxServoDegrees
+	}
+	return math.Min(*a.Max, maxServoDegrees)
+}
+
+// panTilt controls a pan/tilt mount with its driver
+type panTilt struct {
+	sync.Mutex
+
+	config   mountConfig
+	driver   Mount
+	position mountPosition
+}
+
+// openMount opens the driver of given config, and moves the mount to the center
+func openMount(config mountConfig) (m *panTilt, err error) {
+	var driver Mount
+	switch config.Driver {
+	case mountDriverPWM:
+		driver, err = openSysfsPWM(config.PWMChip, config.Pan.Channel, config.Tilt.Channel)
+	case mountDriverPCA9685:
+		bus, address := defaultPCA9685Bus, defaultPCA9685Address
+		if config.I2CBus != nil {
+			bus = *config.I2CBus
+		}
+		if config.I2CAddress != nil {
+			address = *config.I2CAddress
+		}
+		driver, err = openPCA9685(bus, address)
+	default:
+		driver = &fakeMount{}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mount driver (%s): %w", config.Driver, err)
+	}
+
+	m = &panTilt{config: config, driver: driver}
+	if err = m.moveTo(mountPosition{}); err != nil {
+		_ = driver.close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// step returns degrees of a move with arrow buttons
+func (m *panTilt) step() float64 {
+	if m.config.StepDegrees > 0 {
+		return m.config.StepDegrees
+	}
+	return defaultMountStepDegrees
+}
+
+// current returns the current position
+func (m *panTilt) current() mountPosition {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.position
+}
+
+// move moves the mount, and waits for the servos to settle
+func (m *panTilt) move(move mountMove) (mountPosition, error) {
+	m.Lock()
+	target := m.position
+	m.Unlock()
+
+	if move.Pan != nil {
+		if move.Relative {
+			target.Pan += *move.Pan
+		} else {
+			target.Pan = *move.Pan
+		}
+	}
+	if move.Tilt != nil {
+		if move.Relative {
+			target.Tilt += *move.Tilt
+		} else {
+			target.Tilt = *move.Tilt
+		}
+	}
+
+	if err := m.moveTo(target); err != nil {
+		return m.current(), err
+	}
+
+	settle := time.Duration(m.config.SettleMillis) * time.Millisecond
+	if m.config.SettleMillis <= 0 {
+		settle = defaultMountSettleMillis * time.Millisecond
+	}
+	time.Sleep(settle)
+
+	return m.current(), nil
+}
+
+// moveTo moves the mount to given position (clamped into the ranges of axes)
+func (m *panTilt) moveTo(position mountPosition) error {
+	m.Lock()
+	defer m.Unlock()
+
+	position.Pan = math.Min(math.Max(position.Pan, m.config.Pan.min()), m.config.Pan.max())
+	position.Tilt = math.Min(math.Max(position.Tilt, m.config.Tilt.min()), m.config.Tilt.max())
+
+	if err := m.driver.setPulse(m.config.Pan.Channel, m.pulse(m.config.Pan, position.Pan)); err != nil {
+		return fmt.Errorf("failed to pan: %w", err)
+	}
+	if err := m.driver.setPulse(m.config.Tilt.Channel, m.pulse(m.config.Tilt, position.Tilt)); err != nil {
+		return fmt.Errorf("failed to tilt: %w", err)
+	}
+	m.position = position
+
+	return nil
+}
+
+// pulse returns the pulse width of given angle of an axis
+func (m *panTilt) pulse(axis mountAxisConfig, degrees float64) time.Duration {
+	minPulse, maxPulse := defaultServoMinPulseMicros, defaultServoMaxPulseMicros
+	if m.config.MaxPulseMicros > 0 {
+		minPulse, maxPulse = m.config.MinPulseMicros, m.config.MaxPulseMicros
+	}
+	if axis.Invert {
+		degrees = -degrees
+	}
+
+	ratio := (degrees - minServoDegrees) / (maxServoDegrees - minServoDegrees)
+	micros := float64(minPulse) + ratio*float64(maxPulse-minPulse)
+
+	return time.Duration(math.Round(micros)) * time.Microsecond
+}
+
+// close releases the driver of the mount
+func (m *panTilt) close() error {
+	return m.driver.close()
+}
+
+// parseMountDegrees parses absolute degrees from given text (eg. "30", "-15")
+func parseMountDegrees(str string) (degrees float64, err error) {
+	if degrees, err = strconv.ParseFloat(strings.TrimSpace(str), 64); err != nil || math.IsNaN(degrees) || math.IsInf(degrees, 0) {
+		return 0, fmt.Errorf("malformed degrees: %s", str)
+	}
+
+	return degrees, nil
+}
+
+// fakeMount is a no-op driver of mounts (for testing)
+type fakeMount struct {
+	sync.Mutex
+
+	pulses map[int]time.Duration
+}
+
+// setPulse remembers the pulse width of given channel
+func (f *fakeMount) setPulse(channel int, pulse time.Duration) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.pulses == nil {
+		f.pulses = map[int]time.Duration{}
+	}
+	f.pulses[channel] = pulse
+
+	return nil
+}
+
+// pulse returns the remembered pulse width of given channel
+func (f *fakeMount) pulse(channel int) time.Duration {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.pulses[channel]
+}
+
+// channels returns channels which have pulse widths, in order
+func (f *fakeMount) channels() []int {
+	f.Lock()
+	defer f.Unlock()
+
+	return slices.Sorted(maps.Keys(f.pulses))
+}
+
+// close does nothing
+func (f *fakeMount) close() error {
+	return nil
+}
+
+// sysfsPWM is a driver of mounts with hardware PWM channels via sysfs
+type sysfsPWM struct {
+	chipDir string
+}
+
+// openSysfsPWM exports and enables given channels of a pwm chip
+func openSysfsPWM(chip int, channels ...int) (*sysfsPWM, error) {
+	p := &sysfsPWM{chipDir: filepath.Join(sysfsPWMDir, fmt.Sprintf("pwmchip%d", chip))}
+
+	for _, channel := range channels {
+		channelDir := p.channelDir(channel)
+		if _, err := os.Stat(channelDir); os.IsNotExist(err) {
+			if err := os.WriteFile(filepath.Join(p.chipDir, "export"), []byte(strconv.Itoa(channel)), 0o200); err != nil {
+				return nil, fmt.Errorf("failed to export pwm channel %d: %w", channel, err)
+			}
+			time.Sleep(sysfsPWMExportDelay) // (wait for udev to set permissions)
+		}
+		if err := p.write(channel, "period", servoPWMPeriod.Nanoseconds()); err != nil {
+			return nil, err
+		}
+		if err := p.write(channel, "enable", 1); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// channelDir returns the sysfs directory of given channel
+func (p *sysfsPWM) channelDir(channel int) string {
+	return filepath.Join(p.chipDir, fmt.Sprintf("pwm%d", channel))
+}
+
+// write writes a value to a sysfs file of given channel
+func (p *sysfsPWM) write(channel int, name string, value int64) error {
+	if err := os.WriteFile(filepath.Join(p.channelDir(channel), name), []byte(strconv.FormatInt(value, 10)), 0o200); err != nil {
+		return fmt.Errorf("failed to write %s of pwm channel %d: %w", name, channel, err)
+	}
+
+	return nil
+}
+
+// setPulse sets the duty cycle of given channel
+func (p *sysfsPWM) setPulse(channel int, pulse time.Duration) error {
+	return p.write(channel, "duty_cycle", pulse.Nanoseconds())
+}
+
+// close does nothing (channels are left enabled for holding the position)
+func (p *sysfsPWM) close() error {
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	// registers of PCA9685
+	pca9685RegMode1    = 0x00
+	pca9685RegLED0OnL  = 0x06
+	pca9685RegPrescale = 0xfe
+
+	// bits of MODE1 register
+	pca9685Mode1Restart = 0x80
+	pca9685Mode1AutoInc = 0x20
+	pca9685Mode1Sleep   = 0x10
+
+	pca9685OscillatorHz = 25000000
+	pca9685Resolution   = 4096
+	pca9685Channels     = 16
+	pca9685WakeUpDelay  = 5 * time.Millisecond
+)
+
+// pca9685 is a driver of mounts with PCA9685 PWM controller via I2C
+type pca9685 struct {
+	device io.WriteCloser
+}
+
+// openPCA9685 opens a PCA9685 on given I2C bus and address, and sets its frequency for servos
+func openPCA9685(bus, address int) (*pca9685, error) {
+	device, err := openI2CDevice(bus, address)
+	if err != nil {
+		return nil, err
+	}
+	p := &pca9685{device: device}
+
+	// prescale = round(oscillator / (resolution * frequency)) - 1
+	frequency := float64(time.Second) / float64(servoPWMPeriod)
+	prescale := byte(math.Round(pca9685OscillatorHz/(pca9685Resolution*frequency)) - 1)
+
+	// (prescale can be set only while sleeping)
+	for _, values := range [][]byte{
+		{pca9685RegMode1, pca9685Mode1Sleep},
+		{pca9685RegPrescale, prescale},
+		{pca9685RegMode1, 0},
+	} {
+		if err := p.write(values...); err != nil {
+			_ = device.Close()
+			return nil, err
+		}
+	}
+	time.Sleep(pca9685WakeUpDelay)
+	if err := p.write(pca9685RegMode1, pca9685Mode1Restart|pca9685Mode1AutoInc); err != nil {
+		_ = device.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// write writes bytes (register and its values) to the device
+func (p *pca9685) write(values ...byte) error {
+	if _, err := p.device.Write(values); err != nil {
+		return fmt.Errorf("failed to write to PCA9685: %w", err)
+	}
+
+	return nil
+}
+
+// setPulse sets the pulse width of given channel
+func (p *pca9685) setPulse(channel int, pulse time.Duration) error {
+	if channel >= pca9685Channels {
+		return fmt.Errorf("no such channel of PCA9685: %d", channel)
+	}
+
+	off := uint16(math.Round(float64(pulse) / float64(servoPWMPeriod) * pca9685Resolution))
+
+	return p.write(
+		byte(pca9685RegLED0OnL+4*channel),
+		0, 0, // on at 0
+		byte(off&0xff), byte(off>>8),
+	)
+}
+
+// close closes the device
+func (p *pca9685) close() error {
+	return p.device.Close()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+// openFakeMount opens a mount of given config with the fake driver
+func openFakeMount(t *testing.T, config mountConfig) (*panTilt, *fakeMount) {
+	t.Helper()
+
+	config.Driver = mountDriverFake
+	if config.Pan.Channel == config.Tilt.Channel {
+		config.Tilt.Channel = config.Pan.Channel + 1
+	}
+	if config.SettleMillis <= 0 {
+		config.SettleMillis = 1
+	}
+	if err := config.validate(); err != nil {
+		t.Fatalf("invalid mount config: %s", err)
+	}
+
+	m, err := openMount(config)
+	if err != nil {
+		t.Fatalf("failed to open mount: %s", err)
+	}
+
+	return m, m.driver.(*fakeMount)
+}
+
+// degrees returns a pointer to given degrees (for optional values of configs and moves)
+func degrees(v float64) *float64 {
+	return &v
+}
+
+func TestMountPulses(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     mountConfig
+		position   mountPosition
+		panPulse   time.Duration
+		tiltPulse  time.Duration
+		clampedPan float64
+	}{
+		{
+			name:      "center",
+			position:  mountPosition{},
+			panPulse:  1500 * time.Microsecond,
+			tiltPulse: 1500 * time.Microsecond,
+		},
+		{
+			name:       "ends",
+			position:   mountPosition{Pan: 90, Tilt: -90},
+			panPulse:   2500 * time.Microsecond,
+			tiltPulse:  500 * time.Microsecond,
+			clampedPan: 90,
+		},
+		{
+			name:       "half",
+			position:   mountPosition{Pan: 45, Tilt: -45},
+			panPulse:   2000 * time.Microsecond,
+			tiltPulse:  1000 * time.Microsecond,
+			clampedPan: 45,
+		},
+		{
+			name:       "inverted",
+			config:     mountConfig{Tilt: mountAxisConfig{Invert: true}},
+			position:   mountPosition{Pan: 45, Tilt: 45},
+			panPulse:   2000 * time.Microsecond,
+			tiltPulse:  1000 * time.Microsecond,
+			clampedPan: 45,
+		},
+		{
+			name:       "custom pulse widths",
+			config:     mountConfig{MinPulseMicros: 1000, MaxPulseMicros: 2000},
+			position:   mountPosition{Pan: 90, Tilt: -45},
+			panPulse:   2000 * time.Microsecond,
+			tiltPulse:  1250 * time.Microsecond,
+			clampedPan: 90,
+		},
+		{
+			name:       "clamped into range",
+			config:     mountConfig{Pan: mountAxisConfig{Min: degrees(-30), Max: degrees(30)}},
+			position:   mountPosition{Pan: 60, Tilt: 120},
+			panPulse:   1833 * time.Microsecond, // (rounded)
+			tiltPulse:  2500 * time.Microsecond,
+			clampedPan: 30,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, driver := openFakeMount(t, test.config)
+
+			if err := m.moveTo(test.position); err != nil {
+				t.Fatalf("failed to move: %s", err)
+			}
+			if pulse := driver.pulse(m.config.Pan.Channel); pulse != test.panPulse {
+				t.Errorf("expected pan pulse %s, got %s", test.panPulse, pulse)
+			}
+			if pulse := driver.pulse(m.config.Tilt.Channel); pulse != test.tiltPulse {
+				t.Errorf("expected tilt pulse %s, got %s", test.tiltPulse, pulse)
+			}
+			if current := m.current(); current.Pan != test.clampedPan {
+				t.Errorf("expected pan %g, got %g", test.clampedPan, current.Pan)
+			}
+		})
+	}
+}
+
+func TestMountMoves(t *testing.T) {
+	m, driver := openFakeMount(t, mountConfig{Pan: mountAxisConfig{Channel: 2}, Tilt: mountAxisConfig{Channel: 5}})
+
+	// centered when opened
+	if current := m.current(); current != (mountPosition{}) {
+		t.Errorf("expected the center, got %s", current)
+	}
+	if channels := driver.channels(); !slices.Equal(channels, []int{2, 5}) {
+		t.Errorf("unexpected channels: %v", channels)
+	}
+
+	// absolute pan only
+	if position, err := m.move(mountMove{Pan: degrees(30)}); err != nil || position != (mountPosition{Pan: 30}) {
+		t.Errorf("unexpected position: %s (%v)", position, err)
+	}
+
+	// relative moves (with arrow buttons)
+	step := m.step()
+	if position, _ := m.move(mountMove{Tilt: &step, Relative: true}); position != (mountPosition{Pan: 30, Tilt: defaultMountStepDegrees}) {
+		t.Errorf("unexpected position: %s", position)
+	}
+	back := -100.0
+	if position, _ := m.move(mountMove{Pan: &back, Relative: true}); position != (mountPosition{Pan: -70, Tilt: defaultMountStepDegrees}) {
+		t.Errorf("unexpected position: %s", position)
+	}
+	if position, _ := m.move(mountMove{Pan: &back, Relative: true}); position.Pan != minServoDegrees {
+		t.Errorf("expected to be clamped at %d, got %s", minServoDegrees, position)
+	}
+	if pulse := driver.pulse(2); pulse != defaultServoMinPulseMicros*time.Microsecond {
+		t.Errorf("unexpected pan pulse: %s", pulse)
+	}
+}
+
+func TestParseMountDegrees(t *testing.T) {
+	for str, expected := range map[string]float64{"30": 30, " -15 ": -15, "7.5": 7.5} {
+		if degrees, err := parseMountDegrees(str); err != nil || degrees != expected {
+			t.Errorf("expected %g from '%s', got %g (%v)", expected, str, degrees, err)
+		}
+	}
+	for _, str := range []string{"", "left", "NaN", "Inf"} {
+		if _, err := parseMountDegrees(str); err == nil {
+			t.Errorf("expected an error for '%s'", str)
+		}
+	}
+}
+
+// nopWriteCloser is a buffer for testing writes to devices
+type nopWriteCloser struct {
+	bytes.Buffer
+}
+
+func (n *nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestPCA9685Pulse(t *testing.T) {
+	device := &nopWriteCloser{}
+	p := &pca9685{device: device}
+
+	// 1.5ms of 20ms period = 307.2 / 4096 ticks
+	if err := p.setPulse(3, 1500*time.Microsecond); err != nil {
+		t.Fatalf("failed to set pulse: %s", err)
+	}
+	if expected := []byte{pca9685RegLED0OnL + 4*3, 0, 0, 0x33, 0x01}; !bytes.Equal(device.Bytes(), expected) {
+		t.Errorf("expected %v, got %v", expected, device.Bytes())
+	}
+
+	if err := p.setPulse(pca9685Channels, time.Millisecond); err == nil {
+		t.Errorf("expected an error for a channel out of range")
+	}
+}
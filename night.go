@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"maps"
+	"math"
+	"time"
+)
+
+const (
+	// camera params for night mode
+	cameraParamGain = "--gain"
+
+	// default values for night mode
+	defaultNightLuminanceThreshold = 0.15    // mean luminance (0.0 ~ 1.0) under which the capture is retaken in night mode
+	defaultNightShutterMicros      = 1000000 // 1 second
+	defaultNightGain               = 8.0
+
+	// pixels are sampled at this interval for measuring luminance
+	luminanceSamplingStep = 4
+
+	// constants for computing sunrise/sunset times
+	julianDayUnixEpoch = 2440587.5
+	julianDayJ2000     = 2451545.0
+	sunriseAltitude    = -0.833  // in degrees, (refraction + radius of the sun)
+	earthAxialTilt     = 23.4397 // in degrees
+)
+
+// nightModeConfig is a configuration for capturing in low light
+type nightModeConfig struct {
+	// capture is retaken with night params when its mean luminance is under this threshold (0.0 ~ 1.0)
+	LuminanceThreshold float64 `json:"luminance_threshold,omitempty"`
+
+	// camera params merged when capturing in night mode (default: 1 second of shutter speed and gain of 8)
+	CameraParams map[string]any `json:"camera_params,omitempty"`
+
+	// if both are set, night mode is used directly between sunset and sunrise of this location
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// validate checks if the night mode config has valid values
+func (c nightModeConfig) validate() error {
+	if c.LuminanceThreshold < 0 || c.LuminanceThreshold > 1 {
+		return fmt.Errorf("luminance threshold should be within 0.0 ~ 1.0: %g", c.LuminanceThreshold)
+	}
+	if (c.Latitude == nil) != (c.Longitude == nil) {
+		return fmt.Errorf("both latitude and longitude should be set for night mode")
+	}
+	if c.Latitude != nil && (*c.Latitude < -90 || *c.Latitude > 90) {
+		return fmt.Errorf("latitude should be within -90 ~ 90: %g", *c.Latitude)
+	}
+	if c.Longitude != nil && (*c.Longitude < -180 || *c.Longitude > 180) {
+		return fmt.Errorf("longitude should be within -180 ~ 180: %g", *c.Longitude)
+	}
+
+	return nil
+}
+
+// isDark returns if given jpeg image is too dark to be sent without night mode
+func (c nightModeConfig) isDark(jpegBytes []byte) (bool, error) {
+	threshold := c.LuminanceThreshold
+	if threshold <= 0 {
+		threshold = defaultNightLuminanceThreshold
+	}
+
+	luminance, err := meanLuminance(jpegBytes)
+	if err != nil {
+		return false, err
+	}
+
+	return luminance < threshold, nil
+}
+
+// isNightTime returns if given time is between sunset and sunrise of the configured location
+// (always false if the location is not configured)
+func (c nightModeConfig) isNightTime(t time.Time) bool {
+	if c.Latitude == nil || c.Longitude == nil {
+		return false
+	}
+
+	sunrise, sunset, polar := sunTimes(t, *c.Latitude, *c.Longitude)
+	switch polar {
+	case polarDay:
+		return false
+	case polarNight:
+		return true
+	}
+
+	return t.Before(sunrise) || t.After(sunset)
+}
+
+// cameraParams returns a copy of camera params merged with the ones of night mode
+func (c nightModeConfig) cameraParams(params map[string]any) map[string]any {
+	params = cloneCameraParams(params)
+	if len(c.CameraParams) > 0 {
+		maps.Copy(params, c.CameraParams)
+	} else {
+		params[cameraParamShutter] = defaultNightShutterMicros
+		params[cameraParamGain] = defaultNightGain
+	}
+
+	return params
+}
+
+// captureNightImage captures a still image in night mode between sunset and sunrise (of `now`),
+// or retakes it in night mode when it is too dark
+//
+// returns the camera params which were used for the returned image, and if night mode was used
+func captureNightImage(
+	capture func(cameraParams map[string]any) ([]byte, error),
+	cameraParams map[string]any,
+	conf nightModeConfig,
+	now time.Time,
+) (captured []byte, usedParams map[string]any, nightMode bool, err error) {
+	// use night mode between sunset and sunrise
+	if conf.isNightTime(now) {
+		params := conf.cameraParams(cameraParams)
+		if captured, err = capture(params); err != nil {
+			return nil, nil, false, err
+		}
+		return captured, params, true, nil
+	}
+
+	if captured, err = capture(cameraParams); err != nil {
+		return nil, nil, false, err
+	}
+
+	// retake in night mode if it is too dark
+	if dark, err := conf.isDark(captured); err != nil {
+		logError("failed to measure luminance: %s", err)
+	} else if dark {
+		params := conf.cameraParams(cameraParams)
+		if retaken, err := capture(params); err == nil {
+			return retaken, params, true, nil
+		} else {
+			logError("failed to retake in night mode: %s", err)
+		}
+	}
+
+	return captured, cameraParams, false, nil
+}
+
+// meanLuminance returns the mean luminance (0.0 ~ 1.0) of given jpeg image
+func meanLuminance(jpegBytes []byte) (float64, error) {
+	img, err := jpeg.Decode(bytes.NewReader(jpegBytes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	return imageLuminance(img), nil
+}
+
+// imageLuminance returns the mean luminance (0.0 ~ 1.0) of sampled pixels of given image
+func imageLuminance(img image.Image) float64 {
+	bounds := img.Bounds()
+
+	sum, count := 0.0, 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += luminanceSamplingStep {
+		for x := bounds.Min.X; x < bounds.Max.X; x += luminanceSamplingStep {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+			count++
+		}
+	}
+	if count <= 0 {
+		return 0
+	}
+
+	return sum / float64(count)
+}
+
+// state of the sun for sunrise/sunset times
+type polarState int
+
+const (
+	polarNone  polarState = iota // the sun rises and sets
+	polarDay                     // the sun doesn't set
+	polarNight                   // the sun doesn't rise
+)
+
+// sunTimes returns sunrise and sunset times of the day of given time at given location
+//
+// (computed offline with the sunrise equation; returned times are zero for polar day/night)
+func sunTimes(day time.Time, latitude, longitude float64) (sunrise, sunset time.Time, polar polarState) {
+	rad := math.Pi / 180
+
+	// days since J2000.0 (of the local date)
+	year, month, date := day.Date()
+	midnight := time.Date(year, month, date, 0, 0, 0, 0, time.UTC)
+	n := math.Ceil(float64(midnight.Unix())/86400 + julianDayUnixEpoch - julianDayJ2000 + 0.0008)
+
+	// mean solar time, solar mean anomaly, and equation of the center
+	meanSolarTime := n - longitude/360
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.0200*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+
+	// ecliptic longitude, solar transit, and declination of the sun
+	eclipticLongitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := julianDayJ2000 + meanSolarTime + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*eclipticLongitude*rad)
+	sinDeclination := math.Sin(eclipticLongitude*rad) * math.Sin(earthAxialTilt*rad)
+	cosDeclination := math.Cos(math.Asin(sinDeclination))
+
+	// hour angle
+	cosHourAngle := (math.Sin(sunriseAltitude*rad) - math.Sin(latitude*rad)*sinDeclination) / (math.Cos(latitude*rad) * cosDeclination)
+	if cosHourAngle < -1 {
+		return time.Time{}, time.Time{}, polarDay
+	} else if cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, polarNight
+	}
+	hourAngle := math.Acos(cosHourAngle) / rad
+
+	toTime := func(julianDay float64) time.Time {
+		return time.Unix(0, int64((julianDay-julianDayUnixEpoch)*86400*float64(time.Second))).In(day.Location())
+	}
+
+	return toTime(transit - hourAngle/360), toTime(transit + hourAngle/360), polarNone
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"image/color"
+	"testing"
+	"time"
+)
+
+var (
+	// locations for testing sunrise/sunset times
+	seoulLatitude, seoulLongitude   = 37.5665, 126.978
+	londonLatitude, londonLongitude = 51.5074, -0.1278
+	tromsoLatitude, tromsoLongitude = 69.6492, 18.9553
+
+	kst = time.FixedZone("KST", 9*60*60)
+)
+
+// isAround returns if given time is within a few minutes of the expected one (hour and minute of the same day)
+func isAround(t time.Time, hour, minute int) bool {
+	expected := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, t.Location())
+	return t.Sub(expected).Abs() <= 3*time.Minute
+}
+
+func TestSunTimes(t *testing.T) {
+	// (published times of sunrise and sunset)
+	for _, test := range []struct {
+		day                 time.Time
+		latitude, longitude float64
+		sunriseH, sunriseM  int
+		sunsetH, sunsetM    int
+	}{
+		{time.Date(2026, 6, 21, 12, 0, 0, 0, kst), seoulLatitude, seoulLongitude, 5, 11, 19, 57},
+		{time.Date(2026, 12, 21, 12, 0, 0, 0, kst), seoulLatitude, seoulLongitude, 7, 43, 17, 17},
+		{time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC), londonLatitude, londonLongitude, 6, 3, 18, 13},
+	} {
+		sunrise, sunset, polar := sunTimes(test.day, test.latitude, test.longitude)
+		if polar != polarNone {
+			t.Errorf("unexpected polar state on %s: %d", test.day, polar)
+		}
+		if !isAround(sunrise, test.sunriseH, test.sunriseM) || !isAround(sunset, test.sunsetH, test.sunsetM) {
+			t.Errorf("unexpected sunrise/sunset on %s at (%g, %g): %s, %s", test.day, test.latitude, test.longitude, sunrise, sunset)
+		}
+		if sunrise.Location() != test.day.Location() {
+			t.Errorf("times should be in the location of the given day: %s", sunrise.Location())
+		}
+	}
+
+	// polar day and night
+	if _, _, polar := sunTimes(time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC), tromsoLatitude, tromsoLongitude); polar != polarDay {
+		t.Errorf("expected polar day, got %d", polar)
+	}
+	if _, _, polar := sunTimes(time.Date(2026, 12, 21, 12, 0, 0, 0, time.UTC), tromsoLatitude, tromsoLongitude); polar != polarNight {
+		t.Errorf("expected polar night, got %d", polar)
+	}
+}
+
+func TestIsNightTime(t *testing.T) {
+	seoul := nightModeConfig{Latitude: &seoulLatitude, Longitude: &seoulLongitude}
+	for hour, expected := range map[int]bool{3: true, 6: false, 12: false, 19: false, 21: true} {
+		if night := seoul.isNightTime(time.Date(2026, 6, 21, hour, 0, 0, 0, kst)); night != expected {
+			t.Errorf("expected night time to be %t at %02d:00 in Seoul", expected, hour)
+		}
+	}
+
+	tromso := nightModeConfig{Latitude: &tromsoLatitude, Longitude: &tromsoLongitude}
+	if tromso.isNightTime(time.Date(2026, 6, 21, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("should not be night time in polar day")
+	}
+	if !tromso.isNightTime(time.Date(2026, 12, 21, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("should be night time in polar night")
+	}
+
+	// never without a location
+	if (nightModeConfig{}).isNightTime(time.Date(2026, 6, 21, 3, 0, 0, 0, kst)) {
+		t.Errorf("should not be night time without a location")
+	}
+}
+
+func TestCaptureNightImage(t *testing.T) {
+	dark := testJPEG(t, 32, 24, func(x, y int) color.RGBA { return gray(10) })
+	bright := testJPEG(t, 32, 24, func(x, y int) color.RGBA { return gray(200) })
+	params := map[string]any{cameraParamEV: 1}
+	noon, midnight := time.Date(2026, 6, 21, 12, 0, 0, 0, kst), time.Date(2026, 6, 21, 0, 0, 0, 0, kst)
+
+	// fake capture which returns the dark image without night params (or `captured` if given)
+	var calls []map[string]any
+	fakeCapture := func(captured []byte, err error) func(map[string]any) ([]byte, error) {
+		calls = nil
+		return func(cameraParams map[string]any) ([]byte, error) {
+			calls = append(calls, cameraParams)
+			if _, night := cameraParams[cameraParamShutter]; night {
+				return bright, err
+			}
+			if captured != nil {
+				return captured, nil
+			}
+			return dark, nil
+		}
+	}
+
+	conf := nightModeConfig{}
+
+	// retaken in night mode when too dark
+	captured, used, nightMode, err := captureNightImage(fakeCapture(nil, nil), params, conf, noon)
+	if err != nil || !nightMode || len(calls) != 2 || string(captured) != string(bright) {
+		t.Errorf("expected a retake in night mode: %t, %d calls (%v)", nightMode, len(calls), err)
+	}
+	if used[cameraParamShutter] != defaultNightShutterMicros || used[cameraParamGain] != defaultNightGain || used[cameraParamEV] != 1 {
+		t.Errorf("unexpected params of night mode: %v", used)
+	}
+	if _, changed := params[cameraParamShutter]; changed {
+		t.Errorf("given params should not be changed: %v", params)
+	}
+
+	// not retaken when bright enough (with a lower threshold)
+	captured, used, nightMode, err = captureNightImage(fakeCapture(nil, nil), params, nightModeConfig{LuminanceThreshold: 0.01}, noon)
+	if err != nil || nightMode || len(calls) != 1 || string(captured) != string(dark) || used[cameraParamShutter] != nil {
+		t.Errorf("expected no retake: %t, %d calls (%v)", nightMode, len(calls), err)
+	}
+	if _, _, nightMode, _ = captureNightImage(fakeCapture(bright, nil), params, conf, noon); nightMode || len(calls) != 1 {
+		t.Errorf("expected no retake of a bright image: %t, %d calls", nightMode, len(calls))
+	}
+
+	// the first image is kept when the retake fails
+	captured, used, nightMode, err = captureNightImage(fakeCapture(nil, errors.New("retake failed")), params, conf, noon)
+	if err != nil || nightMode || len(calls) != 2 || string(captured) != string(dark) || used[cameraParamShutter] != nil {
+		t.Errorf("expected the first image: %t, %d calls (%v)", nightMode, len(calls), err)
+	}
+
+	// night mode is used directly between sunset and sunrise
+	seoul := nightModeConfig{Latitude: &seoulLatitude, Longitude: &seoulLongitude}
+	if _, used, nightMode, err = captureNightImage(fakeCapture(nil, nil), params, seoul, midnight); err != nil || !nightMode || len(calls) != 1 || used[cameraParamShutter] == nil {
+		t.Errorf("expected a capture in night mode: %t, %d calls (%v)", nightMode, len(calls), err)
+	}
+
+	// custom night params
+	custom := nightModeConfig{CameraParams: map[string]any{cameraParamShutter: 2000000}}
+	if _, used, _, _ = captureNightImage(fakeCapture(nil, nil), params, custom, noon); used[cameraParamShutter] != 2000000 || used[cameraParamGain] != nil {
+		t.Errorf("unexpected custom params of night mode: %v", used)
+	}
+
+	// errors of the first capture
+	if _, _, _, err = captureNightImage(func(map[string]any) ([]byte, error) { return nil, errors.New("failed") }, params, conf, noon); err == nil {
+		t.Errorf("expected an error")
+	}
+}
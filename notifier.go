@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// topics of notifications
+	topicMotion    = "motion"    // gpio triggers fired
+	topicTimelapse = "timelapse" // timelapses (burst captures) finished
+	topicHealth    = "health"    // health of the bot and its cameras
+
+	// notifications within this time are batched into a digest (when not configured)
+	defaultDigestWindowSeconds = 60
+
+	// format of quiet hours (eg. "22:00-07:00")
+	quietHoursTimeFormat = "15:04"
+)
+
+// topics which can be subscribed
+var notificationTopics = []string{topicMotion, topicTimelapse, topicHealth}
+
+// notificationsConfig is a configuration of notifications to subscribed chats
+type notificationsConfig struct {
+	// notifications within this time after the last one are batched into a digest (default: 60 seconds)
+	DigestWindowSeconds int `json:"digest_window_seconds,omitempty"`
+}
+
+// validate checks if the notifications config has valid values
+func (c notificationsConfig) validate() error {
+	if c.DigestWindowSeconds < 0 {
+		return fmt.Errorf("digest window of notifications should not be negative: %d", c.DigestWindowSeconds)
+	}
+
+	return nil
+}
+
+// digestWindow returns the time for batching notifications into a digest
+func (c notificationsConfig) digestWindow() time.Duration {
+	if c.DigestWindowSeconds <= 0 {
+		return defaultDigestWindowSeconds * time.Second
+	}
+	return time.Duration(c.DigestWindowSeconds) * time.Second
+}
+
+// Subscription is a topic of notifications subscribed by a chat
+type Subscription struct {
+	ChatID   int64     `json:"chat_id"`
+	Topic    string    `json:"topic"`
+	UserName string    `json:"user_name"` // who subscribed
+	Time     time.Time `json:"time"`
+}
+
+// quietHours is a daily time range in which notifications to a chat are held back
+type quietHours struct {
+	Start int // in minutes from midnight
+	End   int // in minutes from midnight (earlier than `Start` for ranges over midnight)
+}
+
+// parseQuietHours parses quiet hours from given text (eg. "22:00-07:00")
+func parseQuietHours(str string) (hours quietHours, err error) {
+	start, end, ok := strings.Cut(strings.TrimSpace(str), "-")
+	if !ok {
+		return quietHours{}, fmt.Errorf("malformed quiet hours: %s", str)
+	}
+
+	var from, to time.Time
+	if from, err = time.Parse(quietHoursTimeFormat, strings.TrimSpace(start)); err != nil {
+		return quietHours{}, fmt.Errorf("malformed start of quiet hours: %s", start)
+	}
+	if to, err = time.Parse(quietHoursTimeFormat, strings.TrimSpace(end)); err != nil {
+		return quietHours{}, fmt.Errorf("malformed end of quiet hours: %s", end)
+	}
+
+	hours = quietHours{
+		Start: from.Hour()*60 + from.Minute(),
+		End:   to.Hour()*60 + to.Minute(),
+	}
+	if hours.Start == hours.End {
+		return quietHours{}, fmt.Errorf("start and end of quiet hours should differ: %s", str)
+	}
+
+	return hours, nil
+}
+
+// String returns the quiet hours in "15:04-15:04" format
+func (h quietHours) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", h.Start/60, h.Start%60, h.End/60, h.End%60)
+}
+
+// contains returns if given time is in the quiet hours
+func (h quietHours) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if h.Start < h.End {
+		return minute >= h.Start && minute < h.End
+	}
+	return minute >= h.Start || minute < h.End
+}
+
+// endAfter returns the end of the quiet hours which contain given time
+func (h quietHours) endAfter(t time.Time) time.Time {
+	end := time.Date(t.Year(), t.Month(), t.Day(), h.End/60, h.End%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+// notification is an event sent to chats which subscribed its topic
+type notification struct {
+	Topic string
+	Text  string
+	Time  time.Time
+}
+
+// notifier fans out notifications to subscribed chats
+//
+// the first notification to a chat is sent immediately, and following ones within the digest window
+// (or in the quiet hours of the chat) are batched into a digest which is sent later
+type notifier struct {
+	sync.Mutex
+
+	store  Store
+	window time.Duration
+	send   func(chatID int64, text string) error
+
+	pending  map[int64][]notification // held back for digests
+	timers   map[int64]*time.Timer    // scheduled digests
+	lastSent map[int64]time.Time
+}
+
+// newNotifier returns a new notifier which sends texts with `send` to chats subscribed in `store`
+func newNotifier(store Store, window time.Duration, send func(chatID int64, text string) error) *notifier {
+	return &notifier{
+		store:    store,
+		window:   window,
+		send:     send,
+		pending:  map[int64][]notification{},
+		timers:   map[int64]*time.Timer{},
+		lastSent: map[int64]time.Time{},
+	}
+}
+
+// publish sends a notification to all chats which subscribed its topic, and given chats
+func (n *notifier) publish(event notification, chatIDs ...int64) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	if subscribers, err := n.store.getSubscribers(event.Topic); err == nil {
+		chatIDs = append(slices.Clone(chatIDs), subscribers...)
+	} else {
+		logError("failed to get subscribers of '%s': %s", event.Topic, err)
+	}
+	slices.Sort(chatIDs)
+
+	for _, chatID := range slices.Compact(chatIDs) {
+		n.Lock()
+		n.pending[chatID] = append(n.pending[chatID], event)
+		_, scheduled := n.timers[chatID]
+		n.Unlock()
+
+		if !scheduled {
+			n.flush(chatID)
+		}
+	}
+}
+
+// flush sends pending notifications of a chat, or schedules them for later
+// (when in the digest window, or in the quiet hours of the chat)
+func (n *notifier) flush(chatID int64) {
+	now := time.Now()
+
+	var sendAt time.Time
+	if hours, err := n.store.getQuietHours(chatID); err != nil {
+		logError("failed to get quiet hours of chat %d: %s", chatID, err)
+	} else if hours != nil && hours.contains(now) {
+		sendAt = hours.endAfter(now)
+	}
+
+	n.Lock()
+	if sendAt.IsZero() {
+		if last, exists := n.lastSent[chatID]; exists && now.Sub(last) < n.window {
+			sendAt = last.Add(n.window)
+		}
+	}
+	if !sendAt.IsZero() {
+		if _, scheduled := n.timers[chatID]; !scheduled {
+			n.timers[chatID] = time.AfterFunc(sendAt.Sub(now), func() {
+				n.Lock()
+				delete(n.timers, chatID)
+				delete(n.lastSent, chatID) // (for sending the digest right away)
+				n.Unlock()
+
+				n.flush(chatID)
+			})
+		}
+		n.Unlock()
+		return
+	}
+	events := n.pending[chatID]
+	delete(n.pending, chatID)
+	n.lastSent[chatID] = now
+	n.Unlock()
+
+	if len(events) <= 0 {
+		return
+	}
+	if err := n.send(chatID, digest(events)); err != nil {
+		logError("failed to send notification to chat %d: %s", chatID, err)
+	}
+}
+
+// stop cancels scheduled digests, and sends pending notifications right away
+// (except for chats in their quiet hours, whose pending notifications are discarded)
+func (n *notifier) stop() {
+	n.Lock()
+	for chatID, timer := range n.timers {
+		timer.Stop()
+		delete(n.timers, chatID)
+	}
+	pending := n.pending
+	n.pending = map[int64][]notification{}
+	n.Unlock()
+
+	now := time.Now()
+	for chatID, events := range pending {
+		if len(events) <= 0 {
+			continue
+		}
+		if hours, err := n.store.getQuietHours(chatID); err == nil && hours != nil && hours.contains(now) {
+			logMessage("discarding %d pending notification(s) to chat %d in its quiet hours", len(events), chatID)
+			continue
+		}
+		if err := n.send(chatID, digest(events)); err != nil {
+			logError("failed to send pending notifications to chat %d: %s", chatID, err)
+		}
+	}
+}
+
+// digest returns a text of given notifications (as-is for a single one)
+func digest(events []notification) string {
+	if len(events) == 1 {
+		return events[0].Text
+	}
+
+	lines := []string{fmt.Sprintf("%d notifications:", len(events))}
+	for _, event := range events {
+		lines = append(lines, fmt.Sprintf("• [%s] %s %s", event.Topic, event.Time.Format(captionTimeFormat), event.Text))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// isNotificationTopic returns if given topic can be subscribed
+func isNotificationTopic(topic string) bool {
+	return slices.Contains(notificationTopics, topic)
+}
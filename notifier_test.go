@@ -0,0 +1,95 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sentNotifications records texts sent by a notifier
+type sentNotifications struct {
+	sync.Mutex
+	texts map[int64][]string
+}
+
+func (s *sentNotifications) send(chatID int64, text string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.texts[chatID] = append(s.texts[chatID], text)
+	return nil
+}
+
+func (s *sentNotifications) of(chatID int64) []string {
+	s.Lock()
+	defer s.Unlock()
+
+	return slices.Clone(s.texts[chatID])
+}
+
+func TestNotifierStopFlushesDigests(t *testing.T) {
+	store := newMemoryStore()
+	sent := &sentNotifications{texts: map[int64][]string{}}
+	n := newNotifier(store, time.Hour, sent.send)
+
+	// chat 2 is in its quiet hours (for two hours from now)
+	now := time.Now()
+	if err := store.setQuietHours(2, &quietHours{Start: now.Hour()*60 + now.Minute(), End: (now.Hour()*60 + now.Minute() + 120) % (24 * 60)}); err != nil {
+		t.Fatalf("failed to set quiet hours: %s", err)
+	}
+
+	n.publish(notification{Topic: topicMotion, Text: "first"}, 1, 2)
+	n.publish(notification{Topic: topicMotion, Text: "second"}, 1, 2)
+	n.publish(notification{Topic: topicMotion, Text: "third"}, 1, 2)
+	if texts := sent.of(1); !slices.Equal(texts, []string{"first"}) {
+		t.Errorf("expected only the first one before the digest window ends, got %v", texts)
+	}
+
+	n.stop()
+
+	if texts := sent.of(1); len(texts) != 2 || !strings.HasPrefix(texts[1], "2 notifications:") {
+		t.Errorf("expected pending ones as a digest, got %v", texts)
+	}
+	if texts := sent.of(2); len(texts) != 0 {
+		t.Errorf("expected nothing sent in quiet hours, got %v", texts)
+	}
+}
+
+func TestNotificationTopics(t *testing.T) {
+	for _, topic := range []string{"motion", "timelapse", "health"} {
+		if !isNotificationTopic(topic) {
+			t.Errorf("expected a notification topic: %s", topic)
+		}
+	}
+	if isNotificationTopic("unknown") {
+		t.Errorf("unknown should not be a notification topic")
+	}
+}
+
+func TestNotifyTimelapse(t *testing.T) {
+	store := newMemoryStore()
+	sent := &sentNotifications{texts: map[int64][]string{}}
+	notifications = newNotifier(store, time.Hour, sent.send)
+	defer func() {
+		notifications.stop()
+		notifications = nil
+	}()
+
+	if err := store.subscribe(Subscription{ChatID: 1, Topic: topicTimelapse}); err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+	if err := store.subscribe(Subscription{ChatID: 2, Topic: topicMotion}); err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+
+	notifyTimelapse("front", "alice", 5, time.Now())
+
+	if texts := sent.of(1); !slices.Equal(texts, []string{"Timelapse of 5 images captured by alice (camera: front)"}) {
+		t.Errorf("unexpected notifications: %v", texts)
+	}
+	if texts := sent.of(2); len(texts) != 0 {
+		t.Errorf("expected nothing sent to chats which did not subscribe timelapse, got %v", texts)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// overlay positions
+	overlayTopLeft     = "top-left"
+	overlayTopRight    = "top-right"
+	overlayBottomLeft  = "bottom-left"
+	overlayBottomRight = "bottom-right"
+
+	// default values for overlay
+	defaultOverlayTimestampFormat    = "2006-01-02 15:04:05"
+	defaultOverlayTemperatureDivisor = 1000 // eg. `/sys/class/thermal/thermal_zone0/temp` is in millidegrees
+	defaultOverlayBackgroundOpacity  = 0.5
+	overlayFontSizeRatio             = 40 // font size = image height / ratio (when not configured)
+	minOverlayFontSize               = 12
+)
+
+// overlayConfig is a configuration for text overlay on captured images
+type overlayConfig struct {
+	// contents
+	Timestamp          bool    `json:"timestamp"`
+	TimestampFormat    string  `json:"timestamp_format,omitempty"`
+	Hostname           bool    `json:"hostname"`
+	Label              string  `json:"label,omitempty"`
+	TemperatureFile    string  `json:"temperature_file,omitempty"`
+	TemperatureDivisor float64 `json:"temperature_divisor,omitempty"`
+
+	// appearance
+	Position          string   `json:"position,omitempty"`  // "top-left", "top-right", "bottom-left" (default), or "bottom-right"
+	FontSize          float64  `json:"font_size,omitempty"` // in pixels (0 for auto)
+	Background        bool     `json:"background"`
+	BackgroundOpacity *float64 `json:"background_opacity,omitempty"` // 0.0 ~ 1.0 (default: 0.5)
+}
+
+// validate checks if the overlay config has valid values
+func (c overlayConfig) validate() error {
+	switch c.Position {
+	case "", overlayTopLeft, overlayTopRight, overlayBottomLeft, overlayBottomRight:
+	default:
+		return fmt.Errorf("unknown overlay position: %s", c.Position)
+	}
+	if c.FontSize < 0 {
+		return fmt.Errorf("overlay font size should not be negative: %g", c.FontSize)
+	}
+	if c.BackgroundOpacity != nil && (*c.BackgroundOpacity < 0 || *c.BackgroundOpacity > 1) {
+		return fmt.Errorf("overlay background opacity should be within 0.0 ~ 1.0: %g", *c.BackgroundOpacity)
+	}
+
+	return nil
+}
+
+// backgroundOpacity returns the opacity of the background box (default one only if not set)
+func (c overlayConfig) backgroundOpacity() float64 {
+	if c.BackgroundOpacity == nil {
+		return defaultOverlayBackgroundOpacity
+	}
+	return *c.BackgroundOpacity
+}
+
+// lines returns text lines of the overlay for an image captured at given time
+func (c overlayConfig) lines(capturedAt time.Time) (lines []string) {
+	if c.Timestamp {
+		format := c.TimestampFormat
+		if format == "" {
+			format = defaultOverlayTimestampFormat
+		}
+		lines = append(lines, capturedAt.Format(format))
+	}
+
+	labels := []string{}
+	if c.Hostname {
+		if hostname, err := os.Hostname(); err == nil {
+			labels = append(labels, hostname)
+		} else {
+			logError("failed to get hostname for overlay: %s", err)
+		}
+	}
+	if c.Label != "" {
+		labels = append(labels, c.Label)
+	}
+	if len(labels) > 0 {
+		lines = append(lines, strings.Join(labels, " / "))
+	}
+
+	if c.TemperatureFile != "" {
+		if temperature, err := readTemperature(c.TemperatureFile, c.TemperatureDivisor); err == nil {
+			lines = append(lines, fmt.Sprintf("%.1f°C", temperature))
+		} else {
+			logError("failed to read temperature for overlay: %s", err)
+		}
+	}
+
+	return lines
+}
+
+// readTemperature reads a temperature value from a sensor file (eg. sysfs)
+func readTemperature(path string, divisor float64) (float64, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(bytes)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed temperature value in %s: %s", path, err)
+	}
+
+	if divisor == 0 {
+		divisor = defaultOverlayTemperatureDivisor
+	}
+
+	return value / divisor, nil
+}
+
+// parsed font for overlay
+var (
+	overlayFont     *opentype.Font
+	overlayFontErr  error
+	overlayFontOnce sync.Once
+)
+
+// overlayFace returns a font face of given size for overlay
+func overlayFace(size float64) (font.Face, error) {
+	overlayFontOnce.Do(func() {
+		overlayFont, overlayFontErr = opentype.Parse(gomono.TTF)
+	})
+	if overlayFontErr != nil {
+		return nil, overlayFontErr
+	}
+
+	return opentype.NewFace(overlayFont, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+// drawOverlay draws given text lines on the image, in place
+func drawOverlay(img *image.RGBA, lines []string, conf overlayConfig) error {
+	if len(lines) <= 0 {
+		return nil
+	}
+
+	size := conf.FontSize
+	if size <= 0 {
+		size = max(float64(img.Rect.Dy())/overlayFontSizeRatio, minOverlayFontSize)
+	}
+	face, err := overlayFace(size)
+	if err != nil {
+		return fmt.Errorf("failed to load overlay font: %s", err)
+	}
+	defer func() { _ = face.Close() }()
+
+	drawer := &font.Drawer{
+		Dst:  img,
+		Face: face,
+	}
+
+	// measure the text box
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	padding := lineHeight / 4
+	textWidth := 0
+	for _, line := range lines {
+		textWidth = max(textWidth, drawer.MeasureString(line).Ceil())
+	}
+	boxWidth, boxHeight := textWidth+padding*2, lineHeight*len(lines)+padding*2
+
+	// place the text box
+	var origin image.Point
+	switch conf.Position {
+	case overlayTopLeft:
+		origin = image.Pt(padding, padding)
+	case overlayTopRight:
+		origin = image.Pt(img.Rect.Dx()-boxWidth-padding, padding)
+	case overlayBottomRight:
+		origin = image.Pt(img.Rect.Dx()-boxWidth-padding, img.Rect.Dy()-boxHeight-padding)
+	default: // bottom-left
+		origin = image.Pt(padding, img.Rect.Dy()-boxHeight-padding)
+	}
+	box := image.Rect(origin.X, origin.Y, origin.X+boxWidth, origin.Y+boxHeight).Intersect(img.Rect)
+
+	// draw background box
+	if conf.Background {
+		draw.DrawMask(
+			img, box,
+			image.Black, image.Point{},
+			image.NewUniform(color.Alpha{A: uint8(conf.backgroundOpacity() * 255)}), image.Point{},
+			draw.Over,
+		)
+	}
+
+	// draw text lines (with shadows for readability, when there is no background box)
+	shadow := max(int(size)/16, 1)
+	for i, line := range lines {
+		x, y := box.Min.X+padding, box.Min.Y+padding+lineHeight*i+metrics.Ascent.Ceil()
+
+		if !conf.Background {
+			drawer.Src = image.Black
+			drawer.Dot = fixed.P(x+shadow, y+shadow)
+			drawer.DrawString(line)
+		}
+
+		drawer.Src = image.White
+		drawer.Dot = fixed.P(x, y)
+		drawer.DrawString(line)
+	}
+
+	return nil
+}
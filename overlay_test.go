@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// grayImage returns an image filled with given gray value
+func grayImage(width, height int, v uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetRGBA(x, y, gray(v))
+		}
+	}
+	return img
+}
+
+// changedBounds returns the bounds of pixels which are not of given gray value
+func changedBounds(img *image.RGBA, v uint8) (bounds image.Rectangle) {
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			if img.RGBAAt(x, y) != gray(v) {
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return bounds
+}
+
+// countPixels returns the number of pixels of given color in the bounds
+func countPixels(img *image.RGBA, bounds image.Rectangle, c color.RGBA) (count int) {
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if img.RGBAAt(x, y) == c {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func TestOverlayBackgroundOpacity(t *testing.T) {
+	for src, expected := range map[string]float64{
+		`{"background": true}`:                            defaultOverlayBackgroundOpacity,
+		`{"background": true, "background_opacity": 0}`:   0,
+		`{"background": true, "background_opacity": 0.8}`: 0.8,
+	} {
+		var conf overlayConfig
+		if err := json.Unmarshal([]byte(src), &conf); err != nil {
+			t.Fatalf("failed to parse overlay config: %s", err)
+		}
+		if opacity := conf.backgroundOpacity(); opacity != expected {
+			t.Errorf("expected opacity %g from %s, got %g", expected, src, opacity)
+		}
+	}
+}
+
+func TestOverlayConfigValidation(t *testing.T) {
+	opacity := 1.5
+	for name, conf := range map[string]overlayConfig{
+		"unknown position":   {Position: "center"},
+		"negative font size": {FontSize: -1},
+		"opacity over 1":     {BackgroundOpacity: &opacity},
+	} {
+		if err := conf.validate(); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+
+	zero := 0.0
+	if err := (overlayConfig{Position: overlayTopRight, BackgroundOpacity: &zero}).validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestOverlayLines(t *testing.T) {
+	temperatureFile := filepath.Join(t.TempDir(), "temp")
+	if err := os.WriteFile(temperatureFile, []byte("48312\n"), 0o644); err != nil {
+		t.Fatalf("failed to write temperature file: %s", err)
+	}
+
+	conf := overlayConfig{
+		Timestamp:       true,
+		TimestampFormat: "2006/01/02 15:04",
+		Label:           "front yard",
+		TemperatureFile: temperatureFile,
+	}
+	lines := conf.lines(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if !slices.Equal(lines, []string{"2026/01/02 03:04", "front yard", "48.3°C"}) {
+		t.Errorf("unexpected lines: %v", lines)
+	}
+
+	// unreadable temperature is skipped
+	conf.TemperatureFile = filepath.Join(t.TempDir(), "none")
+	if lines := conf.lines(time.Now()); len(lines) != 2 {
+		t.Errorf("unexpected lines: %v", lines)
+	}
+}
+
+func TestDrawOverlayPlacement(t *testing.T) {
+	width, height := 400, 300
+	opaque := 1.0
+
+	for position, inCorner := range map[string]func(image.Rectangle) bool{
+		overlayTopLeft:     func(r image.Rectangle) bool { return r.Max.X < width/2 && r.Max.Y < height/2 },
+		overlayTopRight:    func(r image.Rectangle) bool { return r.Min.X > width/2 && r.Max.Y < height/2 },
+		overlayBottomLeft:  func(r image.Rectangle) bool { return r.Max.X < width/2 && r.Min.Y > height/2 },
+		overlayBottomRight: func(r image.Rectangle) bool { return r.Min.X > width/2 && r.Min.Y > height/2 },
+		"":                 func(r image.Rectangle) bool { return r.Max.X < width/2 && r.Min.Y > height/2 }, // (bottom-left)
+	} {
+		img := grayImage(width, height, 128)
+		if err := drawOverlay(img, []string{"2026-01-02 03:04:05", "front yard"}, overlayConfig{Position: position, Background: true, BackgroundOpacity: &opaque}); err != nil {
+			t.Fatalf("failed to draw overlay: %s", err)
+		}
+
+		bounds := changedBounds(img, 128)
+		if bounds.Empty() || !inCorner(bounds) {
+			t.Errorf("overlay of position '%s' is not in its corner: %v", position, bounds)
+		}
+		if c := img.RGBAAt(bounds.Min.X, bounds.Min.Y); c != gray(0) {
+			t.Errorf("background box of position '%s' should be opaque black: %v", position, c)
+		}
+	}
+}
+
+func TestDrawOverlayBackground(t *testing.T) {
+	lines := []string{"front yard"}
+	transparent := 0.0
+
+	// translucent background box by default
+	img := grayImage(400, 300, 128)
+	if err := drawOverlay(img, lines, overlayConfig{Background: true}); err != nil {
+		t.Fatalf("failed to draw overlay: %s", err)
+	}
+	bounds := changedBounds(img, 128)
+	if c := img.RGBAAt(bounds.Min.X, bounds.Min.Y); c.R < 48 || c.R > 80 {
+		t.Errorf("background box should be half transparent: %v", c)
+	}
+
+	// transparent background box (only the text is drawn, without shadows)
+	img = grayImage(400, 300, 128)
+	if err := drawOverlay(img, lines, overlayConfig{Background: true, BackgroundOpacity: &transparent}); err != nil {
+		t.Fatalf("failed to draw overlay: %s", err)
+	}
+	bounds = changedBounds(img, 128)
+	if bounds.Empty() || countPixels(img, bounds, gray(0)) != 0 {
+		t.Errorf("nothing but the text should be drawn with a transparent background box")
+	}
+
+	// shadows without background box
+	img = grayImage(400, 300, 128)
+	if err := drawOverlay(img, lines, overlayConfig{}); err != nil {
+		t.Fatalf("failed to draw overlay: %s", err)
+	}
+	bounds = changedBounds(img, 128)
+	if countPixels(img, bounds, gray(255)) == 0 || countPixels(img, bounds, gray(0)) == 0 {
+		t.Errorf("text should be drawn in white with black shadows")
+	}
+
+	// nothing without lines
+	img = grayImage(400, 300, 128)
+	if err := drawOverlay(img, nil, overlayConfig{Background: true}); err != nil || !changedBounds(img, 128).Empty() {
+		t.Errorf("nothing should be drawn without lines (%v)", err)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+const (
+	// interval of checking changes of the config file (with `watch_config`)
+	configWatchInterval = 5 * time.Second
+)
+
+var (
+	// guards values of config which are reloaded while running
+	// (users, image size and camera params of cameras, and maintenance mode)
+	configLock sync.RWMutex
+
+	// for reloading config one at a time
+	reloadLock sync.Mutex
+
+	// config which is running (for detecting changes which need a restart)
+	runningConfig config
+)
+
+// keys of config which can be reloaded without a restart
+// (`cameras` are checked separately, as only their image size and camera params can be reloaded)
+var reloadableConfigKeys = []string{
+	"available_ids",
+	"image_width", "image_height", "camera_params", "cameras",
+	"is_in_maintenance", "maintenance_message",
+}
+
+// reloadConfig reloads users, image size, camera params, and maintenance mode from the config file
+//
+// nothing is changed if the new config is invalid, or has changes which need a restart (eg. added cameras)
+func reloadConfig() error {
+	return reloadConfigWith(loadConfig)
+}
+
+// reloadConfigWith reloads config which is loaded with `load`
+func reloadConfigWith(load func() (config, error)) error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	config, err := load()
+	if err != nil {
+		return err
+	}
+
+	// changes which need a restart
+	if keys := changedConfigKeys(runningConfig, config); len(keys) > 0 {
+		return fmt.Errorf("changes of %s need a restart", strings.Join(keys, ", "))
+	}
+
+	// cameras with new image size and camera params
+	imageWidth := max(config.ImageWidth, minImageWidth)
+	imageHeight := max(config.ImageHeight, minImageHeight)
+	reloaded, names, err := newCameras(config.Cameras, config.DefaultCamera, imageWidth, imageHeight, config.CameraParams)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(names, cameraNames) {
+		return fmt.Errorf("cameras were changed from %s to %s (needs a restart)", strings.Join(cameraNames, ", "), strings.Join(names, ", "))
+	}
+	configLock.RLock()
+	for _, name := range names {
+		current, conf := cameras[name].config, reloaded[name].config
+		current.ImageWidth, current.ImageHeight, current.CameraParams = conf.ImageWidth, conf.ImageHeight, conf.CameraParams
+		if !reflect.DeepEqual(current, conf) {
+			configLock.RUnlock()
+			return fmt.Errorf("camera '%s' was changed other than its image size or camera params (needs a restart)", name)
+		}
+	}
+	configLock.RUnlock()
+
+	message := config.MaintenanceMessage
+	if len(message) <= 0 {
+		message = defaultMaintenanceMessage
+	}
+
+	// swap all of them at once
+	// (in the same order of locks as processing updates: the pool first, then the config)
+	pool.Lock()
+	defer pool.Unlock()
+	configLock.Lock()
+	defer configLock.Unlock()
+
+	sessions := map[string]_session{}
+	for _, id := range config.AvailableIds {
+		if existing, exists := pool.Sessions[id]; exists {
+			sessions[id] = existing
+		} else {
+			sessions[id] = newSession(id)
+		}
+	}
+	pool.Sessions = sessions
+
+	availableIds = config.AvailableIds
+	for _, name := range names {
+		conf := reloaded[name].config
+		cameras[name].config.ImageWidth = conf.ImageWidth
+		cameras[name].config.ImageHeight = conf.ImageHeight
+		cameras[name].config.CameraParams = conf.CameraParams
+	}
+	isInMaintenance = config.IsInMaintenance
+	maintenanceMessage = message
+	runningConfig = config
+
+	return nil
+}
+
+// changedConfigKeys returns keys of top-level values which differ between given configs (except reloadable ones)
+func changedConfigKeys(current, next config) (keys []string) {
+	currentValue, nextValue := reflect.ValueOf(current), reflect.ValueOf(next)
+	typ := currentValue.Type()
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || slices.Contains(reloadableConfigKeys, name) {
+			continue
+		}
+
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			keys = append(keys, name)
+		}
+	}
+
+	return keys
+}
+
+// reloadConfigAndReport reloads config, and logs its result (failures are also sent to admin chats)
+func reloadConfigAndReport(client *bot.Bot, reason string) {
+	if err := reloadConfig(); err != nil {
+		logError("failed to reload config (%s): %s", reason, err)
+		notifyAdmins(client, fmt.Sprintf("%s: %s", messageReloadFailed, err))
+	} else {
+		logMessage("reloaded config (%s)", reason)
+	}
+}
+
+// watchConfig reloads config when the config file is modified (never returns)
+func watchConfig(client *bot.Bot) {
+	path, err := resolvePath(configFilename)
+	if err != nil {
+		logError("failed to watch config: %s", err)
+		return
+	}
+
+	var modified time.Time
+	if info, err := os.Stat(path); err == nil {
+		modified = info.ModTime()
+	}
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if info, err := os.Stat(path); err != nil {
+			logError("failed to check config file: %s", err)
+		} else if !info.ModTime().Equal(modified) {
+			modified = info.ModTime()
+			reloadConfigAndReport(client, "config file was modified")
+		}
+	}
+}
+
+// process `/reload` command: reload config (only in admin chats)
+func processReloadCommand(b *bot.Bot, message bot.Message) string {
+	if !isAdminChat(message.Chat.ID) {
+		return messageNotAdminChat
+	}
+
+	// (reloading touches the session pool, which is locked while processing updates)
+	go func(chatID int64) {
+		result := messageReloaded
+		if err := reloadConfig(); err != nil {
+			logError("failed to reload config (with %s): %s", commandReload, err)
+			result = fmt.Sprintf("%s: %s", messageReloadFailed, err)
+		} else {
+			logMessage("reloaded config (with %s)", commandReload)
+		}
+
+		sendMessageCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
+		defer cancel()
+		_, _ = b.SendMessage(sendMessageCtx, chatID, result, nil)
+	}(message.Chat.ID)
+
+	return messageReloading
+}
+
+// notifyAdmins sends given text to admin chats
+func notifyAdmins(client *bot.Bot, text string) {
+	for _, chatID := range adminChats {
+		sendMessageCtx, cancel := context.WithTimeout(context.Background(), sendMessageTimeout)
+		if sent, _ := client.SendMessage(sendMessageCtx, chatID, text, nil); !sent.OK {
+			logError("failed to send message to admin chat %d: %s", chatID, *sent.Description)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// config source for testing reloads
+const reloadTestConfig = `{
+	"api_token": "test-token",
+	"available_ids": ["alice", "bob"],
+	"image_width": 640,
+	"image_height": 480,
+	"cameras": {
+		"front": {"backend": "fake"},
+		"back": {"backend": "fake", "camera_params": {"--brightness": 0.1}}
+	},
+	"default_camera": "front",
+	"db_path": "/tmp/test.db"
+}`
+
+// setupReload sets up the running state with `reloadTestConfig`
+func setupReload(t *testing.T) {
+	t.Helper()
+
+	conf, err := parseConfig([]byte(reloadTestConfig))
+	if err != nil {
+		t.Fatalf("failed to parse config: %s", err)
+	}
+	loaded, names, err := newCameras(conf.Cameras, conf.DefaultCamera, conf.ImageWidth, conf.ImageHeight, conf.CameraParams)
+	if err != nil {
+		t.Fatalf("failed to create cameras: %s", err)
+	}
+
+	runningConfig = conf
+	cameras, cameraNames = loaded, names
+	availableIds = conf.AvailableIds
+	pool = _sessionPool{Sessions: map[string]_session{}}
+	for _, id := range conf.AvailableIds {
+		pool.Sessions[id] = newSession(id)
+	}
+	isInMaintenance, maintenanceMessage = false, ""
+	t.Cleanup(func() {
+		runningConfig = config{}
+		cameras, cameraNames, availableIds = nil, nil, nil
+		pool = _sessionPool{}
+		isInMaintenance, maintenanceMessage = false, ""
+	})
+}
+
+// reloadWith reloads config from given source
+func reloadWith(src string) error {
+	return reloadConfigWith(func() (config, error) {
+		return parseConfig([]byte(src))
+	})
+}
+
+// checkRunningState checks if the running state is the one of `reloadTestConfig`
+func checkRunningState(t *testing.T) {
+	t.Helper()
+
+	if !slices.Equal(availableIds, []string{"alice", "bob"}) || len(pool.Sessions) != 2 {
+		t.Errorf("users should not be changed: %v, %v", availableIds, pool.Sessions)
+	}
+	if width := cameras["front"].config.ImageWidth; width != 640 {
+		t.Errorf("image width should not be changed: %d", width)
+	}
+	if isInMaintenance {
+		t.Errorf("maintenance mode should not be changed")
+	}
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	setupReload(t)
+
+	src := strings.Replace(reloadTestConfig, `"image_width": 640`, `"image_width": "wide"`, 1)
+	src = strings.Replace(src, `"available_ids": ["alice", "bob"]`, `"available_ids": ["carol"]`, 1)
+	if err := reloadWith(src); err == nil || !strings.Contains(err.Error(), "invalid config.json") {
+		t.Errorf("expected an error of invalid config, got: %v", err)
+	}
+	checkRunningState(t)
+}
+
+func TestReloadNeedingRestart(t *testing.T) {
+	setupReload(t)
+
+	for name, replacements := range map[string][]string{
+		"added camera":    {`"back": {`, `"side": {"backend": "fake"}, "back": {`},
+		"changed camera":  {`"back": {"backend": "fake",`, `"back": {"backend": "fake", "index": 1,`},
+		"changed db path": {`/tmp/test.db`, `/tmp/other.db`},
+		"changed token":   {`test-token`, `other-token`},
+	} {
+		// (with reloadable changes which should not be applied either)
+		src := strings.NewReplacer(append(replacements,
+			`"available_ids": ["alice", "bob"]`, `"available_ids": ["carol"], "is_in_maintenance": true`,
+		)...).Replace(reloadTestConfig)
+
+		if err := reloadWith(src); err == nil || !strings.Contains(err.Error(), "restart") {
+			t.Errorf("expected an error of needing a restart for %s, got: %v", name, err)
+		}
+		checkRunningState(t)
+	}
+
+	if err := reloadWith(strings.Replace(reloadTestConfig, `/tmp/test.db`, `/tmp/other.db`, 1)); err == nil || err.Error() != "changes of db_path need a restart" {
+		t.Errorf("changed keys should be listed, got: %v", err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	setupReload(t)
+
+	bob := pool.Sessions["bob"]
+	bob.LastUpdateID = 42
+	pool.Sessions["bob"] = bob
+
+	src := strings.NewReplacer(
+		`"available_ids": ["alice", "bob"]`, `"available_ids": ["bob", "carol"], "is_in_maintenance": true, "maintenance_message": "fixing"`,
+		`"image_width": 640`, `"image_width": 1280`,
+		`"camera_params": {"--brightness": 0.1}`, `"camera_params": {"--brightness": 0.2}`,
+	).Replace(reloadTestConfig)
+	if err := reloadWith(src); err != nil {
+		t.Fatalf("failed to reload config: %s", err)
+	}
+
+	if !slices.Equal(availableIds, []string{"bob", "carol"}) {
+		t.Errorf("unexpected users: %v", availableIds)
+	}
+	if _, exists := pool.Sessions["alice"]; exists || len(pool.Sessions) != 2 {
+		t.Errorf("unexpected sessions: %v", pool.Sessions)
+	}
+	if pool.Sessions["bob"].LastUpdateID != 42 {
+		t.Errorf("existing session should be kept: %+v", pool.Sessions["bob"])
+	}
+	if width := cameras["front"].config.ImageWidth; width != 1280 {
+		t.Errorf("unexpected image width: %d", width)
+	}
+	if brightness := cameras["back"].config.CameraParams["--brightness"]; brightness != 0.2 {
+		t.Errorf("unexpected camera params: %v", cameras["back"].config.CameraParams)
+	}
+	if !isInMaintenance || maintenanceMessage != "fixing" {
+		t.Errorf("unexpected maintenance mode: %t, %s", isInMaintenance, maintenanceMessage)
+	}
+	if runningConfig.ImageWidth != 1280 {
+		t.Errorf("running config should be updated")
+	}
+}
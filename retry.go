@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// default values for capture retries
+	defaultRetryAttempts          = 3
+	defaultRetryBackoffMillis     = 1000
+	defaultRetryMaxBackoffMillis  = 10000
+	defaultRecoveryTimeoutSeconds = 30
+)
+
+// retryConfig is a configuration of retries of failed captures
+type retryConfig struct {
+	Attempts         int `json:"attempts,omitempty"`       // total attempts including the first one (default: 3)
+	BackoffMillis    int `json:"backoff_ms,omitempty"`     // wait before the first retry, doubled for each retry (default: 1000)
+	MaxBackoffMillis int `json:"max_backoff_ms,omitempty"` // (default: 10000)
+
+	// command which is run before giving up (eg. ["sudo", "systemctl", "restart", "camera-reset"]),
+	// followed by one more attempt
+	RecoveryCommand        []string `json:"recovery_command,omitempty"`
+	RecoveryTimeoutSeconds int      `json:"recovery_timeout_seconds,omitempty"` // (default: 30)
+}
+
+// validate checks if the retry config has valid values
+func (c retryConfig) validate() error {
+	if c.Attempts < 0 || c.BackoffMillis < 0 || c.MaxBackoffMillis < 0 || c.RecoveryTimeoutSeconds < 0 {
+		return fmt.Errorf("values of retry should not be negative")
+	}
+	if len(c.RecoveryCommand) > 0 && c.RecoveryCommand[0] == "" {
+		return fmt.Errorf("malformed recovery command: %v", c.RecoveryCommand)
+	}
+
+	return nil
+}
+
+// attempts returns the number of total attempts
+func (c retryConfig) attempts() int {
+	if c.Attempts <= 0 {
+		return defaultRetryAttempts
+	}
+	return c.Attempts
+}
+
+// backoff returns the wait before given retry (1 for the first retry)
+func (c retryConfig) backoff(retry int) time.Duration {
+	backoff, maxBackoff := defaultRetryBackoffMillis*time.Millisecond, defaultRetryMaxBackoffMillis*time.Millisecond
+	if c.BackoffMillis > 0 {
+		backoff = time.Duration(c.BackoffMillis) * time.Millisecond
+	}
+	if c.MaxBackoffMillis > 0 {
+		maxBackoff = time.Duration(c.MaxBackoffMillis) * time.Millisecond
+	}
+
+	for i := 1; i < retry && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, maxBackoff)
+}
+
+// recoveryTimeout returns the timeout of the recovery command
+func (c retryConfig) recoveryTimeout() time.Duration {
+	if c.RecoveryTimeoutSeconds <= 0 {
+		return defaultRecoveryTimeoutSeconds * time.Second
+	}
+	return time.Duration(c.RecoveryTimeoutSeconds) * time.Second
+}
+
+// retriableError is an error which tells if the failed capture may succeed when retried
+type retriableError interface {
+	error
+	retriable() bool
+}
+
+// isRetriableCaptureError returns if given error of a capture is worth retrying
+// (errors which do not tell it are not retried)
+func isRetriableCaptureError(err error) bool {
+	var retriableErr retriableError
+	return errors.As(err, &retriableErr) && retriableErr.retriable()
+}
+
+// captureWithRetries runs `capture`, and retries it with backoff when it fails with retriable errors
+// (before giving up, the recovery command is run and one more attempt is made)
+//
+// retries are not made if `conf` is nil
+func captureWithRetries[T any](ctx context.Context, conf *retryConfig, cameraName string, capture func() (T, error)) (result T, err error) {
+	if conf == nil {
+		return capture()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if result, err = capture(); err == nil || !isRetriableCaptureError(err) {
+			return result, err
+		}
+		if attempt >= conf.attempts() {
+			break
+		}
+
+		backoff := conf.backoff(attempt)
+		logError("capture with camera '%s' failed (attempt %d/%d), retrying in %s: %s", cameraName, attempt, conf.attempts(), backoff, err)
+		select {
+		case <-ctx.Done():
+			return result, fmt.Errorf("capture canceled: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+	}
+
+	if len(conf.RecoveryCommand) > 0 {
+		logError("capture with camera '%s' failed %d times, running recovery command: %s", cameraName, conf.attempts(), err)
+
+		if recoveryErr := runRecoveryCommand(ctx, conf.RecoveryCommand, conf.recoveryTimeout()); recoveryErr != nil {
+			logError("recovery command failed: %s", recoveryErr)
+			return result, err
+		}
+
+		return capture()
+	}
+
+	return result, err
+}
+
+// runRecoveryCommand runs the recovery command with given timeout
+func runRecoveryCommand(ctx context.Context, command []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(output.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeCapture returns a capture func which fails with given errors in order (then succeeds), and counts its calls
+func fakeCapture(errs ...error) (capture func() (string, error), calls *int) {
+	calls = new(int)
+	return func() (string, error) {
+		*calls++
+		if *calls <= len(errs) {
+			return "", errs[*calls-1]
+		}
+		return "captured", nil
+	}, calls
+}
+
+var (
+	errBusy    = &cameraError{Kind: cameraErrorBusy, Err: errors.New("busy")}
+	errInvalid = &cameraError{Kind: cameraErrorInvalidArgument, Err: errors.New("invalid")}
+)
+
+func TestRetryBackoff(t *testing.T) {
+	conf := retryConfig{BackoffMillis: 10, MaxBackoffMillis: 35}
+
+	var backoffs []time.Duration
+	for retry := 1; retry <= 5; retry++ {
+		backoffs = append(backoffs, conf.backoff(retry))
+	}
+	if !slices.Equal(backoffs, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 35 * time.Millisecond, 35 * time.Millisecond, 35 * time.Millisecond}) {
+		t.Errorf("unexpected backoffs: %v", backoffs)
+	}
+
+	// defaults
+	if backoff := (retryConfig{}).backoff(1); backoff != defaultRetryBackoffMillis*time.Millisecond {
+		t.Errorf("unexpected default backoff: %s", backoff)
+	}
+	if backoff := (retryConfig{}).backoff(100); backoff != defaultRetryMaxBackoffMillis*time.Millisecond {
+		t.Errorf("unexpected default max backoff: %s", backoff)
+	}
+}
+
+func TestCaptureWithRetries(t *testing.T) {
+	conf := &retryConfig{Attempts: 3, BackoffMillis: 1}
+
+	// succeeds after retries
+	capture, calls := fakeCapture(errBusy, errBusy)
+	if result, err := captureWithRetries(context.Background(), conf, "test", capture); err != nil || result != "captured" || *calls != 3 {
+		t.Errorf("unexpected result: %s, %v (%d calls)", result, err, *calls)
+	}
+
+	// gives up after all attempts
+	capture, calls = fakeCapture(errBusy, errBusy, errBusy, errBusy)
+	if _, err := captureWithRetries(context.Background(), conf, "test", capture); !errors.Is(err, errBusy) || *calls != 3 {
+		t.Errorf("unexpected result: %v (%d calls)", err, *calls)
+	}
+
+	// not retried on non-retriable errors
+	capture, calls = fakeCapture(errBusy, errInvalid)
+	if _, err := captureWithRetries(context.Background(), conf, "test", capture); !errors.Is(err, errInvalid) || *calls != 2 {
+		t.Errorf("unexpected result: %v (%d calls)", err, *calls)
+	}
+	capture, calls = fakeCapture(errors.New("not a camera error"))
+	if _, err := captureWithRetries(context.Background(), conf, "test", capture); err == nil || *calls != 1 {
+		t.Errorf("unexpected result: %v (%d calls)", err, *calls)
+	}
+
+	// not retried without config
+	capture, calls = fakeCapture(errBusy)
+	if _, err := captureWithRetries(context.Background(), nil, "test", capture); !errors.Is(err, errBusy) || *calls != 1 {
+		t.Errorf("unexpected result: %v (%d calls)", err, *calls)
+	}
+}
+
+func TestCaptureWithRetriesRecovery(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "recovered")
+
+	// one more attempt after the recovery command
+	conf := &retryConfig{Attempts: 2, BackoffMillis: 1, RecoveryCommand: []string{"touch", marker}}
+	capture, calls := fakeCapture(errBusy, errBusy)
+	if result, err := captureWithRetries(context.Background(), conf, "test", capture); err != nil || result != "captured" || *calls != 3 {
+		t.Errorf("unexpected result: %s, %v (%d calls)", result, err, *calls)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("recovery command was not run: %s", err)
+	}
+
+	// no more attempts when the recovery command fails
+	conf.RecoveryCommand = []string{"false"}
+	capture, calls = fakeCapture(errBusy, errBusy)
+	if _, err := captureWithRetries(context.Background(), conf, "test", capture); !errors.Is(err, errBusy) || *calls != 2 {
+		t.Errorf("unexpected result: %v (%d calls)", err, *calls)
+	}
+}
+
+func TestCaptureWithRetriesCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// canceled while waiting for a (long) backoff
+	conf := &retryConfig{Attempts: 3, BackoffMillis: int(time.Hour / time.Millisecond)}
+	calls := 0
+	capture := func() (string, error) {
+		calls++
+		cancel()
+		return "", errBusy
+	}
+
+	started := time.Now()
+	if _, err := captureWithRetries(ctx, conf, "test", capture); !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("unexpected result: %v (%d calls)", err, calls)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("should not wait for the backoff: %s", elapsed)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	bot "github.com/meinside/telegram-bot-go"
+)
+
+const (
+	// default values for shutting down
+	defaultShutdownTimeoutSeconds = 30
+
+	// interval of checking whether queued captures are done while shutting down
+	shutdownDrainInterval = 200 * time.Millisecond
+
+	// wait for the capture worker after canceling captures (killing camera processes)
+	captureWorkerStopTimeout = 10 * time.Second
+)
+
+// shutdownConfig is a configuration of shutting down the bot
+type shutdownConfig struct {
+	// wait for queued and in-flight captures before canceling them (default: 30)
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+
+	// send "going offline" to `admin_chats`
+	NotifyAdmins bool `json:"notify_admins,omitempty"`
+}
+
+// validate checks if the shutdown config has valid values
+func (c shutdownConfig) validate() error {
+	if c.TimeoutSeconds < 0 {
+		return fmt.Errorf("timeout of shutdown should not be negative: %d", c.TimeoutSeconds)
+	}
+
+	return nil
+}
+
+// timeout returns the time for draining captures
+func (c shutdownConfig) timeout() time.Duration {
+	if c.TimeoutSeconds <= 0 {
+		return defaultShutdownTimeoutSeconds * time.Second
+	}
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+// set when shutting down (new capture requests are dropped)
+var shuttingDown atomic.Bool
+
+// handleSignals reloads config on SIGHUP, and stops polling updates on SIGINT or SIGTERM
+// (returns after stopping; another SIGINT or SIGTERM kills the process right away)
+func handleSignals(client *bot.Bot) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			reloadConfigAndReport(client, sig.String())
+			continue
+		}
+
+		logMessage("received %s, shutting down...", sig)
+
+		signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+		shuttingDown.Store(true)
+		client.StopPollingUpdates()
+		return
+	}
+}
+
+// pendingCaptures returns the number of queued and in-flight capture requests
+func pendingCaptures() (count int) {
+	captureJobs.Lock()
+	defer captureJobs.Unlock()
+
+	for _, cancels := range captureJobs.Cancels {
+		count += len(cancels)
+	}
+
+	return count
+}
+
+// drainCaptures waits until queued and in-flight captures are done (or `timeout` passes),
+// then cancels the remaining ones and stops the capture worker
+func drainCaptures(timeout time.Duration, workerStopped <-chan struct{}) {
+	if count := pendingCaptures(); count > 0 {
+		logMessage("waiting for %d capture(s) to finish...", count)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for pendingCaptures() > 0 && time.Now().Before(deadline) {
+		time.Sleep(shutdownDrainInterval)
+	}
+	if count := pendingCaptures(); count > 0 {
+		logError("canceling %d capture(s) which did not finish in %s", count, timeout)
+	}
+
+	// (running camera processes are killed with their contexts)
+	stopCaptures()
+
+	select {
+	case <-workerStopped:
+	case <-time.After(captureWorkerStopTimeout):
+		logError("capture worker did not stop in %s", captureWorkerStopTimeout)
+	}
+}
+
+// notifyOffline sends a "going offline" message to admin chats
+func notifyOffline(client *bot.Bot) {
+	if shutdownConf.NotifyAdmins {
+		notifyAdmins(client, messageGoingOffline)
+	}
+}
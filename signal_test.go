@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setupDrain sets up cameras, the capture queue, and the context of captures for draining them
+func setupDrain(t *testing.T) {
+	t.Helper()
+
+	setupRetakeCameras(t)
+	health = newWatchdog(healthConfig{}, nil, func() int { return 0 })
+	ctx, stop := captureCtx, stopCaptures
+	captureCtx, stopCaptures = context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		stopCaptures()
+		captureCtx, stopCaptures = ctx, stop
+		health = nil
+		shuttingDown.Store(false)
+	})
+}
+
+// capturedResults records results of captures processed by a capture worker
+type capturedResults struct {
+	sync.Mutex
+	errs []error
+}
+
+// startCaptureWorker processes queued capture requests with camera 'front' until captures are stopped
+// (like `runCaptureWorker`, without sending the results), and returns a channel which is closed when it stops
+func startCaptureWorker(results *capturedResults) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		for {
+			select {
+			case <-captureCtx.Done():
+				return
+			case request := <-captureChannel:
+				_, err := cameras["front"].captureStill(request.Context, 64, 48, nil)
+				results.Lock()
+				results.errs = append(results.errs, err)
+				results.Unlock()
+				finishCapture(request)
+			}
+		}
+	}()
+
+	return stopped
+}
+
+func TestDrainCapturesWithinTimeout(t *testing.T) {
+	setupDrain(t)
+	useFakeLibcamera(t, `sleep 0.1; printf captured`)
+
+	results := &capturedResults{}
+	stopped := startCaptureWorker(results)
+	for range 3 {
+		enqueueCapture(_captureRequest{UserName: "alice", Camera: "front"})
+	}
+
+	// queued captures are finished before the timeout
+	started := time.Now()
+	shuttingDown.Store(true)
+	drainCaptures(10*time.Second, stopped)
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("should not wait until the timeout: %s", elapsed)
+	}
+
+	results.Lock()
+	defer results.Unlock()
+	if len(results.errs) != 3 {
+		t.Fatalf("expected all queued captures to be processed, got %d", len(results.errs))
+	}
+	for _, err := range results.errs {
+		if err != nil {
+			t.Errorf("capture should not be canceled: %s", err)
+		}
+	}
+
+	// new requests are dropped while shutting down
+	enqueueCapture(_captureRequest{UserName: "alice", Camera: "front"})
+	if count := pendingCaptures(); count != 0 {
+		t.Errorf("expected no pending captures, got %d", count)
+	}
+}
+
+func TestDrainCapturesCanceledAfterTimeout(t *testing.T) {
+	setupDrain(t)
+	useFakeLibcamera(t, `exec sleep 30`)
+
+	results := &capturedResults{}
+	stopped := startCaptureWorker(results)
+	for range 2 {
+		enqueueCapture(_captureRequest{UserName: "alice", Camera: "front"})
+	}
+
+	// hanging captures are canceled (with their camera processes killed) after the timeout
+	started := time.Now()
+	shuttingDown.Store(true)
+	drainCaptures(300*time.Millisecond, stopped)
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("should not wait for hanging captures: %s", elapsed)
+	}
+
+	select {
+	case <-stopped:
+	default:
+		t.Errorf("capture worker should be stopped")
+	}
+	results.Lock()
+	defer results.Unlock()
+	if len(results.errs) < 1 || !errors.Is(results.errs[0], context.Canceled) {
+		t.Errorf("expected the in-flight capture to be canceled, got: %v", results.errs)
+	}
+	if count := pendingCaptures(); count > 1 {
+		t.Errorf("expected at most the queued one (never started) to be left, got %d", count)
+	}
+}
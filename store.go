@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// constants for local database
+	DbFilename = "db.sqlite"
+
+	// storage backends
+	storageSQLite = "sqlite"
+	storageMemory = "memory"
+)
+
+// error for photos which do not exist
+var errPhotoNotFound = errors.New("no such photo")
+
+// error for subscriptions which do not exist
+var errSubscriptionNotFound = errors.New("no such subscription")
+
+// Photo is a photo sent to a user
+type Photo struct {
+	ID          int64     `json:"-"`
+	UserName    string    `json:"user_name"`
+	FileID      string    `json:"file_id"`
+	Caption     string    `json:"caption"`
+	Time        time.Time `json:"time"`
+	ArchivePath string    `json:"archive_path,omitempty"` // relative to `archive_dir`
+	IsDocument  bool      `json:"is_document,omitempty"`  // sent as a document, not as a photo
+	IsFavorite  bool      `json:"is_favorite,omitempty"`
+	ChatID      int64     `json:"chat_id,omitempty"`    // chat where the photo was sent to
+	MessageID   int64     `json:"message_id,omitempty"` // message of the sent photo
+	Camera      string    `json:"camera,omitempty"`     // name of the camera which captured the photo
+}
+
+// Store is an interface for storing captured photos
+type Store interface {
+	// savePhoto saves a photo and returns its id (current time will be used if `photo.Time` is zero)
+	savePhoto(photo Photo) (id int64, err error)
+
+	// savePhotos saves photos at once (none of them are saved if any of them fails)
+	savePhotos(photos []Photo) error
+
+	// updateSentPhoto updates the file id, chat id, and message id of a saved photo after it is sent
+	updateSentPhoto(photo Photo) error
+
+	// setFavorite marks (or unmarks) a saved photo as favorite
+	setFavorite(id int64, favorite bool) error
+
+	// deletePhoto deletes a saved photo
+	deletePhoto(id int64) error
+
+	// getPhoto returns a photo with given id
+	getPhoto(id int64) (Photo, error)
+
+	// getPhotoByMessage returns a photo sent with given chat id and message id
+	getPhotoByMessage(chatID, messageID int64) (Photo, error)
+
+	// getPhotos returns latest `latestN` photos of given user, in descending order
+	// (photos which are not sent yet are not included)
+	getPhotos(userName string, latestN int) ([]Photo, error)
+
+	// getPhotosSince returns all photos taken at or after `since`, in ascending order
+	// (photos which are not sent yet are not included)
+	getPhotosSince(since time.Time) ([]Photo, error)
+
+	// getPhotosBefore returns all photos taken before `before`, in ascending order
+	// (photos which are not sent yet are not included)
+	getPhotosBefore(before time.Time) ([]Photo, error)
+
+	// hasArchivePath returns if any saved photo has given archive path
+	// (photos sent to multiple chats share an archived original)
+	hasArchivePath(archivePath string) (bool, error)
+
+	// subscribe saves a subscription (current time will be used if `subscription.Time` is zero)
+	subscribe(subscription Subscription) error
+
+	// unsubscribe deletes a subscription of a chat
+	unsubscribe(chatID int64, topic string) error
+
+	// getSubscriptions returns subscriptions of a chat, in the order of topics
+	getSubscriptions(chatID int64) ([]Subscription, error)
+
+	// getSubscribers returns ids of chats which subscribed given topic
+	getSubscribers(topic string) ([]int64, error)
+
+	// setQuietHours sets (or clears with nil) quiet hours of a chat
+	setQuietHours(chatID int64, hours *quietHours) error
+
+	// getQuietHours returns quiet hours of a chat (nil if not set)
+	getQuietHours(chatID int64) (*quietHours, error)
+
+	// close releases resources of the store
+	close() error
+}
+
+// openStore opens a store with given storage backend and database path
+//
+// (if `dbPath` is empty, `DbFilename` next to the executable will be used,
+// and if it is relative, it will be resolved against the executable's directory)
+func openStore(storage, dbPath string) (Store, error) {
+	switch storage {
+	case "", storageSQLite:
+		if dbPath == "" {
+			dbPath = DbFilename
+		}
+		path, err := resolvePath(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		return openDB(path)
+	case storageMemory:
+		return newMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", storage)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore is a `Store` which keeps photos in memory only
+//
+// (useful for tests, or for read-only filesystems where history doesn't need to survive restarts)
+type memoryStore struct {
+	photos        []Photo
+	lastID        int64
+	subscriptions []Subscription
+	quietHours    map[int64]quietHours
+	sync.RWMutex
+}
+
+// newMemoryStore returns a new, empty memory store
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		photos:        []Photo{},
+		subscriptions: []Subscription{},
+		quietHours:    map[int64]quietHours{},
+	}
+}
+
+// savePhoto saves a photo
+func (m *memoryStore) savePhoto(photo Photo) (id int64, err error) {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.appendPhoto(photo), nil
+}
+
+// savePhotos saves photos at once
+func (m *memoryStore) savePhotos(photos []Photo) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, photo := range photos {
+		m.appendPhoto(photo)
+	}
+
+	return nil
+}
+
+// appendPhoto appends a photo with a new id, and returns the id (should be called while holding the lock)
+func (m *memoryStore) appendPhoto(photo Photo) int64 {
+	if photo.Time.IsZero() {
+		photo.Time = time.Now()
+	}
+	photo.Time = photo.Time.Truncate(time.Second)
+
+	m.lastID++
+	photo.ID = m.lastID
+
+	m.photos = append(m.photos, photo)
+
+	return photo.ID
+}
+
+// updateSentPhoto updates the file id, chat id, and message id of a saved photo
+func (m *memoryStore) updateSentPhoto(photo Photo) error {
+	m.Lock()
+	defer m.Unlock()
+
+	i := m.indexOf(photo.ID)
+	if i < 0 {
+		return errPhotoNotFound
+	}
+	m.photos[i].FileID = photo.FileID
+	m.photos[i].IsDocument = photo.IsDocument
+	m.photos[i].ChatID = photo.ChatID
+	m.photos[i].MessageID = photo.MessageID
+
+	return nil
+}
+
+// setFavorite marks (or unmarks) a saved photo as favorite
+func (m *memoryStore) setFavorite(id int64, favorite bool) error {
+	m.Lock()
+	defer m.Unlock()
+
+	i := m.indexOf(id)
+	if i < 0 {
+		return errPhotoNotFound
+	}
+	m.photos[i].IsFavorite = favorite
+
+	return nil
+}
+
+// deletePhoto deletes a saved photo
+func (m *memoryStore) deletePhoto(id int64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	i := m.indexOf(id)
+	if i < 0 {
+		return errPhotoNotFound
+	}
+	m.photos = append(m.photos[:i], m.photos[i+1:]...)
+
+	return nil
+}
+
+// getPhoto returns a photo with given id
+func (m *memoryStore) getPhoto(id int64) (Photo, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	i := m.indexOf(id)
+	if i < 0 {
+		return Photo{}, errPhotoNotFound
+	}
+
+	return m.photos[i], nil
+}
+
+// getPhotoByMessage returns a photo sent with given chat id and message id
+func (m *memoryStore) getPhotoByMessage(chatID, messageID int64) (Photo, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	for _, photo := range m.photos {
+		if photo.ChatID == chatID && photo.MessageID == messageID {
+			return photo, nil
+		}
+	}
+
+	return Photo{}, errPhotoNotFound
+}
+
+// indexOf returns the index of a photo with given id, or -1 if there is none
+func (m *memoryStore) indexOf(id int64) int {
+	for i, photo := range m.photos {
+		if photo.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// getPhotos returns latest `latestN` photos of given user
+func (m *memoryStore) getPhotos(userName string, latestN int) ([]Photo, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	photos := []Photo{}
+	for i := len(m.photos) - 1; i >= 0 && len(photos) < latestN; i-- {
+		if m.photos[i].UserName == userName && m.photos[i].FileID != "" {
+			photos = append(photos, m.photos[i])
+		}
+	}
+
+	return photos, nil
+}
+
+// getPhotosSince returns all photos taken at or after `since`
+func (m *memoryStore) getPhotosSince(since time.Time) ([]Photo, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	photos := []Photo{}
+	for _, photo := range m.photos {
+		if !photo.Time.Before(since) && photo.FileID != "" {
+			photos = append(photos, photo)
+		}
+	}
+	sort.SliceStable(photos, func(i, j int) bool {
+		return photos[i].Time.Before(photos[j].Time)
+	})
+
+	return photos, nil
+}
+
+// getPhotosBefore returns all photos taken before `before`
+func (m *memoryStore) getPhotosBefore(before time.Time) ([]Photo, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	photos := []Photo{}
+	for _, photo := range m.photos {
+		if photo.Time.Before(before) && photo.FileID != "" {
+			photos = append(photos, photo)
+		}
+	}
+	sort.SliceStable(photos, func(i, j int) bool {
+		return photos[i].Time.Before(photos[j].Time)
+	})
+
+	return photos, nil
+}
+
+// hasArchivePath returns if any saved photo has given archive path
+func (m *memoryStore) hasArchivePath(archivePath string) (bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	return slices.ContainsFunc(m.photos, func(photo Photo) bool {
+		return photo.ArchivePath == archivePath
+	}), nil
+}
+
+// subscribe saves a subscription (replacing the existing one of the same chat and topic)
+func (m *memoryStore) subscribe(subscription Subscription) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if subscription.Time.IsZero() {
+		subscription.Time = time.Now()
+	}
+	subscription.Time = subscription.Time.Truncate(time.Second)
+
+	m.subscriptions = slices.DeleteFunc(m.subscriptions, func(s Subscription) bool {
+		return s.ChatID == subscription.ChatID && s.Topic == subscription.Topic
+	})
+	m.subscriptions = append(m.subscriptions, subscription)
+
+	return nil
+}
+
+// unsubscribe deletes a subscription of a chat
+func (m *memoryStore) unsubscribe(chatID int64, topic string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	count := len(m.subscriptions)
+	m.subscriptions = slices.DeleteFunc(m.subscriptions, func(s Subscription) bool {
+		return s.ChatID == chatID && s.Topic == topic
+	})
+	if len(m.subscriptions) == count {
+		return errSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// getSubscriptions returns subscriptions of a chat
+func (m *memoryStore) getSubscriptions(chatID int64) ([]Subscription, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	subscriptions := []Subscription{}
+	for _, subscription := range m.subscriptions {
+		if subscription.ChatID == chatID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Topic < subscriptions[j].Topic
+	})
+
+	return subscriptions, nil
+}
+
+// getSubscribers returns ids of chats which subscribed given topic
+func (m *memoryStore) getSubscribers(topic string) ([]int64, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	chatIDs := []int64{}
+	for _, subscription := range m.subscriptions {
+		if subscription.Topic == topic {
+			chatIDs = append(chatIDs, subscription.ChatID)
+		}
+	}
+	slices.Sort(chatIDs)
+
+	return chatIDs, nil
+}
+
+// setQuietHours sets (or clears with nil) quiet hours of a chat
+func (m *memoryStore) setQuietHours(chatID int64, hours *quietHours) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if hours == nil {
+		delete(m.quietHours, chatID)
+	} else {
+		m.quietHours[chatID] = *hours
+	}
+
+	return nil
+}
+
+// getQuietHours returns quiet hours of a chat
+func (m *memoryStore) getQuietHours(chatID int64) (*quietHours, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if hours, exists := m.quietHours[chatID]; exists {
+		return &hours, nil
+	}
+
+	return nil, nil
+}
+
+// close does nothing
+func (m *memoryStore) close() error {
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// stores returns all `Store` implementations for testing them with the same expectations
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	sqlite, err := openDB(filepath.Join(t.TempDir(), DbFilename))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	t.Cleanup(func() { _ = sqlite.close() })
+
+	return map[string]Store{
+		storageSQLite: sqlite,
+		storageMemory: newMemoryStore(),
+	}
+}
+
+// fileIDsOf returns file ids of given photos
+func fileIDsOf(photos []Photo) (fileIDs []string) {
+	for _, photo := range photos {
+		fileIDs = append(fileIDs, photo.FileID)
+	}
+	return fileIDs
+}
+
+func TestStorePhotos(t *testing.T) {
+	base := time.Date(2026, 1, 1, 9, 0, 0, 0, time.Local)
+
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			// save
+			ids := []int64{}
+			for i, photo := range []Photo{
+				{UserName: "alice", FileID: "a1", Caption: "first", Time: base, Camera: "front"},
+				{UserName: "bob", FileID: "b1", Time: base.Add(time.Minute)},
+				{UserName: "alice", FileID: "a2", Time: base.Add(2 * time.Minute), ArchivePath: "2026-01/a2.jpg", IsDocument: true},
+				{UserName: "alice", FileID: "", Time: base.Add(3 * time.Minute)}, // not sent yet
+			} {
+				id, err := store.savePhoto(photo)
+				if err != nil {
+					t.Fatalf("failed to save photo #%d: %s", i, err)
+				}
+				ids = append(ids, id)
+			}
+			if len(slices.Compact(slices.Sorted(slices.Values(ids)))) != len(ids) {
+				t.Errorf("expected unique ids, got %v", ids)
+			}
+
+			// get
+			photo, err := store.getPhoto(ids[0])
+			if err != nil {
+				t.Fatalf("failed to get photo: %s", err)
+			}
+			if photo.ID != ids[0] || photo.UserName != "alice" || photo.Caption != "first" || photo.Camera != "front" || !photo.Time.Equal(base) {
+				t.Errorf("unexpected photo: %+v", photo)
+			}
+			if photo, _ := store.getPhoto(ids[2]); photo.ArchivePath != "2026-01/a2.jpg" || !photo.IsDocument {
+				t.Errorf("unexpected photo: %+v", photo)
+			}
+			if _, err := store.getPhoto(-1); !errors.Is(err, errPhotoNotFound) {
+				t.Errorf("expected not found, got: %v", err)
+			}
+			if inUse, err := store.hasArchivePath("2026-01/a2.jpg"); err != nil || !inUse {
+				t.Errorf("expected the archive path in use (%v)", err)
+			}
+			if inUse, err := store.hasArchivePath("2026-01/none.jpg"); err != nil || inUse {
+				t.Errorf("expected the archive path not in use (%v)", err)
+			}
+
+			// queries (without the unsent one)
+			if photos, _ := store.getPhotos("alice", 10); !slices.Equal(fileIDsOf(photos), []string{"a2", "a1"}) {
+				t.Errorf("unexpected photos of alice: %v", fileIDsOf(photos))
+			}
+			if photos, _ := store.getPhotos("alice", 1); !slices.Equal(fileIDsOf(photos), []string{"a2"}) {
+				t.Errorf("unexpected latest photo of alice: %v", fileIDsOf(photos))
+			}
+			if photos, _ := store.getPhotosSince(base.Add(time.Minute)); !slices.Equal(fileIDsOf(photos), []string{"b1", "a2"}) {
+				t.Errorf("unexpected photos since: %v", fileIDsOf(photos))
+			}
+			if photos, _ := store.getPhotosBefore(base.Add(time.Minute)); !slices.Equal(fileIDsOf(photos), []string{"a1"}) {
+				t.Errorf("unexpected photos before: %v", fileIDsOf(photos))
+			}
+
+			// update after sent
+			if err := store.updateSentPhoto(Photo{ID: ids[3], FileID: "a3", ChatID: 100, MessageID: 200}); err != nil {
+				t.Fatalf("failed to update photo: %s", err)
+			}
+			if photo, err := store.getPhotoByMessage(100, 200); err != nil || photo.ID != ids[3] || photo.FileID != "a3" {
+				t.Errorf("unexpected photo by message: %+v (%v)", photo, err)
+			}
+			if _, err := store.getPhotoByMessage(100, 201); !errors.Is(err, errPhotoNotFound) {
+				t.Errorf("expected not found, got: %v", err)
+			}
+			if photos, _ := store.getPhotos("alice", 10); !slices.Equal(fileIDsOf(photos), []string{"a3", "a2", "a1"}) {
+				t.Errorf("unexpected photos of alice: %v", fileIDsOf(photos))
+			}
+			if err := store.updateSentPhoto(Photo{ID: -1, FileID: "x"}); !errors.Is(err, errPhotoNotFound) {
+				t.Errorf("expected not found, got: %v", err)
+			}
+
+			// favorite
+			if err := store.setFavorite(ids[1], true); err != nil {
+				t.Fatalf("failed to set favorite: %s", err)
+			}
+			if photo, _ := store.getPhoto(ids[1]); !photo.IsFavorite {
+				t.Errorf("expected a favorite photo")
+			}
+			if err := store.setFavorite(-1, true); !errors.Is(err, errPhotoNotFound) {
+				t.Errorf("expected not found, got: %v", err)
+			}
+
+			// delete
+			if err := store.deletePhoto(ids[0]); err != nil {
+				t.Fatalf("failed to delete photo: %s", err)
+			}
+			if _, err := store.getPhoto(ids[0]); !errors.Is(err, errPhotoNotFound) {
+				t.Errorf("expected not found after deletion, got: %v", err)
+			}
+			if err := store.deletePhoto(ids[0]); !errors.Is(err, errPhotoNotFound) {
+				t.Errorf("expected not found, got: %v", err)
+			}
+
+			// current time for zero time
+			id, _ := store.savePhoto(Photo{UserName: "carol", FileID: "c1"})
+			if photo, _ := store.getPhoto(id); time.Since(photo.Time) > time.Minute || time.Since(photo.Time) < -time.Second {
+				t.Errorf("expected current time, got %s", photo.Time)
+			}
+
+			// batch
+			if err := store.savePhotos([]Photo{
+				{UserName: "dave", FileID: "d1", Time: base},
+				{UserName: "dave", FileID: "d2", Time: base.Add(time.Second)},
+			}); err != nil {
+				t.Fatalf("failed to save photos: %s", err)
+			}
+			if photos, _ := store.getPhotos("dave", 10); !slices.Equal(fileIDsOf(photos), []string{"d2", "d1"}) {
+				t.Errorf("unexpected photos of dave: %v", fileIDsOf(photos))
+			}
+		})
+	}
+}
+
+func TestStoreSubscriptions(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, subscription := range []Subscription{
+				{ChatID: 2, Topic: topicMotion, UserName: "alice"},
+				{ChatID: 1, Topic: topicMotion, UserName: "bob"},
+				{ChatID: 1, Topic: topicHealth, UserName: "bob"},
+				{ChatID: 1, Topic: topicMotion, UserName: "carol"}, // replaces the one of bob
+			} {
+				if err := store.subscribe(subscription); err != nil {
+					t.Fatalf("failed to subscribe: %s", err)
+				}
+			}
+
+			subscriptions, err := store.getSubscriptions(1)
+			if err != nil {
+				t.Fatalf("failed to get subscriptions: %s", err)
+			}
+			if len(subscriptions) != 2 ||
+				subscriptions[0].Topic != topicHealth ||
+				subscriptions[1].Topic != topicMotion || subscriptions[1].UserName != "carol" ||
+				time.Since(subscriptions[1].Time) > time.Minute {
+				t.Errorf("unexpected subscriptions: %+v", subscriptions)
+			}
+
+			if chatIDs, _ := store.getSubscribers(topicMotion); !slices.Equal(chatIDs, []int64{1, 2}) {
+				t.Errorf("unexpected subscribers: %v", chatIDs)
+			}
+
+			if err := store.unsubscribe(1, topicMotion); err != nil {
+				t.Fatalf("failed to unsubscribe: %s", err)
+			}
+			if err := store.unsubscribe(1, topicMotion); !errors.Is(err, errSubscriptionNotFound) {
+				t.Errorf("expected not found, got: %v", err)
+			}
+			if chatIDs, _ := store.getSubscribers(topicMotion); !slices.Equal(chatIDs, []int64{2}) {
+				t.Errorf("unexpected subscribers: %v", chatIDs)
+			}
+			if chatIDs, _ := store.getSubscribers("nothing"); chatIDs == nil || len(chatIDs) != 0 {
+				t.Errorf("expected empty subscribers, got %v", chatIDs)
+			}
+		})
+	}
+}
+
+func TestStoreQuietHours(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			if hours, err := store.getQuietHours(1); err != nil || hours != nil {
+				t.Errorf("expected no quiet hours, got %+v (%v)", hours, err)
+			}
+
+			if err := store.setQuietHours(1, &quietHours{Start: 22 * 60, End: 7 * 60}); err != nil {
+				t.Fatalf("failed to set quiet hours: %s", err)
+			}
+			if err := store.setQuietHours(1, &quietHours{Start: 23 * 60, End: 6 * 60}); err != nil {
+				t.Fatalf("failed to set quiet hours: %s", err)
+			}
+			if hours, err := store.getQuietHours(1); err != nil || hours == nil || *hours != (quietHours{Start: 23 * 60, End: 6 * 60}) {
+				t.Errorf("unexpected quiet hours: %+v (%v)", hours, err)
+			}
+
+			if err := store.setQuietHours(1, nil); err != nil {
+				t.Fatalf("failed to clear quiet hours: %s", err)
+			}
+			if hours, err := store.getQuietHours(1); err != nil || hours != nil {
+				t.Errorf("expected no quiet hours, got %+v (%v)", hours, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// edges of gpio lines
+	gpioEdgeRising  = "rising"
+	gpioEdgeFalling = "falling"
+	gpioEdgeBoth    = "both"
+
+	// biases of gpio lines
+	gpioBiasPullUp   = "pull-up"
+	gpioBiasPullDown = "pull-down"
+	gpioBiasDisabled = "disabled"
+
+	// path of the in-memory chip (for testing without gpio)
+	gpioChipFake = "fake"
+
+	// default values for triggers
+	defaultGPIOChip               = "/dev/gpiochip0"
+	defaultTriggerCooldownSeconds = 10
+
+	// consumer label of requested gpio lines
+	gpioConsumer = "telegram-rpi-camera-bot"
+
+	// prefix of user names of triggered captures
+	gpioUserNamePrefix = "gpio:"
+)
+
+// GPIOChip is an interface for gpio chips which emit edge events of their lines
+type GPIOChip interface {
+	// watch requests a line as an input, and returns a channel of its edge events
+	// (the channel will be closed when the chip is closed)
+	watch(line gpioLineConfig) (<-chan gpioEvent, error)
+
+	// output requests a line as an output (initially off)
+	output(offset int, activeLow bool) (gpioOutput, error)
+
+	// close releases the chip and its requested lines
+	close() error
+}
+
+// gpioOutput is an interface for gpio lines requested as outputs
+type gpioOutput interface {
+	// set turns the line on or off (logically, regarding `active_low`)
+	set(on bool) error
+}
+
+// gpioLineConfig is a configuration of a watched gpio line
+type gpioLineConfig struct {
+	Offset    int
+	Edge      string
+	Bias      string
+	ActiveLow bool
+	Debounce  time.Duration
+}
+
+// gpioEvent is an edge event of a gpio line
+type gpioEvent struct {
+	Offset int
+	Rising bool
+	Time   time.Time
+}
+
+// triggerConfig is a configuration of a gpio-triggered capture (eg. PIR sensor, doorbell button)
+type triggerConfig struct {
+	Name string `json:"name"` // shown in captions (eg. "doorbell")
+
+	// gpio line
+	Chip           string `json:"chip,omitempty"` // (default: "/dev/gpiochip0", or "fake")
+	Line           int    `json:"line"`
+	Edge           string `json:"edge,omitempty"` // "rising" (default), "falling", or "both"
+	Bias           string `json:"bias,omitempty"` // "pull-up", "pull-down", or "disabled" (as-is if empty)
+	ActiveLow      bool   `json:"active_low"`
+	DebounceMillis int    `json:"debounce_ms,omitempty"`
+
+	// events are ignored for this time after a capture (default: 10 seconds)
+	CooldownSeconds int `json:"cooldown_seconds,omitempty"`
+
+	// camera for capturing (default camera if empty)
+	Camera string `json:"camera,omitempty"`
+
+	// chats where captured photos are sent to
+	// (chats which subscribed `motion` are also notified)
+	Chats []int64 `json:"chats,omitempty"`
+}
+
+// validate checks if the trigger config has valid values
+func (c triggerConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("`name` is needed for trigger")
+	}
+	if c.Line < 0 {
+		return fmt.Errorf("gpio line of trigger '%s' should not be negative: %d", c.Name, c.Line)
+	}
+	switch c.Edge {
+	case "", gpioEdgeRising, gpioEdgeFalling, gpioEdgeBoth:
+	default:
+		return fmt.Errorf("unknown edge of trigger '%s': %s", c.Name, c.Edge)
+	}
+	switch c.Bias {
+	case "", gpioBiasPullUp, gpioBiasPullDown, gpioBiasDisabled:
+	default:
+		return fmt.Errorf("unknown bias of trigger '%s': %s", c.Name, c.Bias)
+	}
+	if c.DebounceMillis < 0 || c.CooldownSeconds < 0 {
+		return fmt.Errorf("debounce and cooldown of trigger '%s' should not be negative: %d, %d", c.Name, c.DebounceMillis, c.CooldownSeconds)
+	}
+
+	return nil
+}
+
+// chip returns the path of the gpio chip
+func (c triggerConfig) chip() string {
+	if c.Chip == "" {
+		return defaultGPIOChip
+	}
+	return c.Chip
+}
+
+// line returns the configuration of the watched gpio line
+func (c triggerConfig) line() gpioLineConfig {
+	edge := c.Edge
+	if edge == "" {
+		edge = gpioEdgeRising
+	}
+
+	return gpioLineConfig{
+		Offset:    c.Line,
+		Edge:      edge,
+		Bias:      c.Bias,
+		ActiveLow: c.ActiveLow,
+		Debounce:  time.Duration(c.DebounceMillis) * time.Millisecond,
+	}
+}
+
+// triggerUserName returns the user name of captures requested by given trigger (eg. "gpio:doorbell")
+func triggerUserName(trigger triggerConfig) string {
+	return gpioUserNamePrefix + trigger.Name
+}
+
+// cooldown returns the time for ignoring events after a capture
+func (c triggerConfig) cooldown() time.Duration {
+	if c.CooldownSeconds <= 0 {
+		return defaultTriggerCooldownSeconds * time.Second
+	}
+	return time.Duration(c.CooldownSeconds) * time.Second
+}
+
+// openGPIOChip opens a gpio chip of given path (or the in-memory one for "fake")
+func openGPIOChip(path string) (GPIOChip, error) {
+	if path == gpioChipFake {
+		return newFakeGPIOChip(), nil
+	}
+
+	return openCdevGPIOChip(path)
+}
+
+// watchTriggers watches gpio lines of triggers, and calls `fire` on their edge events
+// (except the ones in cooldown), and returns the opened chips
+//
+// `stop` closes the chips, and waits for the watchers to return (so `fire` is not called after it)
+func watchTriggers(triggers []triggerConfig, fire func(trigger triggerConfig, event gpioEvent)) (chips map[string]GPIOChip, stop func(), err error) {
+	chips = map[string]GPIOChip{}
+	var watchers sync.WaitGroup
+	closeAll := func() {
+		for _, chip := range chips {
+			_ = chip.close()
+		}
+		watchers.Wait()
+	}
+
+	for _, trigger := range triggers {
+		chip, exists := chips[trigger.chip()]
+		if !exists {
+			if chip, err = openGPIOChip(trigger.chip()); err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("failed to open gpio chip for trigger '%s': %w", trigger.Name, err)
+			}
+			chips[trigger.chip()] = chip
+		}
+
+		var events <-chan gpioEvent
+		if events, err = chip.watch(trigger.line()); err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("failed to watch gpio line for trigger '%s': %w", trigger.Name, err)
+		}
+
+		watchers.Add(1)
+		go func(trigger triggerConfig) {
+			defer watchers.Done()
+
+			var last time.Time
+			for event := range events {
+				if !last.IsZero() && event.Time.Sub(last) < trigger.cooldown() {
+					continue
+				}
+				last = event.Time
+
+				fire(trigger, event)
+			}
+		}(trigger)
+	}
+
+	return chips, closeAll, nil
+}
+
+// fakeGPIOChip is an in-memory gpio chip (for testing)
+type fakeGPIOChip struct {
+	sync.Mutex
+
+	watchers   map[int][]chan gpioEvent
+	lines      map[int]gpioLineConfig
+	lastEvents map[int]time.Time // for debouncing
+	values     map[int]bool      // values of output lines
+	closed     bool
+}
+
+// newFakeGPIOChip returns a new in-memory gpio chip
+func newFakeGPIOChip() *fakeGPIOChip {
+	return &fakeGPIOChip{
+		watchers:   map[int][]chan gpioEvent{},
+		lines:      map[int]gpioLineConfig{},
+		lastEvents: map[int]time.Time{},
+		values:     map[int]bool{},
+	}
+}
+
+// watch returns a channel of edge events of given line
+func (f *fakeGPIOChip) watch(line gpioLineConfig) (<-chan gpioEvent, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.closed {
+		return nil, fmt.Errorf("gpio chip is closed")
+	}
+
+	events := make(chan gpioEvent, 1)
+	f.watchers[line.Offset] = append(f.watchers[line.Offset], events)
+	f.lines[line.Offset] = line
+
+	return events, nil
+}
+
+// output requests a line as an output
+func (f *fakeGPIOChip) output(offset int, activeLow bool) (gpioOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.closed {
+		return nil, fmt.Errorf("gpio chip is closed")
+	}
+	f.values[offset] = false
+
+	return &fakeGPIOOutput{chip: f, offset: offset}, nil
+}
+
+// value returns the value of an output line
+func (f *fakeGPIOChip) value(offset int) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.values[offset]
+}
+
+// fakeGPIOOutput is an output line of the in-memory gpio chip
+type fakeGPIOOutput struct {
+	chip   *fakeGPIOChip
+	offset int
+}
+
+// set sets the value of the line
+func (o *fakeGPIOOutput) set(on bool) error {
+	o.chip.Lock()
+	defer o.chip.Unlock()
+
+	if o.chip.closed {
+		return fmt.Errorf("gpio chip is closed")
+	}
+	o.chip.values[o.offset] = on
+
+	return nil
+}
+
+// trigger emits an edge event on given line
+// (dropped if the line doesn't watch the edge, or within the debounce period of the last one)
+func (f *fakeGPIOChip) trigger(offset int, rising bool) {
+	f.Lock()
+	defer f.Unlock()
+
+	line, exists := f.lines[offset]
+	if !exists || f.closed ||
+		(line.Edge == gpioEdgeRising && !rising) ||
+		(line.Edge == gpioEdgeFalling && rising) {
+		return
+	}
+
+	now := time.Now()
+	if last, exists := f.lastEvents[offset]; exists && now.Sub(last) < line.Debounce {
+		return
+	}
+	f.lastEvents[offset] = now
+
+	for _, events := range f.watchers[offset] {
+		events <- gpioEvent{Offset: offset, Rising: rising, Time: now}
+	}
+}
+
+// close closes channels of all watched lines
+func (f *fakeGPIOChip) close() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if !f.closed {
+		for _, watchers := range f.watchers {
+			for _, events := range watchers {
+				close(events)
+			}
+		}
+		f.closed = true
+	}
+
+	return nil
+}
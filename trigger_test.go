@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// receiveEvent returns an event from given channel, or false if nothing is received in a while
+func receiveEvent[T any](events <-chan T) (event T, received bool) {
+	select {
+	case event = <-events:
+		return event, true
+	case <-time.After(200 * time.Millisecond):
+		return event, false
+	}
+}
+
+func TestFakeGPIOChipEdgesAndDebounce(t *testing.T) {
+	chip := newFakeGPIOChip()
+	defer func() { _ = chip.close() }()
+
+	rising, err := chip.watch(gpioLineConfig{Offset: 4, Edge: gpioEdgeRising, Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	both, err := chip.watch(gpioLineConfig{Offset: 17, Edge: gpioEdgeBoth})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// edges
+	chip.trigger(4, false)
+	if _, received := receiveEvent(rising); received {
+		t.Errorf("falling edge should be dropped on a rising line")
+	}
+	chip.trigger(17, false)
+	if event, received := receiveEvent(both); !received || event.Offset != 17 || event.Rising {
+		t.Errorf("expected a falling edge, got %+v (%t)", event, received)
+	}
+
+	// debounce
+	chip.trigger(4, true)
+	if _, received := receiveEvent(rising); !received {
+		t.Errorf("expected a rising edge")
+	}
+	chip.trigger(4, true)
+	if _, received := receiveEvent(rising); received {
+		t.Errorf("bouncing edge should be dropped")
+	}
+	time.Sleep(60 * time.Millisecond)
+	chip.trigger(4, true)
+	if _, received := receiveEvent(rising); !received {
+		t.Errorf("expected a rising edge after the debounce period")
+	}
+
+	// closed
+	_ = chip.close()
+	if _, open := <-rising; open {
+		t.Errorf("expected a closed channel")
+	}
+}
+
+func TestTriggerCooldown(t *testing.T) {
+	fired := make(chan string, 10)
+	chips, stop, err := watchTriggers([]triggerConfig{
+		{Name: "doorbell", Chip: gpioChipFake, Line: 17, CooldownSeconds: 1},
+		{Name: "motion", Chip: gpioChipFake, Line: 4, CooldownSeconds: 1},
+	}, func(trigger triggerConfig, event gpioEvent) {
+		fired <- trigger.Name
+	})
+	if err != nil {
+		t.Fatalf("failed to watch triggers: %s", err)
+	}
+	defer stop()
+	chip := chips[gpioChipFake].(*fakeGPIOChip)
+
+	chip.trigger(17, true)
+	if name, _ := receiveEvent(fired); name != "doorbell" {
+		t.Errorf("expected doorbell, got '%s'", name)
+	}
+
+	// other triggers are not in cooldown
+	chip.trigger(4, true)
+	if name, _ := receiveEvent(fired); name != "motion" {
+		t.Errorf("expected motion, got '%s'", name)
+	}
+
+	// in cooldown
+	chip.trigger(17, true)
+	if name, received := receiveEvent(fired); received {
+		t.Errorf("expected nothing in cooldown, got '%s'", name)
+	}
+
+	// after cooldown
+	time.Sleep(time.Second)
+	chip.trigger(17, true)
+	if name, _ := receiveEvent(fired); name != "doorbell" {
+		t.Errorf("expected doorbell after cooldown, got '%s'", name)
+	}
+}
+
+func TestCaptureTriggered(t *testing.T) {
+	cameras = map[string]*camera{"front": {name: "front", config: cameraConfig{Backend: cameraBackendFake}}}
+	cameraNames = []string{"front"}
+	captureChannel = make(chan _captureRequest, 10)
+	captureJobs = _captureJobs{Cancels: map[string]map[int64]context.CancelFunc{}}
+	defer func() { cameras, cameraNames, captureChannel = nil, nil, nil }()
+
+	chips, stop, err := watchTriggers([]triggerConfig{
+		{Name: "doorbell", Chip: gpioChipFake, Line: 17, Chats: []int64{1, 2, 3}},
+		{Name: "nobody", Chip: gpioChipFake, Line: 4},
+	}, captureTriggered)
+	if err != nil {
+		t.Fatalf("failed to watch triggers: %s", err)
+	}
+	defer stop() // (before restoring the globals, as the watchers read them)
+	chip := chips[gpioChipFake].(*fakeGPIOChip)
+
+	// captured once for all chats
+	chip.trigger(17, true)
+	request, received := receiveEvent(captureChannel)
+	if !received {
+		t.Fatalf("expected a capture request")
+	}
+	defer finishCapture(request)
+	if request.UserName != "gpio:doorbell" || request.Trigger != "doorbell" || request.Camera != "front" {
+		t.Errorf("unexpected capture request: %+v", request)
+	}
+	if request.ChatID != int64(1) || !slices.Equal(request.OtherChatIDs, []int64{2, 3}) {
+		t.Errorf("unexpected chats: %v, %v", request.ChatID, request.OtherChatIDs)
+	}
+	if request, received := receiveEvent(captureChannel); received {
+		t.Errorf("expected only one capture request, got another: %+v", request)
+	}
+
+	// no chats
+	chip.trigger(4, true)
+	if request, received := receiveEvent(captureChannel); received {
+		t.Errorf("expected no capture request without chats, got: %+v", request)
+	}
+}
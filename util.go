@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	// infisical
@@ -25,10 +29,17 @@ const (
 	// constants for config
 	configFilename = "config.json"
 
-	libCameraStillBin               = "/usr/bin/libcamera-still"
 	libCameraStillRunTimeoutSeconds = 10
+	longExposureTimeoutFactor       = 5 // (libcamera-still takes several frames with the given shutter speed)
+
+	defaultBurstIntervalMillis = 1000
+	minBurstCount              = 2
+	maxBurstCount              = 10 // (max number of photos in a media group)
 )
 
+// path of libcamera-still (replaced with fake ones in tests)
+var libCameraStillBin = "/usr/bin/libcamera-still"
+
 // struct for config file
 type config struct {
 	AvailableIds       []string       `json:"available_ids"`
@@ -40,6 +51,69 @@ type config struct {
 	MaintenanceMessage string         `json:"maintenance_message"`
 	IsVerbose          bool           `json:"is_verbose"`
 
+	// chats where admin-only commands (eg. `/purge`) are allowed
+	AdminChats []int64 `json:"admin_chats,omitempty"`
+
+	// reload users, image size, camera params, and maintenance mode when this file is modified
+	WatchConfig bool `json:"watch_config,omitempty"`
+
+	// named cameras (a single camera of libcamera with the values above if empty)
+	Cameras       map[string]cameraConfig `json:"cameras,omitempty"`
+	DefaultCamera string                  `json:"default_camera,omitempty"`
+
+	// fleet of multiple Pis (for cameras of `agent` backend, or running as an agent)
+	Fleet *fleetConfig `json:"fleet,omitempty"`
+
+	// pan/tilt mount of a camera (not used if nil)
+	Mount *mountConfig `json:"mount,omitempty"`
+
+	// gpio-triggered captures (eg. PIR sensor, doorbell button)
+	Triggers []triggerConfig `json:"triggers,omitempty"`
+
+	// lights switched on around captures (eg. IR illuminators)
+	Lights []lightConfig `json:"lights,omitempty"`
+
+	// notifications to chats which subscribed their topics
+	Notifications *notificationsConfig `json:"notifications,omitempty"`
+
+	// health watchdog which warns admins about problems
+	Health *healthConfig `json:"health,omitempty"`
+
+	// retries of failed captures (not retried if nil)
+	Retry *retryConfig `json:"retry,omitempty"`
+
+	// shutting down on SIGINT or SIGTERM
+	Shutdown *shutdownConfig `json:"shutdown,omitempty"`
+
+	// local database ("sqlite" (default) or "memory")
+	Storage string `json:"storage,omitempty"`
+	DBPath  string `json:"db_path,omitempty"`
+
+	// directory for archiving original images (not archived if empty)
+	ArchiveDir string `json:"archive_dir,omitempty"`
+
+	// interval between captures of `/burst`
+	BurstIntervalMillis int `json:"burst_interval_ms,omitempty"`
+
+	// hdr (exposure-bracketing) capture
+	HDR *hdrConfig `json:"hdr,omitempty"`
+
+	// night mode for capturing in low light (not used if nil)
+	NightMode *nightModeConfig `json:"night_mode,omitempty"`
+
+	// image post-processing presets (applied before sending)
+	ProcessingPresets map[string][]processingStep `json:"processing_presets,omitempty"`
+	DefaultPreset     string                      `json:"default_preset,omitempty"`
+
+	// text overlay burned into images (no overlay if nil)
+	Overlay *overlayConfig `json:"overlay,omitempty"`
+
+	// exif metadata injected into images (original exif is preserved even if nil)
+	Exif *exifConfig `json:"exif,omitempty"`
+
+	// send images as documents (uncompressed, with metadata), instead of photos
+	SendAsDocument bool `json:"send_as_document"`
+
 	// Bot API Token,
 	APIToken string `json:"api_token,omitempty"`
 
@@ -62,50 +136,74 @@ func loadConfig() (conf config, err error) {
 	if execFilepath, err = os.Executable(); err == nil {
 		var file []byte
 		if file, err = os.ReadFile(filepath.Join(filepath.Dir(execFilepath), configFilename)); err == nil {
-			if file, err = standardizeJSON(file); err == nil {
-				var conf config
-				if err = json.Unmarshal(file, &conf); err == nil {
-					if conf.APIToken == "" && conf.Infisical != nil {
-						// read bot token from infisical
-						client := infisical.NewInfisicalClient(
-							context.TODO(),
-							infisical.Config{
-								SiteUrl: "https://app.infisical.com",
-							})
-
-						_, err = client.Auth().UniversalAuthLogin(conf.Infisical.ClientID, conf.Infisical.ClientSecret)
-						if err != nil {
-							return config{}, fmt.Errorf("failed to authenticate with Infisical: %s", err)
-						}
-
-						var keyPath string
-						var secret models.Secret
-
-						// telegram bot token
-						keyPath = conf.Infisical.APITokenKeyPath
-						secret, err = client.Secrets().Retrieve(infisical.RetrieveSecretOptions{
-							ProjectID:   conf.Infisical.ProjectID,
-							Type:        conf.Infisical.SecretType,
-							Environment: conf.Infisical.Environment,
-							SecretPath:  path.Dir(keyPath),
-							SecretKey:   path.Base(keyPath),
-						})
-						if err == nil {
-							conf.APIToken = secret.SecretValue
-						} else {
-							return config{}, fmt.Errorf("failed to retrieve `api_token` from Infisical: %s", err)
-						}
-					}
-
-					return conf, err
+			return parseConfig(file)
+		}
+	}
+
+	return config{}, err
+}
+
+// parseConfig checks and parses given config source (and reads the bot token from infisical, if needed)
+func parseConfig(file []byte) (conf config, err error) {
+	if err = checkConfig(file); err != nil {
+		return config{}, fmt.Errorf("invalid %s:\n%s", configFilename, err)
+	}
+	if file, err = standardizeJSON(file); err == nil {
+		if err = json.Unmarshal(file, &conf); err == nil {
+			if conf.APIToken == "" && conf.Infisical != nil {
+				// read bot token from infisical
+				client := infisical.NewInfisicalClient(
+					context.TODO(),
+					infisical.Config{
+						SiteUrl: "https://app.infisical.com",
+					})
+
+				_, err = client.Auth().UniversalAuthLogin(conf.Infisical.ClientID, conf.Infisical.ClientSecret)
+				if err != nil {
+					return config{}, fmt.Errorf("failed to authenticate with Infisical: %s", err)
+				}
+
+				var keyPath string
+				var secret models.Secret
+
+				// telegram bot token
+				keyPath = conf.Infisical.APITokenKeyPath
+				secret, err = client.Secrets().Retrieve(infisical.RetrieveSecretOptions{
+					ProjectID:   conf.Infisical.ProjectID,
+					Type:        conf.Infisical.SecretType,
+					Environment: conf.Infisical.Environment,
+					SecretPath:  path.Dir(keyPath),
+					SecretKey:   path.Base(keyPath),
+				})
+				if err == nil {
+					conf.APIToken = secret.SecretValue
+				} else {
+					return config{}, fmt.Errorf("failed to retrieve `api_token` from Infisical: %s", err)
 				}
 			}
+
+			return conf, err
 		}
 	}
 
 	return config{}, err
 }
 
+// resolvePath returns given path as an absolute one
+// (relative paths are resolved against the executable's directory)
+func resolvePath(p string) (string, error) {
+	if filepath.IsAbs(p) {
+		return p, nil
+	}
+
+	execFilepath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the executable's path: %s", err)
+	}
+
+	return filepath.Join(filepath.Dir(execFilepath), p), nil
+}
+
 // standardize given JSON (JWCC) bytes
 func standardizeJSON(b []byte) ([]byte, error) {
 	ast, err := hujson.Parse(b)
@@ -129,6 +227,30 @@ func getUptime(launched time.Time) (uptime string) {
 	return fmt.Sprintf("*%d* day(s) *%d* hour(s)", numDays, numHours)
 }
 
+// parseAge parses an age like "30d", "2w", or "12h" (anything `time.ParseDuration` accepts)
+func parseAge(str string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if num, found := strings.CutSuffix(str, suffix); found {
+			n, err := strconv.Atoi(num)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("malformed age: %s", str)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	age, err := time.ParseDuration(str)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("malformed age: %s", str)
+	}
+
+	return age, nil
+}
+
 // getMemoryUsage gets memory usage
 func getMemoryUsage() (usage string) {
 	m := new(runtime.MemStats)
@@ -139,51 +261,139 @@ func getMemoryUsage() (usage string) {
 
 // captureStillImage captures an image with `raspistill`.
 func captureStillImage(
+	ctx context.Context,
 	libcameraStillBinPath string,
 	width, height int,
 	cameraParams map[string]any,
 ) (result []byte, err error) {
 	// command line arguments
-	args := []string{
-		"--width", strconv.Itoa(width),
-		"--height", strconv.Itoa(height),
+	args := append([]string{
 		"--encoding", "jpg",
 		"--output", "-", // output to stdout
+	}, cameraArgs(width, height, cameraParams)...)
+
+	// execute command with timeout, and get its standard output
+	return runCamera(ctx, libcameraStillBinPath, args, cameraTimeout(cameraParams))
+}
+
+// cameraTimeout returns the timeout of a capture, extended for long exposures
+func cameraTimeout(cameraParams map[string]any) time.Duration {
+	timeout := libCameraStillRunTimeoutSeconds * time.Second
+
+	var shutter float64
+	switch v := cameraParams[cameraParamShutter].(type) {
+	case float64:
+		shutter = v
+	case int:
+		shutter = float64(v)
+	case string:
+		shutter, _ = strconv.ParseFloat(v, 64)
+	}
+	if shutter > 0 {
+		timeout += time.Duration(shutter*longExposureTimeoutFactor) * time.Microsecond
+	}
+
+	return timeout
+}
+
+// captureBurstImages captures `count` images at given interval with a single run of `libcamera-still`
+// (in timelapse mode, for skipping the startup time of each capture)
+func captureBurstImages(
+	ctx context.Context,
+	libcameraStillBinPath string,
+	width, height int,
+	cameraParams map[string]any,
+	count int,
+	interval time.Duration,
+) (results [][]byte, err error) {
+	var dir string
+	if dir, err = os.MkdirTemp("", "burst-"); err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// (`--timeout`, `--timelapse`, and `--output` in camera params are overridden)
+	params := maps.Clone(cameraParams)
+	for _, k := range []string{"--timeout", "-t", "--timelapse", "--output", "-o"} {
+		delete(params, k)
+	}
+
+	// command line arguments
+	// (with one more interval of slack, as the last image may be dropped at the end of the timeout;
+	// extra images are discarded)
+	duration := interval * time.Duration(count+1)
+	args := append([]string{
+		"--encoding", "jpg",
+		"--timelapse", strconv.FormatInt(interval.Milliseconds(), 10),
+		"--timeout", strconv.FormatInt(duration.Milliseconds(), 10),
+		"--output", filepath.Join(dir, "burst%04d.jpg"),
+	}, cameraArgs(width, height, params)...)
+
+	// execute command with timeout,
+	if _, err = runCamera(ctx, libcameraStillBinPath, args, libCameraStillRunTimeoutSeconds*time.Second+duration); err != nil {
+		return nil, err
+	}
+
+	// and read captured files
+	var files []string
+	if files, err = filepath.Glob(filepath.Join(dir, "burst*.jpg")); err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	if len(files) < count {
+		return nil, fmt.Errorf("captured only %d of %d images", len(files), count)
+	}
+	for _, file := range files[:count] {
+		var bytes []byte
+		if bytes, err = os.ReadFile(file); err != nil {
+			return nil, fmt.Errorf("failed to read captured image: %s", err)
+		}
+		results = append(results, bytes)
+	}
+
+	return results, nil
+}
+
+// cameraArgs returns command line arguments for given image size and camera params
+func cameraArgs(width, height int, cameraParams map[string]any) (args []string) {
+	if width > 0 && height > 0 { // (full sensor resolution if not given)
+		args = append(args,
+			"--width", strconv.Itoa(width),
+			"--height", strconv.Itoa(height),
+		)
 	}
 	for k, v := range cameraParams {
 		args = append(args, k)
-		if v != nil {
+		switch v := v.(type) {
+		case nil:
+		case float64: // (numbers from json, without exponents; eg. 1e+06 => 1000000)
+			args = append(args, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
 			args = append(args, fmt.Sprintf("%v", v))
 		}
 	}
 
-	// execute command with timeout,
-	cmd := exec.Command(libcameraStillBinPath, args...)
+	return args
+}
+
+// runCamera runs the camera command with given arguments and timeout, and returns its standard output
+// (the process is killed when `ctx` is done; errors of the command are returned as `*cameraError`, with its standard error)
+func runCamera(ctx context.Context, binPath string, args []string, timeout time.Duration) (result []byte, err error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(timeoutCtx, binPath, args...)
 	var buffer bytes.Buffer
+	stderr := &limitedBuffer{limit: maxCameraStderrBytes}
 	cmd.Stdout = &buffer
-	err = cmd.Start()
-	if err == nil {
-		done := make(chan error)
-		go func() { done <- cmd.Wait() }()
-		timeout := time.After(libCameraStillRunTimeoutSeconds * time.Second)
-
-		// and get its standard output
-		select {
-		case <-timeout:
-			err = cmd.Process.Kill()
-			if err == nil {
-				err = fmt.Errorf("command timed out: %s", libcameraStillBinPath)
-			} else {
-				err = fmt.Errorf("command timed out, but failed to kill process: %s", libcameraStillBinPath)
-			}
-		case err = <-done:
-			if err == nil {
-				return buffer.Bytes(), nil
-			} else {
-				err = fmt.Errorf("error running %s: %s", libcameraStillBinPath, err)
-			}
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second // (for not waiting for pipes held by orphaned children after killed)
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("capture canceled: %w", ctx.Err())
 		}
+		return nil, newCameraError(binPath, err, stderr.String(), errors.Is(timeoutCtx.Err(), context.DeadlineExceeded))
 	}
 
-	return nil, err
+	return buffer.Bytes(), nil
 }
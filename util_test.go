@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCaptureBurstImages(t *testing.T) {
+	// writes an image for every interval until the timeout (with or without the last one,
+	// as `libcamera-still` may drop the image at the end of its timeout)
+	for _, last := range []int{1, 0} {
+		bin := fakeCameraScript(t, fmt.Sprintf(`
+while [ $# -gt 0 ]; do
+	case "$1" in
+		--timelapse) interval=$2; shift ;;
+		--timeout) timeout=$2; shift ;;
+		--output) output=$2; shift ;;
+	esac
+	shift
+done
+i=0
+while [ $(( (i + 2 - %d) * interval )) -le $timeout ]; do
+	printf "frame %%d" $i > "$(printf "$output" $i)"
+	i=$((i + 1))
+done`, last))
+
+		for _, count := range []int{2, 5} {
+			images, err := captureBurstImages(context.Background(), bin, 0, 0, nil, count, 10*time.Millisecond)
+			if err != nil {
+				t.Fatalf("failed to capture %d images: %s", count, err)
+			}
+			if len(images) != count {
+				t.Fatalf("expected %d images, got %d", count, len(images))
+			}
+			for i, image := range images {
+				if expected := fmt.Sprintf("frame %d", i); string(image) != expected {
+					t.Errorf("expected '%s', got '%s'", expected, image)
+				}
+			}
+		}
+	}
+
+	// fewer images than requested
+	bin := fakeCameraScript(t, `exit 0`)
+	if _, err := captureBurstImages(context.Background(), bin, 0, 0, nil, 3, 10*time.Millisecond); err == nil || err.Error() != "captured only 0 of 3 images" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}